@@ -1,20 +1,268 @@
 package handlers
 
 import (
+	"ChitChat/internal/shared/application/service/admin"
+	"ChitChat/internal/shared/application/service/auth"
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/stats"
+	"ChitChat/internal/shared/application/service/user"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
-func GetAllUsers(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "All users retrieved"})
+type AdminHandlers struct {
+	userService  *user.UserService
+	adminService *admin.AdminService
+	statsService *stats.StatsService
 }
 
-func DeleteUserByAdmin(c *gin.Context) {
-	id := c.Param("id")
-	c.JSON(http.StatusOK, gin.H{"message": "User deleted by admin", "id": id})
+func NewAdminHandlers(userService *user.UserService, adminService *admin.AdminService, statsService *stats.StatsService) *AdminHandlers {
+	return &AdminHandlers{
+		userService:  userService,
+		adminService: adminService,
+		statsService: statsService,
+	}
 }
 
-func GetSystemStats(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "System stats retrieved"})
+// roleRank orders roles by how much of the tenant they control
+var roleRank = map[string]int{
+	auth.RoleUser:       0,
+	auth.RoleAdmin:      1,
+	auth.RoleOwner:      2,
+	auth.RoleSuperAdmin: 3,
+}
+
+// outranks reports whether the signed-in admin may manage a user with the given role
+func outranks(c *gin.Context, role string) bool {
+	callerRole := c.GetString("role")
+	if callerRole == auth.RoleAdmin {
+		// Admins manage users and fellow admins, but not owners
+		return role == auth.RoleUser || role == auth.RoleAdmin
+	}
+	return roleRank[callerRole] >= roleRank[role]
+}
+
+// targetUser returns the user ID from the path after checking it belongs to
+// the admin's tenant and that the admin's role covers the user's role. Admins
+// may not target themselves when allowSelf is false.
+func (h *AdminHandlers) targetUser(c *gin.Context, allowSelf bool) (string, bool) {
+	tenantID := c.GetString("tenant_id")
+	targetID := c.Param("id")
+
+	if !allowSelf && targetID == c.GetString("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admins cannot perform this action on themselves"})
+		return "", false
+	}
+
+	role, err := h.adminService.GetUserRole(tenantID, targetID)
+	if err != nil {
+		if errors.Is(err, admin.ErrUserNotInTenant) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up user"})
+		}
+		return "", false
+	}
+
+	if !outranks(c, role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient role to manage this user"})
+		return "", false
+	}
+
+	return targetID, true
+}
+
+// GetAllUsers lists the users of the admin's tenant with filtering and pagination
+func (h *AdminHandlers) GetAllUsers(c *gin.Context) {
+	tenantID := c.GetString("tenant_id")
+
+	// Parse pagination parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	// Ensure reasonable limits
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	filter := db.UserFilter{
+		Query:  c.Query("q"),
+		Role:   c.Query("role"),
+		Status: c.Query("status"),
+		Page:   page,
+		Limit:  limit,
+	}
+
+	users, total, err := h.adminService.ListUsers(tenantID, filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "All users retrieved",
+		"users":   users,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// GetUserMemberships lists the rooms a user of the admin's tenant belongs to
+func (h *AdminHandlers) GetUserMemberships(c *gin.Context) {
+	targetID, ok := h.targetUser(c, true)
+	if !ok {
+		return
+	}
+
+	memberships, err := h.userService.GetUserMemberships(c.Request.Context(), targetID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve memberships"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "User memberships retrieved",
+		"id":          targetID,
+		"memberships": memberships,
+	})
+}
+
+// SuspendUser blocks a user from signing in and disconnects them
+func (h *AdminHandlers) SuspendUser(c *gin.Context) {
+	targetID, ok := h.targetUser(c, false)
+	if !ok {
+		return
+	}
+
+	var req db.SuspendUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.adminService.SuspendUser(c.GetString("tenant_id"), targetID, req.Reason); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User suspended", "id": targetID})
+}
+
+// UnsuspendUser lifts a user's suspension
+func (h *AdminHandlers) UnsuspendUser(c *gin.Context) {
+	targetID, ok := h.targetUser(c, false)
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.UnsuspendUser(c.GetString("tenant_id"), targetID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unsuspended", "id": targetID})
+}
+
+// ForceLogout revokes all of a user's sessions
+func (h *AdminHandlers) ForceLogout(c *gin.Context) {
+	targetID, ok := h.targetUser(c, true)
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.ForceLogout(c.GetString("tenant_id"), targetID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User logged out", "id": targetID})
+}
+
+// ResetPhoneVerification requires a user to verify their phone number again
+func (h *AdminHandlers) ResetPhoneVerification(c *gin.Context) {
+	targetID, ok := h.targetUser(c, true)
+	if !ok {
+		return
+	}
+
+	if err := h.adminService.ResetPhoneVerification(c.GetString("tenant_id"), targetID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset phone verification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Phone verification reset", "id": targetID})
+}
+
+// ChangeUserRole changes a user's role within the tenant
+func (h *AdminHandlers) ChangeUserRole(c *gin.Context) {
+	targetID, ok := h.targetUser(c, false)
+	if !ok {
+		return
+	}
+
+	var req db.ChangeRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Only owners can make other users owners
+	if req.Role == auth.RoleOwner && !outranks(c, auth.RoleOwner) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can grant the owner role"})
+		return
+	}
+
+	if err := h.adminService.ChangeRole(c.GetString("tenant_id"), targetID, req.Role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User role changed", "id": targetID, "role": req.Role})
+}
+
+// DeleteUserByAdmin schedules a user's account for deletion on their behalf
+func (h *AdminHandlers) DeleteUserByAdmin(c *gin.Context) {
+	id, ok := h.targetUser(c, false)
+	if !ok {
+		return
+	}
+
+	purgeAfter, err := h.userService.ScheduleDeletion(id, c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The account can no longer be used, so end its live sessions
+	if err := h.adminService.ForceLogout(c.GetString("tenant_id"), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "User deleted by admin",
+		"id":          id,
+		"purge_after": purgeAfter,
+	})
+}
+
+// GetSystemStats returns usage and connection statistics
+func (h *AdminHandlers) GetSystemStats(c *gin.Context) {
+	systemStats, err := h.statsService.GetSystemStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve system stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "System stats retrieved",
+		"stats":   systemStats,
+	})
 }
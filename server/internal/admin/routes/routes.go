@@ -7,11 +7,20 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func SetupAdminRoutes(r *gin.Engine) {
+func SetupAdminRoutes(r *gin.Engine, adminHandlers *handlers.AdminHandlers) {
 	adminAuthRoute := r.Group("/admin")
 	adminAuthRoute.Use(middleware.JWTAuth())
 	adminAuthRoute.Use(middleware.AdminAuthMiddleware())
-	adminAuthRoute.GET("/users", handlers.GetAllUsers)
-	adminAuthRoute.DELETE("/users/:id", handlers.DeleteUserByAdmin)
-	adminAuthRoute.GET("/stats", handlers.GetSystemStats)
+	adminAuthRoute.GET("/users", adminHandlers.GetAllUsers)
+	adminAuthRoute.DELETE("/users/:id", adminHandlers.DeleteUserByAdmin)
+	// Stats span every tenant, so only platform operators may read them
+	adminAuthRoute.GET("/stats", middleware.SuperAdminAuthMiddleware(), adminHandlers.GetSystemStats)
+
+	// User management
+	adminAuthRoute.GET("/users/:id/memberships", adminHandlers.GetUserMemberships)
+	adminAuthRoute.POST("/users/:id/suspend", adminHandlers.SuspendUser)
+	adminAuthRoute.POST("/users/:id/unsuspend", adminHandlers.UnsuspendUser)
+	adminAuthRoute.POST("/users/:id/logout", adminHandlers.ForceLogout)
+	adminAuthRoute.POST("/users/:id/reset-phone-verification", adminHandlers.ResetPhoneVerification)
+	adminAuthRoute.PUT("/users/:id/role", adminHandlers.ChangeUserRole)
 }
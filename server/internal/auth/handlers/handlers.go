@@ -2,19 +2,107 @@ package handlers
 
 import (
 	"ChitChat/internal/shared/application/service/auth"
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/quota"
+	"ChitChat/internal/shared/application/service/settings"
+	"ChitChat/internal/shared/application/service/tenant"
+	"errors"
 	"net/http"
-	"os"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func Signup(c *gin.Context) {
+type AuthHandlers struct {
+	tenantService    *tenant.TenantService
+	settingsService  *settings.SettingsService
+	phoneAuthService *auth.PhoneAuthService
+}
+
+func NewAuthHandlers(tenantService *tenant.TenantService, settingsService *settings.SettingsService, phoneAuthService *auth.PhoneAuthService) *AuthHandlers {
+	return &AuthHandlers{
+		tenantService:    tenantService,
+		settingsService:  settingsService,
+		phoneAuthService: phoneAuthService,
+	}
+}
+
+// requestedSlug returns the tenant slug asked for in the body, the X-Tenant
+// header or the subdomain, in that order
+func requestedSlug(c *gin.Context, tenantService *tenant.TenantService, slug string) string {
+	if slug == "" {
+		slug = c.GetHeader("X-Tenant")
+	}
+	if slug == "" {
+		slug = tenantService.SlugFromHost(c.Request.Host)
+	}
+	return slug
+}
+
+// resolveTenant places a new user in a tenant based on the invite code, the
+// requested tenant slug (body, X-Tenant header or subdomain) and their email
+// or phone number. Signups do not verify email addresses, so joining the
+// tenant of an email domain takes an invitation.
+func resolveTenant(c *gin.Context, tenantService *tenant.TenantService, inviteCode, slug, email, phoneNumber string) (*tenant.Placement, bool) {
+	placement, err := tenantService.ResolveSignupTenant(db.TenantHint{
+		InviteCode:  inviteCode,
+		Slug:        requestedSlug(c, tenantService, slug),
+		Email:       email,
+		PhoneNumber: phoneNumber,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, tenant.ErrInvalidInvite), errors.Is(err, tenant.ErrTenantNotFound):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, tenant.ErrTenantSuspended):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Tenant is suspended"})
+		case errors.Is(err, tenant.ErrInviteRequired):
+			c.JSON(http.StatusForbidden, gin.H{"error": "An invitation is required to join this tenant"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve tenant"})
+		}
+		return nil, false
+	}
+
+	return placement, true
+}
+
+// finishPlacement records the outcome of a signup against its invitation
+func finishPlacement(tenantService *tenant.TenantService, placement *tenant.Placement, user *db.User) {
+	if placement.InviteID == "" {
+		return
+	}
+	if user == nil {
+		tenantService.ReleaseInvite(placement.InviteID)
+		return
+	}
+	tenantService.CompleteInvite(placement.InviteID, user.ID)
+}
+
+// checkSignupMethod rejects a signup when the tenant has disabled the method,
+// releasing any invitation the placement claimed
+func checkSignupMethod(c *gin.Context, tenantService *tenant.TenantService, settingsService *settings.SettingsService, placement *tenant.Placement, method string) bool {
+	tenantSettings, err := settingsService.GetSettings(placement.TenantID)
+	if err != nil {
+		finishPlacement(tenantService, placement, nil)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load tenant settings"})
+		return false
+	}
+	if !settings.AllowsSignup(tenantSettings, method) {
+		finishPlacement(tenantService, placement, nil)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Signup method is disabled for this tenant"})
+		return false
+	}
+	return true
+}
+
+func (h *AuthHandlers) Signup(c *gin.Context) {
 	var req struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		InviteCode string `json:"invite_code"`
+		Tenant     string `json:"tenant"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
@@ -25,21 +113,24 @@ func Signup(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
-	user, err := auth.CreateUser(req.Email, string(hash))
+	placement, ok := resolveTenant(c, h.tenantService, req.InviteCode, req.Tenant, req.Email, "")
+	if !ok {
+		return
+	}
+	if !checkSignupMethod(c, h.tenantService, h.settingsService, placement, settings.SignupEmail) {
+		return
+	}
+	user, err := auth.CreateUser(req.Email, string(hash), placement.TenantID, placement.Role)
+	finishPlacement(h.tenantService, placement, user)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"email":   req.Email,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
+	tokenString, err := auth.GenerateToken(jwt.MapClaims{
+		"user_id":   user.ID,
+		"tenant_id": user.TenantID,
+		"email":     req.Email,
 	})
-	jwtSecret := []byte(os.Getenv("JWT_SECRET"))
-	if len(jwtSecret) == 0 {
-		jwtSecret = []byte("supersecretkey")
-	}
-	tokenString, err := token.SignedString(jwtSecret)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -47,10 +138,11 @@ func Signup(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"token": tokenString})
 }
 
-func Signin(c *gin.Context) {
+func (h *AuthHandlers) Signin(c *gin.Context) {
 	var req struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		Code     string `json:"code"` // SMS code when the tenant requires 2FA
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
@@ -65,16 +157,14 @@ func Signin(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
 		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": req.Username,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
-	})
-	jwtSecret := []byte(os.Getenv("JWT_SECRET"))
-	if len(jwtSecret) == 0 {
-		jwtSecret = []byte("supersecretkey")
+	if !h.checkSecondFactor(c, user, req.Code) {
+		return
 	}
-	tokenString, err := token.SignedString(jwtSecret)
+	tokenString, err := auth.GenerateToken(jwt.MapClaims{
+		"user_id":   user.ID,
+		"tenant_id": user.TenantID,
+		"username":  req.Username,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -82,6 +172,63 @@ func Signin(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"token": tokenString})
 }
 
+// checkSecondFactor enforces SMS two-factor authentication for tenants that
+// require it. Without a code, one is sent to the user's verified phone.
+func (h *AuthHandlers) checkSecondFactor(c *gin.Context, user *db.User, code string) bool {
+	tenantSettings, err := h.settingsService.GetSettings(user.TenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load tenant settings"})
+		return false
+	}
+	if !tenantSettings.Require2FA {
+		return true
+	}
+
+	if user.PhoneNumber == nil || !user.PhoneVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication requires a verified phone number"})
+		return false
+	}
+
+	if code == "" {
+		err := h.phoneAuthService.SendVerificationCode(*user.PhoneNumber, user.TenantID, tenantSettings.SMSSenderID)
+		if errors.Is(err, quota.ErrQuotaExceeded) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "SMS quota of this tenant is exhausted"})
+			return false
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification code"})
+			return false
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":               "Two-factor authentication required",
+			"two_factor_required": true,
+		})
+		return false
+	}
+
+	valid, err := h.phoneAuthService.VerifyCode(*user.PhoneNumber, code)
+	if err != nil || !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+		return false
+	}
+	return true
+}
+
+// PreviewInvite shows which tenant and role an invitation code leads to, so
+// join links can render before the user signs up
+func (h *AuthHandlers) PreviewInvite(c *gin.Context) {
+	preview, err := h.tenantService.PreviewInvite(c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Invitation retrieved",
+		"invite":  preview,
+	})
+}
+
 func Logout(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
@@ -3,9 +3,11 @@ package handlers
 import (
 	"ChitChat/internal/shared/application/service/auth"
 	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/quota"
+	"ChitChat/internal/shared/application/service/settings"
+	"ChitChat/internal/shared/application/service/tenant"
+	"errors"
 	"net/http"
-	"os"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
@@ -13,14 +15,66 @@ import (
 
 type PhoneAuthHandlers struct {
 	phoneAuthService *auth.PhoneAuthService
+	tenantService    *tenant.TenantService
+	settingsService  *settings.SettingsService
 }
 
-func NewPhoneAuthHandlers(phoneAuthService *auth.PhoneAuthService) *PhoneAuthHandlers {
+func NewPhoneAuthHandlers(phoneAuthService *auth.PhoneAuthService, tenantService *tenant.TenantService, settingsService *settings.SettingsService) *PhoneAuthHandlers {
 	return &PhoneAuthHandlers{
 		phoneAuthService: phoneAuthService,
+		tenantService:    tenantService,
+		settingsService:  settingsService,
 	}
 }
 
+// smsTenant returns the tenant the phone number belongs to, or would join on
+// signup, and that tenant's SMS sender ID. Empty means the default sender.
+// Numbers that belong to no tenant and could not join one get an error, so
+// every SMS is metered against a tenant.
+func (h *PhoneAuthHandlers) smsTenant(c *gin.Context, req db.PhoneAuthRequest) (string, string, error) {
+	var tenantID string
+	if user, err := h.phoneAuthService.FindUserByPhone(req.PhoneNumber); err == nil {
+		tenantID = user.TenantID
+	} else {
+		tenantID, err = h.tenantService.LookupTenant(db.TenantHint{
+			InviteCode: req.InviteCode,
+			Slug:       requestedSlug(c, h.tenantService, req.Tenant),
+		})
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	tenantSettings, err := h.settingsService.GetSettings(tenantID)
+	if err != nil {
+		return tenantID, "", nil
+	}
+	return tenantID, tenantSettings.SMSSenderID, nil
+}
+
+// sendCode sends a verification code and responds on failure
+func (h *PhoneAuthHandlers) sendCode(c *gin.Context, req db.PhoneAuthRequest) bool {
+	tenantID, senderID, err := h.smsTenant(c, req)
+	if err == nil {
+		err = h.phoneAuthService.SendVerificationCode(req.PhoneNumber, tenantID, senderID)
+	}
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, tenant.ErrInvalidInvite), errors.Is(err, tenant.ErrTenantNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, tenant.ErrInviteRequired):
+		c.JSON(http.StatusForbidden, gin.H{"error": "An invitation is required to join this tenant"})
+	case errors.Is(err, tenant.ErrTenantSuspended):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tenant is suspended"})
+	case errors.Is(err, quota.ErrQuotaExceeded):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "SMS quota of this tenant is exhausted"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification code"})
+	}
+	return false
+}
+
 // SendVerificationCode sends a verification code to the provided phone number
 func (h *PhoneAuthHandlers) SendVerificationCode(c *gin.Context) {
 	var req db.PhoneAuthRequest
@@ -35,9 +89,7 @@ func (h *PhoneAuthHandlers) SendVerificationCode(c *gin.Context) {
 		return
 	}
 
-	err := h.phoneAuthService.SendVerificationCode(req.PhoneNumber)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification code"})
+	if !h.sendCode(c, req) {
 		return
 	}
 
@@ -92,26 +144,28 @@ func (h *PhoneAuthHandlers) PhoneSignup(c *gin.Context) {
 		return
 	}
 
+	placement, ok := resolveTenant(c, h.tenantService, req.InviteCode, req.Tenant, "", req.PhoneNumber)
+	if !ok {
+		return
+	}
+	if !checkSignupMethod(c, h.tenantService, h.settingsService, placement, settings.SignupPhone) {
+		return
+	}
+
 	// Create the user
-	user, err := h.phoneAuthService.CreateUserWithPhone(req.PhoneNumber, req.Name)
+	user, err := h.phoneAuthService.CreateUserWithPhone(req.PhoneNumber, req.Name, placement.TenantID, placement.Role)
+	finishPlacement(h.tenantService, placement, user)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Generate JWT token
-	jwtSecret := []byte(os.Getenv("JWT_SECRET"))
-	if len(jwtSecret) == 0 {
-		jwtSecret = []byte("supersecretkey")
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	tokenString, err := auth.GenerateToken(jwt.MapClaims{
 		"user_id":      user.ID,
+		"tenant_id":    user.TenantID,
 		"phone_number": req.PhoneNumber,
-		"exp":          time.Now().Add(time.Hour * 72).Unix(),
 	})
-
-	tokenString, err := token.SignedString(jwtSecret)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -192,9 +246,7 @@ func (h *PhoneAuthHandlers) ResendVerificationCode(c *gin.Context) {
 		return
 	}
 
-	err := h.phoneAuthService.SendVerificationCode(req.PhoneNumber)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resend verification code"})
+	if !h.sendCode(c, req) {
 		return
 	}
 
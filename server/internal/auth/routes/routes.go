@@ -7,14 +7,15 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func SetupAuthRoutes(r *gin.Engine, phoneAuthHandlers *handlers.PhoneAuthHandlers) {
+func SetupAuthRoutes(r *gin.Engine, authHandlers *handlers.AuthHandlers, phoneAuthHandlers *handlers.PhoneAuthHandlers) {
 	authGroup := r.Group("/auth")
-	authGroup.POST("/signup", handlers.Signup)
-	authGroup.POST("/signin", handlers.Signin)
+	authGroup.POST("/signup", authHandlers.Signup)
+	authGroup.POST("/signin", authHandlers.Signin)
 	authGroup.POST("/logout", handlers.Logout)
 	authGroup.POST("/refresh", handlers.RefreshToken)
 	authGroup.POST("/forgot-password", handlers.ForgotPassword)
 	authGroup.POST("/reset-password", handlers.ResetPassword)
+	authGroup.GET("/invites/:code", authHandlers.PreviewInvite)
 
 	// Phone authentication routes
 	authGroup.POST("/phone/send-code", phoneAuthHandlers.SendVerificationCode)
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"ChitChat/internal/shared/application/service/attachment"
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/quota"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// multipartOverhead is allowed on top of the file size for the rest of a
+// multipart upload request
+const multipartOverhead = 1 << 20
+
+// attachmentError maps attachment and upload errors to responses
+func attachmentError(c *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, attachment.ErrFileTooLarge), errors.As(err, &maxBytesErr):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File exceeds the maximum upload size"})
+	case errors.Is(err, quota.ErrQuotaExceeded):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Tenant " + err.Error()})
+	case errors.Is(err, attachment.ErrAttachmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+	case errors.Is(err, attachment.ErrUploadNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+	case errors.Is(err, attachment.ErrChunkSize):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chunk size"})
+	case errors.Is(err, attachment.ErrUploadIncomplete):
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload is incomplete"})
+	case errors.Is(err, attachment.ErrProcessing):
+		c.JSON(http.StatusConflict, gin.H{"error": "Attachment is still being processed"})
+	case errors.Is(err, attachment.ErrUnprocessed):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Image is only available to its uploader"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process upload"})
+	}
+}
+
+// UploadAttachment uploads a whole file in a multipart form field named
+// "file". The attachment is sent by referencing it from a message.
+func (h *ChatHandlers) UploadAttachment(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	maxSize := h.attachmentService.MaxUploadSize(c.GetString("tenant_id"))
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			attachmentError(c, err)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required in the \"file\" field"})
+		return
+	}
+	if fileHeader.Size > maxSize {
+		attachmentError(c, attachment.ErrFileTooLarge)
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	uploaded, err := h.attachmentService.Upload(ctx, userID, fileHeader.Filename, fileHeader.Size, file)
+	if err != nil {
+		attachmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "File uploaded",
+		"attachment": uploaded,
+	})
+}
+
+// CreateUpload starts a resumable upload
+func (h *ChatHandlers) CreateUpload(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	var req db.CreateUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	upload, err := h.attachmentService.CreateUploadSession(ctx, userID, req.Filename, req.Size)
+	if err != nil {
+		attachmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Upload created",
+		"upload":  upload,
+	})
+}
+
+// GetUpload returns how much of a resumable upload was received
+func (h *ChatHandlers) GetUpload(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	uploadID := c.Param("upload_id")
+	if _, err := uuid.Parse(uploadID); err != nil {
+		attachmentError(c, attachment.ErrUploadNotFound)
+		return
+	}
+
+	upload, err := h.attachmentService.GetUploadSession(ctx, uploadID, userID)
+	if err != nil {
+		attachmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Upload retrieved",
+		"upload":  upload,
+	})
+}
+
+// UploadChunk appends the request body to a resumable upload at the offset
+// given in the Upload-Offset header
+func (h *ChatHandlers) UploadChunk(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	uploadID := c.Param("upload_id")
+	if _, err := uuid.Parse(uploadID); err != nil {
+		attachmentError(c, attachment.ErrUploadNotFound)
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset header is required"})
+		return
+	}
+
+	chunk, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, attachment.MaxChunkSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			attachmentError(c, attachment.ErrChunkSize)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read chunk"})
+		return
+	}
+
+	upload, err := h.attachmentService.UploadChunk(ctx, uploadID, userID, offset, chunk)
+	if errors.Is(err, attachment.ErrUploadOffset) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Chunk does not start at the upload offset",
+			"upload": upload,
+		})
+		return
+	}
+	if err != nil {
+		attachmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Chunk received",
+		"upload":  upload,
+	})
+}
+
+// CompleteUpload turns a fully received resumable upload into an attachment
+func (h *ChatHandlers) CompleteUpload(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	uploadID := c.Param("upload_id")
+	if _, err := uuid.Parse(uploadID); err != nil {
+		attachmentError(c, attachment.ErrUploadNotFound)
+		return
+	}
+
+	uploaded, err := h.attachmentService.CompleteUpload(ctx, uploadID, userID)
+	if err != nil {
+		attachmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "File uploaded",
+		"attachment": uploaded,
+	})
+}
+
+// AbortUpload cancels a resumable upload
+func (h *ChatHandlers) AbortUpload(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	uploadID := c.Param("upload_id")
+	if _, err := uuid.Parse(uploadID); err != nil {
+		attachmentError(c, attachment.ErrUploadNotFound)
+		return
+	}
+
+	if err := h.attachmentService.AbortUpload(ctx, uploadID, userID); err != nil {
+		attachmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Upload cancelled"})
+}
+
+// GetAttachment returns an attachment with a fresh signed download URL
+func (h *ChatHandlers) GetAttachment(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	attachmentID := c.Param("attachment_id")
+	if _, err := uuid.Parse(attachmentID); err != nil {
+		attachmentError(c, attachment.ErrAttachmentNotFound)
+		return
+	}
+
+	found, err := h.attachmentService.GetAttachment(ctx, attachmentID, userID)
+	if err != nil {
+		attachmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Attachment retrieved",
+		"attachment": found,
+	})
+}
+
+// DownloadAttachment serves the content of an attachment through a signed
+// URL. It needs no Authorization header; the signature identifies the user,
+// who must still be allowed to see the attachment.
+func (h *ChatHandlers) DownloadAttachment(c *gin.Context) {
+	h.serveAttachment(c, false)
+}
+
+// DownloadThumbnail serves the thumbnail of an image through the same
+// signed URL as the image.
+func (h *ChatHandlers) DownloadThumbnail(c *gin.Context) {
+	h.serveAttachment(c, true)
+}
+
+func (h *ChatHandlers) serveAttachment(c *gin.Context, thumbnail bool) {
+	attachmentID := c.Param("attachment_id")
+	if _, err := uuid.Parse(attachmentID); err != nil {
+		attachmentError(c, attachment.ErrAttachmentNotFound)
+		return
+	}
+
+	tenantID, userID, err := attachment.VerifyURL(attachmentID, c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired download URL"})
+		return
+	}
+	ctx := db.ContextWithTenant(c.Request.Context(), tenantID)
+
+	found, content, err := h.attachmentService.OpenAttachment(ctx, attachmentID, userID, thumbnail)
+	if err != nil {
+		attachmentError(c, err)
+		return
+	}
+	defer content.Close()
+
+	headers := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "sandbox",
+		"Cache-Control":           "private, max-age=3600",
+	}
+	if thumbnail {
+		// Thumbnails are small, their length is left to the response writer
+		c.DataFromReader(http.StatusOK, -1, "image/jpeg", content, headers)
+		return
+	}
+
+	disposition := "attachment"
+	if attachment.Inline(found.ContentType) {
+		disposition = "inline"
+	}
+	headers["Content-Disposition"] = mime.FormatMediaType(disposition, map[string]string{"filename": found.Filename})
+
+	c.DataFromReader(http.StatusOK, found.Size, found.ContentType, content, headers)
+}
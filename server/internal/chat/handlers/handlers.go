@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"ChitChat/internal/shared/application/service/attachment"
 	"ChitChat/internal/shared/application/service/chat"
 	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/settings"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -12,15 +15,46 @@ import (
 )
 
 type ChatHandlers struct {
-	chatService *chat.ChatService
+	chatService       *chat.ChatService
+	settingsService   *settings.SettingsService
+	attachmentService *attachment.AttachmentService
 }
 
-func NewChatHandlers(chatService *chat.ChatService) *ChatHandlers {
+func NewChatHandlers(chatService *chat.ChatService, settingsService *settings.SettingsService, attachmentService *attachment.AttachmentService) *ChatHandlers {
 	return &ChatHandlers{
-		chatService: chatService,
+		chatService:       chatService,
+		settingsService:   settingsService,
+		attachmentService: attachmentService,
 	}
 }
 
+// allowDirectMessage rejects direct messages to users the sender shares no
+// room with when the tenant has disabled them
+func (h *ChatHandlers) allowDirectMessage(c *gin.Context, userID, recipientID string) bool {
+	ctx := c.Request.Context()
+
+	tenantID, _ := db.TenantFromContext(ctx)
+	tenantSettings, err := h.settingsService.GetSettings(tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load tenant settings"})
+		return false
+	}
+	if tenantSettings.AllowNonContactDMs || userID == recipientID {
+		return true
+	}
+
+	contacts, err := h.chatService.AreContacts(ctx, userID, recipientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check contacts"})
+		return false
+	}
+	if !contacts {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Direct messages to non-contacts are disabled"})
+		return false
+	}
+	return true
+}
+
 // GetChatRooms retrieves all chat rooms for the authenticated user
 func (h *ChatHandlers) GetChatRooms(c *gin.Context) {
 	userID := c.GetString("user_id")
@@ -29,17 +63,45 @@ func (h *ChatHandlers) GetChatRooms(c *gin.Context) {
 		return
 	}
 
-	// Query database to get user's chat rooms
-	rooms, err := h.chatService.GetUserChatRooms(userID)
+	ctx := c.Request.Context()
+
+	// Archived rooms are listed separately
+	archived := c.Query("archived") == "true"
+
+	// Parse cursor and limit parameters (both optional)
+	cursor := c.DefaultQuery("cursor", "")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	// Ensure reasonable limits
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	// Query database to get user's chat rooms, most recently active first
+	rooms, nextCursor, err := h.chatService.GetUserChatRooms(ctx, userID, archived, cursor, limit)
 	if err != nil {
+		if errors.Is(err, chat.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve chat rooms"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"message": "Chat rooms retrieved",
 		"rooms":   rooms,
-	})
+		"limit":   limit,
+	}
+
+	if nextCursor != "" {
+		response["next_cursor"] = nextCursor
+		response["has_more"] = true
+	} else {
+		response["has_more"] = false
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 // CreateChatRoom creates a new chat room (group or direct)
@@ -50,6 +112,8 @@ func (h *ChatHandlers) CreateChatRoom(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	var req db.CreateRoomRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -69,7 +133,7 @@ func (h *ChatHandlers) CreateChatRoom(c *gin.Context) {
 	}
 
 	// Validate that all users exist
-	if err := h.chatService.ValidateUsersExist(req.UserIDs); err != nil {
+	if err := h.chatService.ValidateUsersExist(ctx, req.UserIDs); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -82,7 +146,7 @@ func (h *ChatHandlers) CreateChatRoom(c *gin.Context) {
 
 	// For direct messages, check if room already exists
 	if req.Type == "direct" {
-		existingRoom, err := h.chatService.CheckIfDirectRoomExists(req.UserIDs[0], req.UserIDs[1])
+		existingRoom, err := h.chatService.CheckIfDirectRoomExists(ctx, req.UserIDs[0], req.UserIDs[1])
 		if err == nil && existingRoom != nil {
 			// Room already exists, return it
 			c.JSON(http.StatusOK, gin.H{
@@ -91,6 +155,14 @@ func (h *ChatHandlers) CreateChatRoom(c *gin.Context) {
 			})
 			return
 		}
+
+		recipientID := req.UserIDs[0]
+		if recipientID == userID {
+			recipientID = req.UserIDs[1]
+		}
+		if !h.allowDirectMessage(c, userID, recipientID) {
+			return
+		}
 	}
 
 	// Create new room
@@ -101,7 +173,7 @@ func (h *ChatHandlers) CreateChatRoom(c *gin.Context) {
 	}
 
 	// Save room and room members to database
-	if err := h.chatService.CreateRoom(&room, req.UserIDs); err != nil {
+	if err := h.chatService.CreateRoom(ctx, &room, userID, req.UserIDs); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create chat room"})
 		return
 	}
@@ -120,6 +192,8 @@ func (h *ChatHandlers) GetMessagesByRoom(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	roomID := c.Param("id")
 	if roomID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Room ID is required"})
@@ -127,7 +201,7 @@ func (h *ChatHandlers) GetMessagesByRoom(c *gin.Context) {
 	}
 
 	// Verify user is member of this room
-	isMember, err := h.chatService.VerifyUserIsRoomMember(userID, roomID)
+	isMember, err := h.chatService.VerifyUserIsRoomMember(ctx, userID, roomID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify room membership"})
 		return
@@ -150,7 +224,7 @@ func (h *ChatHandlers) GetMessagesByRoom(c *gin.Context) {
 	}
 
 	// Query messages from database with pagination
-	messages, err := h.chatService.GetMessagesByRoom(roomID, page, limit)
+	messages, err := h.chatService.GetMessagesByRoom(ctx, roomID, userID, page, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
 		return
@@ -173,6 +247,8 @@ func (h *ChatHandlers) SendMessage(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	roomID := c.Param("id")
 	if roomID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Room ID is required"})
@@ -186,7 +262,7 @@ func (h *ChatHandlers) SendMessage(c *gin.Context) {
 	}
 
 	// Verify user is member of this room
-	isMember, err := h.chatService.VerifyUserIsRoomMember(userID, roomID)
+	isMember, err := h.chatService.VerifyUserIsRoomMember(ctx, userID, roomID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify room membership"})
 		return
@@ -198,15 +274,20 @@ func (h *ChatHandlers) SendMessage(c *gin.Context) {
 
 	// Create message with ULID
 	message := db.Message{
-		ID:      ulid.Make().String(),
-		RoomID:  roomID,
-		UserID:  userID,
-		Content: req.Content,
+		ID:            ulid.Make().String(),
+		RoomID:        roomID,
+		UserID:        userID,
+		Type:          req.Type,
+		Content:       req.Content,
+		ReplyToID:     req.ReplyToID,
+		ThreadRootID:  req.ThreadRootID,
+		Mentions:      req.Mentions,
+		AttachmentIDs: req.AttachmentIDs,
 	}
 
 	// Save message to database
-	if err := h.chatService.SaveMessage(&message); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save message"})
+	if err := h.chatService.SaveMessage(ctx, &message); err != nil {
+		saveMessageError(c, err)
 		return
 	}
 
@@ -225,30 +306,44 @@ func (h *ChatHandlers) SendDirectMessage(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	var req db.DirectMessageRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if !h.allowDirectMessage(c, userID, req.RecipientID) {
+		return
+	}
+
 	// Find or create direct message room between users
-	room, err := h.chatService.FindOrCreateDirectRoom(userID, req.RecipientID)
+	room, err := h.chatService.FindOrCreateDirectRoom(ctx, userID, req.RecipientID)
 	if err != nil {
+		if errors.Is(err, chat.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recipient not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find or create direct message room"})
 		return
 	}
 
 	// Create message with ULID
 	message := db.Message{
-		ID:      ulid.Make().String(),
-		RoomID:  room.ID,
-		UserID:  userID,
-		Content: req.Content,
+		ID:            ulid.Make().String(),
+		RoomID:        room.ID,
+		UserID:        userID,
+		Type:          req.Type,
+		Content:       req.Content,
+		ReplyToID:     req.ReplyToID,
+		Mentions:      req.Mentions,
+		AttachmentIDs: req.AttachmentIDs,
 	}
 
 	// Save message to database
-	if err := h.chatService.SaveMessage(&message); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save message"})
+	if err := h.chatService.SaveMessage(ctx, &message); err != nil {
+		saveMessageError(c, err)
 		return
 	}
 
@@ -267,15 +362,25 @@ func (h *ChatHandlers) GetDirectMessageRoom(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	recipientID := c.Param("recipient_id")
 	if recipientID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Recipient ID is required"})
 		return
 	}
 
+	if !h.allowDirectMessage(c, userID, recipientID) {
+		return
+	}
+
 	// Find or create direct message room between these users
-	room, err := h.chatService.FindOrCreateDirectRoom(userID, recipientID)
+	room, err := h.chatService.FindOrCreateDirectRoom(ctx, userID, recipientID)
 	if err != nil {
+		if errors.Is(err, chat.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recipient not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find or create direct message room"})
 		return
 	}
@@ -294,6 +399,8 @@ func (h *ChatHandlers) AddMemberToRoom(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	roomID := c.Param("id")
 	if roomID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Room ID is required"})
@@ -308,19 +415,14 @@ func (h *ChatHandlers) AddMemberToRoom(c *gin.Context) {
 		return
 	}
 
-	// Verify current user is member of this room
-	isMember, err := h.chatService.VerifyUserIsRoomMember(userID, roomID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify room membership"})
-		return
-	}
-	if !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "User is not a member of this room"})
+	// Only admins and the owner can invite
+	if err := h.chatService.AuthorizeRoomAction(ctx, roomID, userID, chat.ActionInvite); err != nil {
+		roomError(c, err)
 		return
 	}
 
 	// Add member to room
-	if err := h.chatService.AddMemberToRoom(roomID, req.MemberID); err != nil {
+	if err := h.chatService.AddMemberToRoom(ctx, roomID, userID, req.MemberID); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -340,6 +442,8 @@ func (h *ChatHandlers) RemoveMemberFromRoom(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	roomID := c.Param("id")
 	if roomID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Room ID is required"})
@@ -354,20 +458,15 @@ func (h *ChatHandlers) RemoveMemberFromRoom(c *gin.Context) {
 		return
 	}
 
-	// Verify current user is member of this room
-	isMember, err := h.chatService.VerifyUserIsRoomMember(userID, roomID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify room membership"})
-		return
-	}
-	if !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "User is not a member of this room"})
+	// Members can only be removed by someone with a higher room role
+	if err := h.chatService.AuthorizeMemberAction(ctx, roomID, userID, req.MemberID, chat.ActionRemove); err != nil {
+		roomError(c, err)
 		return
 	}
 
 	// Remove member from room
-	if err := h.chatService.RemoveMemberFromRoom(roomID, req.MemberID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := h.chatService.RemoveMemberFromRoom(ctx, roomID, userID, req.MemberID); err != nil {
+		roomError(c, err)
 		return
 	}
 
@@ -386,6 +485,8 @@ func (h *ChatHandlers) GetRoomInfo(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	roomID := c.Param("id")
 	if roomID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Room ID is required"})
@@ -393,7 +494,7 @@ func (h *ChatHandlers) GetRoomInfo(c *gin.Context) {
 	}
 
 	// Verify user is member of this room
-	isMember, err := h.chatService.VerifyUserIsRoomMember(userID, roomID)
+	isMember, err := h.chatService.VerifyUserIsRoomMember(ctx, userID, roomID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify room membership"})
 		return
@@ -404,7 +505,7 @@ func (h *ChatHandlers) GetRoomInfo(c *gin.Context) {
 	}
 
 	// Get room info
-	room, memberCount, err := h.chatService.GetRoomInfo(roomID)
+	room, memberCount, err := h.chatService.GetRoomInfo(ctx, roomID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get room information"})
 		return
@@ -425,15 +526,25 @@ func (h *ChatHandlers) GetDirectMessages(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	recipientID := c.Param("recipient_id")
 	if recipientID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Recipient ID is required"})
 		return
 	}
 
+	if !h.allowDirectMessage(c, userID, recipientID) {
+		return
+	}
+
 	// Find or create direct message room between these users
-	room, err := h.chatService.FindOrCreateDirectRoom(userID, recipientID)
+	room, err := h.chatService.FindOrCreateDirectRoom(ctx, userID, recipientID)
 	if err != nil {
+		if errors.Is(err, chat.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recipient not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find or create direct message room"})
 		return
 	}
@@ -451,7 +562,7 @@ func (h *ChatHandlers) GetDirectMessages(c *gin.Context) {
 	}
 
 	// Get messages from the direct message room
-	messages, err := h.chatService.GetMessagesByRoom(room.ID, page, limit)
+	messages, err := h.chatService.GetMessagesByRoom(ctx, room.ID, userID, page, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve direct messages"})
 		return
@@ -475,6 +586,8 @@ func (h *ChatHandlers) GetMessagesByRoomCursor(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	roomID := c.Param("id")
 	if roomID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Room ID is required"})
@@ -482,7 +595,7 @@ func (h *ChatHandlers) GetMessagesByRoomCursor(c *gin.Context) {
 	}
 
 	// Verify user is member of this room
-	isMember, err := h.chatService.VerifyUserIsRoomMember(userID, roomID)
+	isMember, err := h.chatService.VerifyUserIsRoomMember(ctx, userID, roomID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify room membership"})
 		return
@@ -502,7 +615,7 @@ func (h *ChatHandlers) GetMessagesByRoomCursor(c *gin.Context) {
 	}
 
 	// Get messages using cursor pagination
-	messages, nextCursor, err := h.chatService.GetMessagesByRoomCursor(roomID, cursor, limit)
+	messages, nextCursor, err := h.chatService.GetMessagesByRoomCursor(ctx, roomID, userID, cursor, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
 		return
@@ -533,15 +646,25 @@ func (h *ChatHandlers) GetDirectMessagesCursor(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	recipientID := c.Param("recipient_id")
 	if recipientID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Recipient ID is required"})
 		return
 	}
 
+	if !h.allowDirectMessage(c, userID, recipientID) {
+		return
+	}
+
 	// Find or create direct message room between these users
-	room, err := h.chatService.FindOrCreateDirectRoom(userID, recipientID)
+	room, err := h.chatService.FindOrCreateDirectRoom(ctx, userID, recipientID)
 	if err != nil {
+		if errors.Is(err, chat.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Recipient not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find or create direct message room"})
 		return
 	}
@@ -556,7 +679,7 @@ func (h *ChatHandlers) GetDirectMessagesCursor(c *gin.Context) {
 	}
 
 	// Get messages using cursor pagination
-	messages, nextCursor, err := h.chatService.GetMessagesByRoomCursor(room.ID, cursor, limit)
+	messages, nextCursor, err := h.chatService.GetMessagesByRoomCursor(ctx, room.ID, userID, cursor, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve direct messages"})
 		return
@@ -588,6 +711,8 @@ func (h *ChatHandlers) GetNewMessages(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	roomID := c.Param("id")
 	if roomID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Room ID is required"})
@@ -595,7 +720,7 @@ func (h *ChatHandlers) GetNewMessages(c *gin.Context) {
 	}
 
 	// Verify user is member of this room
-	isMember, err := h.chatService.VerifyUserIsRoomMember(userID, roomID)
+	isMember, err := h.chatService.VerifyUserIsRoomMember(ctx, userID, roomID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify room membership"})
 		return
@@ -627,7 +752,7 @@ func (h *ChatHandlers) GetNewMessages(c *gin.Context) {
 	}
 
 	// Get newer messages using cursor pagination
-	messages, nextCursor, err := h.chatService.GetMessagesByRoomCursorForward(roomID, cursor, limit)
+	messages, nextCursor, err := h.chatService.GetMessagesByRoomCursorForward(ctx, roomID, userID, cursor, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve new messages"})
 		return
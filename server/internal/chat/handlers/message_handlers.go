@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"ChitChat/internal/shared/application/service/auth"
+	"ChitChat/internal/shared/application/service/chat"
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/quota"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// isTenantModerator reports whether the authenticated user moderates the
+// whole tenant
+func isTenantModerator(c *gin.Context) bool {
+	role := c.GetString("role")
+	return role == auth.RoleAdmin || role == auth.RoleOwner || role == auth.RoleSuperAdmin
+}
+
+// EditMessage replaces the content of the authenticated user's message
+// within the tenant's edit window
+func (h *ChatHandlers) EditMessage(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	messageID := c.Param("message_id")
+
+	var req db.EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tenantID, _ := db.TenantFromContext(ctx)
+	tenantSettings, err := h.settingsService.GetSettings(tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load tenant settings"})
+		return
+	}
+
+	message, err := h.chatService.EditMessage(ctx, roomID, messageID, userID, req.Content, tenantSettings.EditWindowMinutes)
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrNotMessageAuthor):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the author can edit a message"})
+		case errors.Is(err, chat.ErrEditWindowExpired):
+			c.JSON(http.StatusForbidden, gin.H{"error": "The edit window for this message has expired"})
+		case errors.Is(err, quota.ErrQuotaExceeded):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Tenant " + err.Error()})
+		case errors.Is(err, chat.ErrNotRoomMember), errors.Is(err, chat.ErrMessageNotFound):
+			roomError(c, err)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Message updated",
+		"msg":     message,
+	})
+}
+
+// GetMessageRevisions lists the previous versions of an edited message
+func (h *ChatHandlers) GetMessageRevisions(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	messageID := c.Param("message_id")
+
+	revisions, err := h.chatService.GetMessageRevisions(ctx, roomID, messageID, userID, isTenantModerator(c))
+	if err != nil {
+		if errors.Is(err, chat.ErrNotRoomMember) || errors.Is(err, chat.ErrRoomPermission) || errors.Is(err, chat.ErrMessageNotFound) {
+			roomError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve message revisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Message revisions retrieved",
+		"room_id":    roomID,
+		"message_id": messageID,
+		"revisions":  revisions,
+	})
+}
+
+// DeleteMessage deletes a message for everyone, or with ?scope=me only for
+// the authenticated user
+func (h *ChatHandlers) DeleteMessage(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	messageID := c.Param("message_id")
+
+	switch c.DefaultQuery("scope", "everyone") {
+	case "me":
+		if err := h.chatService.HideMessage(ctx, roomID, messageID, userID); err != nil {
+			if errors.Is(err, chat.ErrNotRoomMember) || errors.Is(err, chat.ErrMessageNotFound) {
+				roomError(c, err)
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":    "Message deleted for you",
+			"room_id":    roomID,
+			"message_id": messageID,
+		})
+	case "everyone":
+		message, err := h.chatService.DeleteMessage(ctx, roomID, messageID, userID, isTenantModerator(c))
+		if err != nil {
+			roomError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Message deleted",
+			"msg":     message,
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Scope must be me or everyone"})
+	}
+}
+
+// saveMessageError maps errors of sending a message to responses
+func saveMessageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, quota.ErrQuotaExceeded):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Tenant " + err.Error()})
+	case errors.Is(err, chat.ErrInvalidReply):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reply must quote a message of the same room"})
+	case errors.Is(err, chat.ErrInvalidThread):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Thread root must be a top-level message of the same room"})
+	case errors.Is(err, chat.ErrInvalidMention):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mentions must be members of the room"})
+	case errors.Is(err, chat.ErrMentionRoomPermission):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only room admins can mention @room"})
+	case errors.Is(err, chat.ErrInvalidAttachment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Attachments must be your own uploads that were not sent yet"})
+	case errors.Is(err, chat.ErrEmptyMessage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Message needs content or attachments"})
+	case errors.Is(err, chat.ErrInvalidVoiceNote):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Voice notes need exactly one Ogg/Opus or AAC recording and no content"})
+	case errors.Is(err, chat.ErrNotRoomMember), errors.Is(err, chat.ErrRoomPermission):
+		roomError(c, err)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save message"})
+	}
+}
+
+// reactionError maps reaction errors to responses
+func reactionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, chat.ErrInvalidEmoji):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid emoji"})
+	case errors.Is(err, chat.ErrNotRoomMember), errors.Is(err, chat.ErrMessageNotFound):
+		roomError(c, err)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reaction"})
+	}
+}
+
+// AddReaction reacts to a message with an emoji
+func (h *ChatHandlers) AddReaction(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	messageID := c.Param("message_id")
+
+	var req db.ReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.chatService.AddReaction(ctx, roomID, messageID, userID, req.Emoji); err != nil {
+		reactionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Reaction added",
+		"message_id": messageID,
+		"emoji":      req.Emoji,
+	})
+}
+
+// RemoveReaction takes back the authenticated user's reaction to a message
+func (h *ChatHandlers) RemoveReaction(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	messageID := c.Param("message_id")
+	emoji := c.Param("emoji")
+
+	if err := h.chatService.RemoveReaction(ctx, roomID, messageID, userID, emoji); err != nil {
+		reactionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Reaction removed",
+		"message_id": messageID,
+		"emoji":      emoji,
+	})
+}
+
+// GetMessageContext returns a message with the messages around it, for
+// jumping to a quoted message
+func (h *ChatHandlers) GetMessageContext(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	messageID := c.Param("message_id")
+
+	isMember, err := h.chatService.VerifyUserIsRoomMember(ctx, userID, roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify room membership"})
+		return
+	}
+	if !isMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is not a member of this room"})
+		return
+	}
+
+	before, _ := strconv.Atoi(c.DefaultQuery("before", "25"))
+	after, _ := strconv.Atoi(c.DefaultQuery("after", "25"))
+
+	// Ensure reasonable limits
+	if before < 0 || before > 50 {
+		before = 25
+	}
+	if after < 0 || after > 50 {
+		after = 25
+	}
+
+	messages, hasOlder, hasNewer, err := h.chatService.GetMessageWindow(ctx, roomID, userID, messageID, before, after)
+	if err != nil {
+		if errors.Is(err, chat.ErrMessageNotFound) {
+			roomError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Messages retrieved",
+		"room_id":    roomID,
+		"message_id": messageID,
+		"messages":   messages,
+		"has_older":  hasOlder,
+		"has_newer":  hasNewer,
+	})
+}
+
+// GetMentions lists the messages that mention the authenticated user using
+// cursor pagination
+func (h *ChatHandlers) GetMentions(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	cursor := c.DefaultQuery("cursor", "")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	// Ensure reasonable limits
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	mentions, nextCursor, err := h.chatService.GetMentions(ctx, userID, cursor, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve mentions"})
+		return
+	}
+
+	response := gin.H{
+		"message":  "Mentions retrieved",
+		"mentions": mentions,
+		"limit":    limit,
+	}
+
+	if nextCursor != "" {
+		response["next_cursor"] = nextCursor
+		response["has_more"] = true
+	} else {
+		response["has_more"] = false
+	}
+
+	c.JSON(http.StatusOK, response)
+}
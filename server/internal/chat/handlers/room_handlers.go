@@ -0,0 +1,630 @@
+package handlers
+
+import (
+	"ChitChat/internal/shared/application/service/chat"
+	"ChitChat/internal/shared/application/service/db"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// roomError maps room permission errors to responses
+func roomError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, chat.ErrNotRoomMember):
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is not a member of this room"})
+	case errors.Is(err, chat.ErrRoomPermission):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient room role for this action"})
+	case errors.Is(err, chat.ErrMemberNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found in this room"})
+	case errors.Is(err, chat.ErrMessageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// GetRoomMembers lists the members of a room with their roles
+func (h *ChatHandlers) GetRoomMembers(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+
+	if _, err := h.chatService.GetMemberRole(ctx, roomID, userID); err != nil {
+		roomError(c, err)
+		return
+	}
+
+	members, err := h.chatService.GetRoomMembersWithRoles(ctx, roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve room members"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Room members retrieved",
+		"room_id": roomID,
+		"members": members,
+	})
+}
+
+// UpdateRoom changes the name, description, avatar or topic of a group room
+func (h *ChatHandlers) UpdateRoom(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+
+	var req db.UpdateRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.chatService.AuthorizeRoomAction(ctx, roomID, userID, chat.ActionEdit); err != nil {
+		roomError(c, err)
+		return
+	}
+
+	room, err := h.chatService.UpdateRoom(ctx, roomID, userID, req)
+	if err != nil {
+		roomError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Room updated",
+		"room":    room,
+	})
+}
+
+// DeleteRoom deletes a group room for all of its members
+func (h *ChatHandlers) DeleteRoom(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+
+	if err := h.chatService.AuthorizeRoomAction(ctx, roomID, userID, chat.ActionDelete); err != nil {
+		roomError(c, err)
+		return
+	}
+
+	if err := h.chatService.DeleteRoom(ctx, roomID); err != nil {
+		roomError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Room deleted",
+		"room_id": roomID,
+	})
+}
+
+// LeaveRoom removes the authenticated user from a group room
+func (h *ChatHandlers) LeaveRoom(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+
+	if err := h.chatService.LeaveRoom(ctx, roomID, userID); err != nil {
+		roomError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Left room",
+		"room_id": roomID,
+	})
+}
+
+// ArchiveRoom hides a room from the authenticated user's room list
+func (h *ChatHandlers) ArchiveRoom(c *gin.Context) {
+	h.setRoomArchived(c, true)
+}
+
+// UnarchiveRoom returns an archived room to the authenticated user's room list
+func (h *ChatHandlers) UnarchiveRoom(c *gin.Context) {
+	h.setRoomArchived(c, false)
+}
+
+// setRoomArchived archives or unarchives a room for the authenticated user
+func (h *ChatHandlers) setRoomArchived(c *gin.Context, archived bool) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+
+	if err := h.chatService.SetRoomArchived(ctx, roomID, userID, archived); err != nil {
+		if errors.Is(err, chat.ErrNotRoomMember) {
+			roomError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update room archive"})
+		return
+	}
+
+	message := "Room unarchived"
+	if archived {
+		message = "Room archived"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":  message,
+		"room_id":  roomID,
+		"archived": archived,
+	})
+}
+
+// MarkRoomRead marks a room as read up to a message, or entirely when no
+// message is given
+func (h *ChatHandlers) MarkRoomRead(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+
+	var req db.MarkReadRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	marker, err := h.chatService.MarkRoomRead(ctx, roomID, userID, req.MessageID)
+	if err != nil {
+		if errors.Is(err, chat.ErrNotRoomMember) || errors.Is(err, chat.ErrMessageNotFound) {
+			roomError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark room as read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":              "Room marked as read",
+		"room_id":              roomID,
+		"last_read_message_id": marker,
+	})
+}
+
+// GetMessageReaders lists the members who have read a message
+func (h *ChatHandlers) GetMessageReaders(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	messageID := c.Param("message_id")
+
+	readers, err := h.chatService.GetMessageReaders(ctx, roomID, messageID, userID)
+	if err != nil {
+		if errors.Is(err, chat.ErrReadReceiptsHidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Read receipts are only visible to users who share their own"})
+			return
+		}
+		if errors.Is(err, chat.ErrNotRoomMember) || errors.Is(err, chat.ErrMessageNotFound) {
+			roomError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve read receipts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Read receipts retrieved",
+		"room_id":    roomID,
+		"message_id": messageID,
+		"read_by":    readers,
+	})
+}
+
+// GetMessageDelivery lists the delivery state of the authenticated user's
+// message for each recipient
+func (h *ChatHandlers) GetMessageDelivery(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	messageID := c.Param("message_id")
+
+	deliveries, err := h.chatService.GetMessageDelivery(ctx, roomID, messageID, userID)
+	if err != nil {
+		if errors.Is(err, chat.ErrNotMessageAuthor) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the author can see the delivery state of a message"})
+			return
+		}
+		if errors.Is(err, chat.ErrMessageNotFound) {
+			roomError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve delivery state"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Delivery state retrieved",
+		"room_id":    roomID,
+		"message_id": messageID,
+		"recipients": deliveries,
+	})
+}
+
+// MarkListened marks a voice note as played by the authenticated user
+func (h *ChatHandlers) MarkListened(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	messageID := c.Param("message_id")
+
+	listenedAt, err := h.chatService.MarkListened(ctx, roomID, messageID, userID)
+	if err != nil {
+		if errors.Is(err, chat.ErrNotVoiceNote) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Message is not a voice note"})
+			return
+		}
+		if errors.Is(err, chat.ErrNotRoomMember) || errors.Is(err, chat.ErrMessageNotFound) {
+			roomError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark voice note as listened"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Voice note marked as listened",
+		"room_id":     roomID,
+		"message_id":  messageID,
+		"listened_at": listenedAt,
+	})
+}
+
+// GetMessageListeners lists the members who have played a voice note
+func (h *ChatHandlers) GetMessageListeners(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	messageID := c.Param("message_id")
+
+	listeners, err := h.chatService.GetMessageListeners(ctx, roomID, messageID, userID)
+	if err != nil {
+		if errors.Is(err, chat.ErrReadReceiptsHidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Read receipts are only visible to users who share their own"})
+			return
+		}
+		if errors.Is(err, chat.ErrNotVoiceNote) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Message is not a voice note"})
+			return
+		}
+		if errors.Is(err, chat.ErrNotRoomMember) || errors.Is(err, chat.ErrMessageNotFound) {
+			roomError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve listeners"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Listeners retrieved",
+		"room_id":     roomID,
+		"message_id":  messageID,
+		"listened_by": listeners,
+	})
+}
+
+// GetPendingMessages returns messages not yet acknowledged by the
+// authenticated user, oldest first
+func (h *ChatHandlers) GetPendingMessages(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+	// Ensure reasonable limits
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	messages, hasMore, err := h.chatService.GetPendingMessages(c.Request.Context(), userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pending messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Pending messages retrieved",
+		"messages": messages,
+		"limit":    limit,
+		"has_more": hasMore,
+	})
+}
+
+// AcknowledgeMessages marks messages as delivered to the authenticated user
+func (h *ChatHandlers) AcknowledgeMessages(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req db.AckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.chatService.AcknowledgeMessages(c.Request.Context(), userID, req.MessageIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to acknowledge messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Messages acknowledged",
+		"message_ids": req.MessageIDs,
+	})
+}
+
+// GetChatSettings returns the authenticated user's chat privacy settings
+func (h *ChatHandlers) GetChatSettings(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	settings, err := h.chatService.GetChatSettings(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve chat settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Chat settings retrieved",
+		"settings": settings,
+	})
+}
+
+// UpdateChatSettings changes the authenticated user's chat privacy settings
+func (h *ChatHandlers) UpdateChatSettings(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req db.ChatSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings := db.ChatSettings{HideReadReceipts: *req.HideReadReceipts}
+	if err := h.chatService.UpdateChatSettings(c.Request.Context(), userID, settings); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update chat settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Chat settings updated",
+		"settings": settings,
+	})
+}
+
+// SetMemberRole promotes a member to admin or demotes an admin to member
+func (h *ChatHandlers) SetMemberRole(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	memberID := c.Param("user_id")
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.chatService.AuthorizeRoomAction(ctx, roomID, userID, chat.ActionManageRoles); err != nil {
+		roomError(c, err)
+		return
+	}
+
+	if err := h.chatService.SetMemberRole(ctx, roomID, memberID, req.Role); err != nil {
+		roomError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Member role updated",
+		"room_id": roomID,
+		"user_id": memberID,
+		"role":    req.Role,
+	})
+}
+
+// TransferOwnership hands ownership of a group room to another member
+func (h *ChatHandlers) TransferOwnership(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+
+	var req struct {
+		UserID string `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.chatService.TransferOwnership(ctx, roomID, userID, req.UserID); err != nil {
+		roomError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Room ownership transferred",
+		"room_id":  roomID,
+		"owner_id": req.UserID,
+	})
+}
+
+// GetPinnedMessages lists the pinned messages of a room
+func (h *ChatHandlers) GetPinnedMessages(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+
+	if _, err := h.chatService.GetMemberRole(ctx, roomID, userID); err != nil {
+		roomError(c, err)
+		return
+	}
+
+	pins, err := h.chatService.GetPinnedMessages(ctx, roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pinned messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Pinned messages retrieved",
+		"room_id": roomID,
+		"pins":    pins,
+	})
+}
+
+// PinMessage pins a message to the top of its room
+func (h *ChatHandlers) PinMessage(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+
+	var req struct {
+		MessageID string `json:"message_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.chatService.AuthorizeRoomAction(ctx, roomID, userID, chat.ActionPin); err != nil {
+		roomError(c, err)
+		return
+	}
+
+	pin, err := h.chatService.PinMessage(ctx, roomID, req.MessageID, userID)
+	if err != nil {
+		if errors.Is(err, chat.ErrMessageNotFound) {
+			roomError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Message pinned",
+		"pin":     pin,
+	})
+}
+
+// UnpinMessage removes a pinned message from a room
+func (h *ChatHandlers) UnpinMessage(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	messageID := c.Param("message_id")
+
+	if err := h.chatService.AuthorizeRoomAction(ctx, roomID, userID, chat.ActionPin); err != nil {
+		roomError(c, err)
+		return
+	}
+
+	if err := h.chatService.UnpinMessage(ctx, roomID, messageID); err != nil {
+		if errors.Is(err, chat.ErrMessageNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message is not pinned"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unpin message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Message unpinned",
+		"room_id":    roomID,
+		"message_id": messageID,
+	})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"ChitChat/internal/shared/application/service/chat"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SearchMessages searches the messages of the user's rooms, or of one room
+func (h *ChatHandlers) SearchMessages(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is required"})
+		return
+	}
+
+	var filter chat.SearchFilter
+	filter.RoomID = c.Query("room_id")
+	if filter.RoomID != "" {
+		if _, err := uuid.Parse(filter.RoomID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room_id"})
+			return
+		}
+	}
+	filter.AuthorID = c.Query("author_id")
+	if filter.AuthorID != "" {
+		if _, err := uuid.Parse(filter.AuthorID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid author_id"})
+			return
+		}
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 timestamp"})
+			return
+		}
+		filter.From = &t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 timestamp"})
+			return
+		}
+		filter.To = &t
+	}
+	if mentionsMe := c.Query("mentions_me"); mentionsMe != "" {
+		value, err := strconv.ParseBool(mentionsMe)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mentions_me must be true or false"})
+			return
+		}
+		filter.MentionsMe = value
+	}
+
+	if hasAttachment := c.Query("has_attachment"); hasAttachment != "" {
+		value, err := strconv.ParseBool(hasAttachment)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "has_attachment must be true or false"})
+			return
+		}
+		filter.HasAttachment = &value
+	}
+
+	cursor := c.DefaultQuery("cursor", "")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	// Ensure reasonable limits
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	results, nextCursor, err := h.chatService.SearchMessages(ctx, userID, query, filter, cursor, limit)
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrNotRoomMember):
+			c.JSON(http.StatusForbidden, gin.H{"error": "User is not a member of this room"})
+		case errors.Is(err, chat.ErrEmptySearch):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is required"})
+		case errors.Is(err, chat.ErrInvalidCursor):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search messages"})
+		}
+		return
+	}
+
+	response := gin.H{
+		"message": "Search results retrieved",
+		"results": results,
+		"limit":   limit,
+	}
+
+	if nextCursor != "" {
+		response["next_cursor"] = nextCursor
+		response["has_more"] = true
+	} else {
+		response["has_more"] = false
+	}
+
+	c.JSON(http.StatusOK, response)
+}
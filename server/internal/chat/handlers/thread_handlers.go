@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"ChitChat/internal/shared/application/service/chat"
+	"ChitChat/internal/shared/application/service/db"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetThread returns a thread root with its replies using cursor pagination
+func (h *ChatHandlers) GetThread(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	rootID := c.Param("message_id")
+
+	isMember, err := h.chatService.VerifyUserIsRoomMember(ctx, userID, roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify room membership"})
+		return
+	}
+	if !isMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is not a member of this room"})
+		return
+	}
+
+	cursor := c.DefaultQuery("cursor", "")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	// Ensure reasonable limits
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	thread, nextCursor, err := h.chatService.GetThreadMessages(ctx, roomID, rootID, userID, cursor, limit)
+	if err != nil {
+		if errors.Is(err, chat.ErrMessageNotFound) {
+			roomError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve thread"})
+		return
+	}
+
+	response := gin.H{
+		"message":   "Thread retrieved",
+		"room_id":   roomID,
+		"root":      thread.Root,
+		"replies":   thread.Replies,
+		"following": thread.Following,
+		"limit":     limit,
+	}
+
+	if nextCursor != "" {
+		response["next_cursor"] = nextCursor
+		response["has_more"] = true
+	} else {
+		response["has_more"] = false
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// FollowThread makes the authenticated user follow a thread
+func (h *ChatHandlers) FollowThread(c *gin.Context) {
+	h.setThreadFollowed(c, true)
+}
+
+// UnfollowThread stops the authenticated user from following a thread
+func (h *ChatHandlers) UnfollowThread(c *gin.Context) {
+	h.setThreadFollowed(c, false)
+}
+
+func (h *ChatHandlers) setThreadFollowed(c *gin.Context, follow bool) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	rootID := c.Param("message_id")
+
+	var err error
+	if follow {
+		err = h.chatService.FollowThread(ctx, roomID, rootID, userID)
+	} else {
+		err = h.chatService.UnfollowThread(ctx, roomID, rootID, userID)
+	}
+	if err != nil {
+		if errors.Is(err, chat.ErrNotRoomMember) || errors.Is(err, chat.ErrMessageNotFound) {
+			roomError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update thread follow"})
+		return
+	}
+
+	message := "Thread followed"
+	if !follow {
+		message = "Thread unfollowed"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":        message,
+		"room_id":        roomID,
+		"thread_root_id": rootID,
+		"following":      follow,
+	})
+}
+
+// MarkThreadRead marks a followed thread as read up to a reply, or entirely
+// when no reply is given
+func (h *ChatHandlers) MarkThreadRead(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roomID := c.Param("id")
+	rootID := c.Param("message_id")
+
+	var req db.MarkReadRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	marker, err := h.chatService.MarkThreadRead(ctx, roomID, rootID, userID, req.MessageID)
+	if err != nil {
+		if errors.Is(err, chat.ErrNotRoomMember) || errors.Is(err, chat.ErrMessageNotFound) {
+			roomError(c, err)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark thread as read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":              "Thread marked as read",
+		"room_id":              roomID,
+		"thread_root_id":       rootID,
+		"last_read_message_id": marker,
+	})
+}
+
+// GetFollowedThreads lists the threads the authenticated user follows with
+// their unread replies
+func (h *ChatHandlers) GetFollowedThreads(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	threads, err := h.chatService.GetFollowedThreads(ctx, userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve threads"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Threads retrieved",
+		"threads": threads,
+	})
+}
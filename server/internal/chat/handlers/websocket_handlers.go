@@ -50,9 +50,17 @@ func (h *WebSocketHandlers) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	// Add user ID to query parameters for WebSocket service
+	// Reject suspended, deleted or logged out accounts
+	session, err := auth.LoadSession(userID, auth.TenantID(claims), auth.IssuedAt(claims), false)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Add user and tenant IDs to query parameters for WebSocket service
 	query := c.Request.URL.Query()
 	query.Set("user_id", userID)
+	query.Set("tenant_id", session.TenantID)
 	c.Request.URL.RawQuery = query.Encode()
 
 	// Handle WebSocket connection
@@ -3,20 +3,21 @@ package routes
 import (
 	"ChitChat/internal/chat/handlers"
 	"ChitChat/internal/shared/application/middleware"
+	"ChitChat/internal/shared/application/service/attachment"
 	"ChitChat/internal/shared/application/service/chat"
 	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/notification"
+	"ChitChat/internal/shared/application/service/quota"
+	"ChitChat/internal/shared/application/service/settings"
 	"ChitChat/internal/shared/application/service/websocket"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupChatRoutes(r *gin.Engine) {
-	// Initialize WebSocket service
-	wsService := websocket.NewWebSocketService()
-
+func SetupChatRoutes(r *gin.Engine, wsService *websocket.WebSocketService, notificationService *notification.NotificationService, settingsService *settings.SettingsService, quotaService *quota.QuotaService, attachmentService *attachment.AttachmentService) {
 	// Initialize chat service with WebSocket integration
-	chatService := chat.NewChatService(db.GetDB(), wsService)
-	chatHandlers := handlers.NewChatHandlers(chatService)
+	chatService := chat.NewChatService(db.GetDB(), wsService, notificationService, quotaService, settingsService)
+	chatHandlers := handlers.NewChatHandlers(chatService, settingsService, attachmentService)
 
 	// Initialize WebSocket handlers
 	wsHandlers := handlers.NewWebSocketHandlers(wsService)
@@ -28,14 +29,68 @@ func SetupChatRoutes(r *gin.Engine) {
 	chatAuthRoute.GET("/rooms", chatHandlers.GetChatRooms)
 	chatAuthRoute.POST("/rooms", chatHandlers.CreateChatRoom)
 	chatAuthRoute.GET("/rooms/:id", chatHandlers.GetRoomInfo)
+	chatAuthRoute.PATCH("/rooms/:id", chatHandlers.UpdateRoom)
+	chatAuthRoute.DELETE("/rooms/:id", chatHandlers.DeleteRoom)
+	chatAuthRoute.POST("/rooms/:id/leave", chatHandlers.LeaveRoom)
+	chatAuthRoute.PUT("/rooms/:id/archive", chatHandlers.ArchiveRoom)
+	chatAuthRoute.DELETE("/rooms/:id/archive", chatHandlers.UnarchiveRoom)
+	chatAuthRoute.POST("/rooms/:id/read", chatHandlers.MarkRoomRead)
 
 	// Message management
 	chatAuthRoute.GET("/rooms/:id/messages", chatHandlers.GetMessagesByRoom)
 	chatAuthRoute.POST("/rooms/:id/messages", chatHandlers.SendMessage)
+	chatAuthRoute.GET("/rooms/:id/messages/:message_id/context", chatHandlers.GetMessageContext)
+	chatAuthRoute.PATCH("/rooms/:id/messages/:message_id", chatHandlers.EditMessage)
+	chatAuthRoute.DELETE("/rooms/:id/messages/:message_id", chatHandlers.DeleteMessage)
+	chatAuthRoute.POST("/rooms/:id/messages/:message_id/reactions", chatHandlers.AddReaction)
+	chatAuthRoute.DELETE("/rooms/:id/messages/:message_id/reactions/:emoji", chatHandlers.RemoveReaction)
+	chatAuthRoute.GET("/rooms/:id/messages/:message_id/revisions", chatHandlers.GetMessageRevisions)
+	chatAuthRoute.GET("/rooms/:id/messages/:message_id/readers", chatHandlers.GetMessageReaders)
+	chatAuthRoute.GET("/rooms/:id/messages/:message_id/delivery", chatHandlers.GetMessageDelivery)
+	chatAuthRoute.POST("/rooms/:id/messages/:message_id/listened", chatHandlers.MarkListened)
+	chatAuthRoute.GET("/rooms/:id/messages/:message_id/listeners", chatHandlers.GetMessageListeners)
+
+	// Attachments, uploaded whole or in resumable chunks
+	chatAuthRoute.POST("/attachments", chatHandlers.UploadAttachment)
+	chatAuthRoute.POST("/attachments/uploads", chatHandlers.CreateUpload)
+	chatAuthRoute.GET("/attachments/uploads/:upload_id", chatHandlers.GetUpload)
+	chatAuthRoute.PATCH("/attachments/uploads/:upload_id", chatHandlers.UploadChunk)
+	chatAuthRoute.POST("/attachments/uploads/:upload_id/complete", chatHandlers.CompleteUpload)
+	chatAuthRoute.DELETE("/attachments/uploads/:upload_id", chatHandlers.AbortUpload)
+	chatAuthRoute.GET("/attachments/:attachment_id", chatHandlers.GetAttachment)
+
+	// Message search
+	chatAuthRoute.GET("/search", chatHandlers.SearchMessages)
+
+	// Mentions inbox
+	chatAuthRoute.GET("/mentions", chatHandlers.GetMentions)
+
+	// Threads
+	chatAuthRoute.GET("/threads", chatHandlers.GetFollowedThreads)
+	chatAuthRoute.GET("/rooms/:id/threads/:message_id", chatHandlers.GetThread)
+	chatAuthRoute.PUT("/rooms/:id/threads/:message_id/follow", chatHandlers.FollowThread)
+	chatAuthRoute.DELETE("/rooms/:id/threads/:message_id/follow", chatHandlers.UnfollowThread)
+	chatAuthRoute.POST("/rooms/:id/threads/:message_id/read", chatHandlers.MarkThreadRead)
+
+	// Delivery acknowledgements
+	chatAuthRoute.GET("/messages/pending", chatHandlers.GetPendingMessages)
+	chatAuthRoute.POST("/messages/ack", chatHandlers.AcknowledgeMessages)
 
 	// Group chat member management
 	chatAuthRoute.POST("/rooms/:id/members", chatHandlers.AddMemberToRoom)
 	chatAuthRoute.DELETE("/rooms/:id/members", chatHandlers.RemoveMemberFromRoom)
+	chatAuthRoute.GET("/rooms/:id/members", chatHandlers.GetRoomMembers)
+	chatAuthRoute.PUT("/rooms/:id/members/:user_id/role", chatHandlers.SetMemberRole)
+	chatAuthRoute.POST("/rooms/:id/transfer-ownership", chatHandlers.TransferOwnership)
+
+	// Pinned messages
+	chatAuthRoute.GET("/rooms/:id/pins", chatHandlers.GetPinnedMessages)
+	chatAuthRoute.POST("/rooms/:id/pins", chatHandlers.PinMessage)
+	chatAuthRoute.DELETE("/rooms/:id/pins/:message_id", chatHandlers.UnpinMessage)
+
+	// Chat privacy settings
+	chatAuthRoute.GET("/settings", chatHandlers.GetChatSettings)
+	chatAuthRoute.PUT("/settings", chatHandlers.UpdateChatSettings)
 
 	// Direct message endpoints
 	chatAuthRoute.POST("/direct/message", chatHandlers.SendDirectMessage)
@@ -44,5 +99,9 @@ func SetupChatRoutes(r *gin.Engine) {
 
 	// WebSocket endpoints (no JWT middleware - authentication handled manually)
 	r.GET("/chat/ws", wsHandlers.HandleWebSocket)
+
+	// Attachment downloads (no JWT middleware - authorized by a signed URL)
+	r.GET("/chat/files/:attachment_id", chatHandlers.DownloadAttachment)
+	r.GET("/chat/files/:attachment_id/thumbnail", chatHandlers.DownloadThumbnail)
 	chatAuthRoute.GET("/ws/stats", wsHandlers.GetWebSocketStats)
 }
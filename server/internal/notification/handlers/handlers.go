@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/notification"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationHandlers struct {
+	notificationService *notification.NotificationService
+}
+
+func NewNotificationHandlers(notificationService *notification.NotificationService) *NotificationHandlers {
+	return &NotificationHandlers{
+		notificationService: notificationService,
+	}
+}
+
+// GetDNDSchedule retrieves the authenticated user's do-not-disturb schedule
+func (h *NotificationHandlers) GetDNDSchedule(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	schedule, err := h.notificationService.GetDNDSchedule(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Do-not-disturb schedule retrieved",
+		"dnd":     schedule,
+	})
+}
+
+// UpdateDNDSchedule replaces the authenticated user's do-not-disturb schedule
+func (h *NotificationHandlers) UpdateDNDSchedule(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req db.UpdateDNDRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule := db.DNDSchedule{
+		Start:    req.Start,
+		End:      req.End,
+		Timezone: req.Timezone,
+		Until:    req.Until,
+	}
+	if err := h.notificationService.UpdateDNDSchedule(userID, &schedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Do-not-disturb schedule updated",
+		"dnd":     schedule,
+	})
+}
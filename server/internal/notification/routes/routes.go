@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"ChitChat/internal/notification/handlers"
+	"ChitChat/internal/shared/application/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupNotificationRoutes(r *gin.Engine, notificationHandlers *handlers.NotificationHandlers) {
+	notificationAuthRoute := r.Group("/notifications")
+	notificationAuthRoute.Use(middleware.JWTAuth())
+	notificationAuthRoute.GET("/dnd", notificationHandlers.GetDNDSchedule)
+	notificationAuthRoute.PUT("/dnd", notificationHandlers.UpdateDNDSchedule)
+}
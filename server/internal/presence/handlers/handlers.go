@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/presence"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type PresenceHandlers struct {
+	presenceService *presence.PresenceService
+}
+
+func NewPresenceHandlers(presenceService *presence.PresenceService) *PresenceHandlers {
+	return &PresenceHandlers{
+		presenceService: presenceService,
+	}
+}
+
+// QueryPresence returns the presence of a batch of users
+func (h *PresenceHandlers) QueryPresence(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req db.PresenceQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, id := range req.UserIDs {
+		if _, err := uuid.Parse(id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID: " + id})
+			return
+		}
+	}
+
+	presences, err := h.presenceService.GetPresence(c.Request.Context(), req.UserIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve presence"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Presence retrieved",
+		"presence": presences,
+	})
+}
+
+// UpdatePresenceSettings updates the authenticated user's presence privacy settings
+func (h *PresenceHandlers) UpdatePresenceSettings(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req db.PresenceSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.presenceService.UpdateSettings(userID, *req.HideLastSeen); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update presence settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Presence settings updated",
+		"hide_last_seen": *req.HideLastSeen,
+	})
+}
+
+// UpdateStatus sets the authenticated user's custom status
+func (h *PresenceHandlers) UpdateStatus(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req db.UpdateStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := db.UserStatus{
+		Text:      req.Text,
+		Emoji:     req.Emoji,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := h.presenceService.SetStatus(userID, status); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Status updated",
+		"status":  status,
+	})
+}
+
+// ClearStatus removes the authenticated user's custom status
+func (h *PresenceHandlers) ClearStatus(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.presenceService.ClearStatus(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Status cleared"})
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"ChitChat/internal/presence/handlers"
+	"ChitChat/internal/shared/application/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupPresenceRoutes(r *gin.Engine, presenceHandlers *handlers.PresenceHandlers) {
+	presenceAuthRoute := r.Group("/presence")
+	presenceAuthRoute.Use(middleware.JWTAuth())
+	presenceAuthRoute.POST("/query", presenceHandlers.QueryPresence)
+	presenceAuthRoute.PUT("/settings", presenceHandlers.UpdatePresenceSettings)
+
+	// Custom status
+	presenceAuthRoute.PUT("/status", presenceHandlers.UpdateStatus)
+	presenceAuthRoute.DELETE("/status", presenceHandlers.ClearStatus)
+}
@@ -1,14 +1,14 @@
 package middleware
 
 import (
-	"fmt"
+	"ChitChat/internal/shared/application/service/auth"
+	"ChitChat/internal/shared/application/service/db"
+	"errors"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 )
 
 func CORSMiddleware() gin.HandlerFunc {
@@ -16,6 +16,16 @@ func CORSMiddleware() gin.HandlerFunc {
 }
 
 func JWTAuth() gin.HandlerFunc {
+	return jwtAuth(false)
+}
+
+// JWTAuthPendingDeletion is JWTAuth that also lets accounts pending deletion
+// through, for the routes that restore them
+func JWTAuthPendingDeletion() gin.HandlerFunc {
+	return jwtAuth(true)
+}
+
+func jwtAuth(allowDeleted bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -31,44 +41,67 @@ func JWTAuth() gin.HandlerFunc {
 			return
 		}
 
-		jwtSecret := []byte(os.Getenv("JWT_SECRET"))
-		if len(jwtSecret) == 0 {
-			jwtSecret = []byte("supersecretkey")
+		// Only HMAC tokens signed with the server's secret are accepted
+		claims, err := auth.ValidateToken(tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
+		c.Set("username", claims["username"])
+		c.Set("user_id", claims["user_id"])
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		// Reject tokens of suspended, deleted or logged out accounts
+		userID, _ := claims["user_id"].(string)
+		session, err := auth.LoadSession(userID, auth.TenantID(claims), auth.IssuedAt(claims), allowDeleted)
+		if err != nil {
+			status := http.StatusUnauthorized
+			if errors.Is(err, auth.ErrAccountSuspended) || errors.Is(err, auth.ErrTenantSuspended) || errors.Is(err, auth.ErrAccountDeleted) {
+				status = http.StatusForbidden
+			}
+			c.JSON(status, gin.H{"error": sessionErrorMessage(err)})
 			c.Abort()
 			return
 		}
+		c.Set("tenant_id", session.TenantID)
+		c.Set("role", session.Role)
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			fmt.Println(claims)
-			c.Set("username", claims["username"])
-			c.Set("user_id", claims["user_id"])
-		}
+		// Scope every service call of this request to the user's tenant
+		c.Request = c.Request.WithContext(db.ContextWithTenant(c.Request.Context(), session.TenantID))
 
 		c.Next()
 	}
 }
 
+// sessionErrorMessage maps session errors to client-facing messages
+func sessionErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrAccountSuspended):
+		return "Account suspended"
+	case errors.Is(err, auth.ErrTenantSuspended):
+		return "Tenant suspended"
+	case errors.Is(err, auth.ErrAccountDeleted):
+		return "Account pending deletion"
+	case errors.Is(err, auth.ErrSessionRevoked):
+		return "Session revoked, please sign in again"
+	default:
+		return "Account not found"
+	}
+}
+
 func AdminAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// For now, just check if user exists
-		// In a real app, you'd check user role from database
-		username, exists := c.Get("username")
-		if !exists {
+		// Role is loaded from the database by JWTAuth
+		role := c.GetString("role")
+		if role == "" {
 			c.JSON(http.StatusForbidden, gin.H{"error": "User not found"})
 			c.Abort()
 			return
 		}
 
-		// Simple admin check - in real app, check user role
-		if username == "admin" {
+		// Tenant owners and platform superadmins manage their tenant too
+		if role == auth.RoleAdmin || role == auth.RoleOwner || role == auth.RoleSuperAdmin {
 			c.Next()
 		} else {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
@@ -76,3 +109,17 @@ func AdminAuthMiddleware() gin.HandlerFunc {
 		}
 	}
 }
+
+// SuperAdminAuthMiddleware restricts routes to platform operators, who can
+// see and manage every tenant
+func SuperAdminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != auth.RoleSuperAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Superadmin access required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,18 +1,31 @@
 package routes
 
 import (
+	adminhandlers "ChitChat/internal/admin/handlers"
 	adminroutes "ChitChat/internal/admin/routes"
 	authhandlers "ChitChat/internal/auth/handlers"
 	authroutes "ChitChat/internal/auth/routes"
 	chatroutes "ChitChat/internal/chat/routes"
+	presencehandlers "ChitChat/internal/presence/handlers"
+	presenceroutes "ChitChat/internal/presence/routes"
+	notificationhandlers "ChitChat/internal/notification/handlers"
+	notificationroutes "ChitChat/internal/notification/routes"
 	"ChitChat/internal/shared/application/middleware"
+	"ChitChat/internal/shared/application/service/attachment"
+	"ChitChat/internal/shared/application/service/notification"
+	"ChitChat/internal/shared/application/service/quota"
+	"ChitChat/internal/shared/application/service/settings"
+	"ChitChat/internal/shared/application/service/websocket"
 	"ChitChat/internal/shared/handlers"
+	tenanthandlers "ChitChat/internal/tenant/handlers"
+	tenantroutes "ChitChat/internal/tenant/routes"
+	userhandlers "ChitChat/internal/user/handlers"
 	userroutes "ChitChat/internal/user/routes"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(r *gin.Engine, phoneAuthHandlers *authhandlers.PhoneAuthHandlers) {
+func SetupRoutes(r *gin.Engine, wsService *websocket.WebSocketService, notificationService *notification.NotificationService, settingsService *settings.SettingsService, quotaService *quota.QuotaService, attachmentService *attachment.AttachmentService, authHandlers *authhandlers.AuthHandlers, phoneAuthHandlers *authhandlers.PhoneAuthHandlers, accountHandlers *userhandlers.AccountHandlers, adminHandlers *adminhandlers.AdminHandlers, presenceHandlers *presencehandlers.PresenceHandlers, notificationHandlers *notificationhandlers.NotificationHandlers, tenantHandlers *tenanthandlers.TenantHandlers) {
 	// CORS
 	r.Use(middleware.CORSMiddleware())
 
@@ -20,16 +33,25 @@ func SetupRoutes(r *gin.Engine, phoneAuthHandlers *authhandlers.PhoneAuthHandler
 	r.GET("/", handlers.TestRoute)
 
 	// AUTH ROUTES (Public)
-	authroutes.SetupAuthRoutes(r, phoneAuthHandlers)
+	authroutes.SetupAuthRoutes(r, authHandlers, phoneAuthHandlers)
 
 	// USER ROUTES (Public)
-	userroutes.SetupUserRoutes(r)
+	userroutes.SetupUserRoutes(r, accountHandlers)
 
 	// CHAT ROUTES (Authenticated)
-	chatroutes.SetupChatRoutes(r)
+	chatroutes.SetupChatRoutes(r, wsService, notificationService, settingsService, quotaService, attachmentService)
+
+	// PRESENCE ROUTES (Authenticated)
+	presenceroutes.SetupPresenceRoutes(r, presenceHandlers)
+
+	// NOTIFICATION ROUTES (Authenticated)
+	notificationroutes.SetupNotificationRoutes(r, notificationHandlers)
 
 	// ADMIN ROUTES (Admin Only)
-	adminroutes.SetupAdminRoutes(r)
+	adminroutes.SetupAdminRoutes(r, adminHandlers)
+
+	// TENANT ROUTES (Admin and Superadmin Only)
+	tenantroutes.SetupTenantRoutes(r, tenantHandlers)
 
 	// PUBLIC ROUTES
 	r.GET("/health", handlers.HealthCheck)
@@ -1,11 +1,28 @@
 package server
 
 import (
+	adminhandlers "ChitChat/internal/admin/handlers"
 	"ChitChat/internal/auth/handlers"
+	notificationhandlers "ChitChat/internal/notification/handlers"
+	presencehandlers "ChitChat/internal/presence/handlers"
 	"ChitChat/internal/shared/application/routes"
+	"ChitChat/internal/shared/application/service/admin"
+	"ChitChat/internal/shared/application/service/attachment"
 	"ChitChat/internal/shared/application/service/auth"
 	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/notification"
+	"ChitChat/internal/shared/application/service/presence"
+	"ChitChat/internal/shared/application/service/quota"
+	"ChitChat/internal/shared/application/service/settings"
+	"ChitChat/internal/shared/application/service/stats"
+	"ChitChat/internal/shared/application/service/storage"
+	"ChitChat/internal/shared/application/service/tenant"
+	"ChitChat/internal/shared/application/service/user"
+	"ChitChat/internal/shared/application/service/websocket"
+	tenanthandlers "ChitChat/internal/tenant/handlers"
+	userhandlers "ChitChat/internal/user/handlers"
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,14 +32,55 @@ func Run() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// Initialize WebSocket service shared by chat, presence, notifications and admin
+	wsService := websocket.NewWebSocketService()
+	notificationService := notification.NewNotificationService(db.GetDB(), wsService)
+	notificationHandlers := notificationhandlers.NewNotificationHandlers(notificationService)
+
+	// Initialize usage metering, correcting storage totals periodically
+	quotaService := quota.NewQuotaService(db.GetDB(), notificationService)
+	quotaService.StartStorageJob(time.Hour)
+
+	// Initialize tenant service used to place new users in a tenant, and the
+	// per-tenant settings along with their message retention job
+	settingsService := settings.NewSettingsService(db.GetDB(), quotaService)
+	tenantService := tenant.NewTenantService(db.GetDB(), settingsService)
+	settingsService.StartRetentionJob(time.Hour)
+	tenantHandlers := tenanthandlers.NewTenantHandlers(tenantService, settingsService, quotaService)
+
+	// Initialize file storage for attachments, processing images in the
+	// background and removing unused uploads periodically
+	blobStore, err := storage.NewBlobStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure blob storage: %v", err)
+	}
+	attachmentService := attachment.NewAttachmentService(db.GetDB(), blobStore, settingsService, quotaService, wsService)
+	attachmentService.StartCleanupJob(time.Hour)
+	attachmentService.StartProcessingWorkers(2)
+
 	// Initialize phone auth service
-	phoneAuthService := auth.NewPhoneAuthService(db.GetDB())
-	phoneAuthHandlers := handlers.NewPhoneAuthHandlers(phoneAuthService)
+	phoneAuthService := auth.NewPhoneAuthService(db.GetDB(), quotaService)
+	authHandlers := handlers.NewAuthHandlers(tenantService, settingsService, phoneAuthService)
+	phoneAuthHandlers := handlers.NewPhoneAuthHandlers(phoneAuthService, tenantService, settingsService)
+
+	// Initialize user account service and purge accounts past their grace period
+	userService := user.NewUserService(db.GetDB())
+	userService.StartPurgeJob(time.Hour)
+	accountHandlers := userhandlers.NewAccountHandlers(userService)
+
+	// Initialize admin, statistics and presence services
+	adminService := admin.NewAdminService(db.GetDB(), wsService)
+	statsService := stats.NewStatsService(db.GetDB(), wsService)
+	statsService.StartRollupJob(10 * time.Minute)
+	adminHandlers := adminhandlers.NewAdminHandlers(userService, adminService, statsService)
+	presenceService := presence.NewPresenceService(db.GetDB(), wsService)
+	presenceService.StartStatusExpiryJob(time.Minute)
+	presenceHandlers := presencehandlers.NewPresenceHandlers(presenceService)
 
 	r := gin.Default()
-	routes.SetupRoutes(r, phoneAuthHandlers)
+	routes.SetupRoutes(r, wsService, notificationService, settingsService, quotaService, attachmentService, authHandlers, phoneAuthHandlers, accountHandlers, adminHandlers, presenceHandlers, notificationHandlers, tenantHandlers)
 	log.Println("Server is running on http://localhost:4000")
-	err := r.Run(":4000")
+	err = r.Run(":4000")
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
@@ -0,0 +1,224 @@
+package admin
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/websocket"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrUserNotInTenant is returned when an admin targets a user outside their tenant
+var ErrUserNotInTenant = errors.New("user not found")
+
+// AdminService implements tenant-scoped user management for administrators
+type AdminService struct {
+	db        *pgxpool.Pool
+	wsService *websocket.WebSocketService
+}
+
+func NewAdminService(database *pgxpool.Pool, wsService *websocket.WebSocketService) *AdminService {
+	return &AdminService{
+		db:        database,
+		wsService: wsService,
+	}
+}
+
+// ListUsers retrieves the users of a tenant matching the filter, along with
+// the total number of matches for pagination
+func (s *AdminService) ListUsers(tenantID string, filter db.UserFilter) ([]db.User, int, error) {
+	ctx := context.Background()
+
+	conditions := []string{"tenant_id = $1"}
+	args := []interface{}{tenantID}
+
+	if filter.Query != "" {
+		args = append(args, "%"+filter.Query+"%")
+		n := len(args)
+		conditions = append(conditions, fmt.Sprintf("(name ILIKE $%d OR email ILIKE $%d OR phone_number ILIKE $%d)", n, n, n))
+	}
+	if filter.Role != "" {
+		args = append(args, filter.Role)
+		conditions = append(conditions, fmt.Sprintf("role = $%d", len(args)))
+	}
+	switch filter.Status {
+	case "active":
+		conditions = append(conditions, "suspended_at IS NULL AND deleted_at IS NULL")
+	case "suspended":
+		conditions = append(conditions, "suspended_at IS NOT NULL")
+	case "deleted":
+		conditions = append(conditions, "deleted_at IS NOT NULL")
+	case "":
+	default:
+		return nil, 0, fmt.Errorf("unknown status filter %q", filter.Status)
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	err := s.db.QueryRow(ctx, "SELECT COUNT(*) FROM users WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (filter.Page - 1) * filter.Limit
+	args = append(args, filter.Limit, offset)
+	rows, err := s.db.Query(ctx, fmt.Sprintf(`
+		SELECT id, tenant_id, COALESCE(email, ''), name, role, phone_number, COALESCE(phone_verified, false),
+			created_at, deleted_at, purge_after, suspended_at, last_seen_at
+		FROM users
+		WHERE %s
+		ORDER BY created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []db.User{}
+	for rows.Next() {
+		var user db.User
+		err := rows.Scan(&user.ID, &user.TenantID, &user.Email, &user.Name, &user.Role, &user.PhoneNumber, &user.PhoneVerified,
+			&user.CreatedAt, &user.DeletedAt, &user.PurgeAfter, &user.SuspendedAt, &user.LastSeenAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// GetUserRole returns the role of a user in the admin's tenant
+func (s *AdminService) GetUserRole(tenantID, userID string) (string, error) {
+	ctx := context.Background()
+
+	var role string
+	err := s.db.QueryRow(ctx, `
+		SELECT role FROM users WHERE id = $1 AND tenant_id = $2
+	`, userID, tenantID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrUserNotInTenant
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return role, nil
+}
+
+// SuspendUser blocks a user from the API and closes their live connections
+func (s *AdminService) SuspendUser(tenantID, userID, reason string) error {
+	ctx := context.Background()
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE users
+		SET suspended_at = NOW(), suspension_reason = NULLIF($3, '')
+		WHERE id = $1 AND tenant_id = $2 AND suspended_at IS NULL
+	`, userID, tenantID, reason)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("user not found or already suspended")
+	}
+
+	s.wsService.DisconnectUser(userID, "account suspended")
+	return nil
+}
+
+// UnsuspendUser lifts a suspension
+func (s *AdminService) UnsuspendUser(tenantID, userID string) error {
+	ctx := context.Background()
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE users
+		SET suspended_at = NULL, suspension_reason = NULL
+		WHERE id = $1 AND tenant_id = $2 AND suspended_at IS NOT NULL
+	`, userID, tenantID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("user not found or not suspended")
+	}
+
+	return nil
+}
+
+// ForceLogout revokes every token issued to a user so far and closes their
+// live connections. Tokens carry their issue time in whole seconds, so the
+// cut-off is too; tokens issued later in the same second stay valid.
+func (s *AdminService) ForceLogout(tenantID, userID string) error {
+	ctx := context.Background()
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE users SET tokens_valid_after = date_trunc('second', NOW())
+		WHERE id = $1 AND tenant_id = $2
+	`, userID, tenantID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotInTenant
+	}
+
+	s.wsService.DisconnectUser(userID, "session revoked")
+	return nil
+}
+
+// ResetPhoneVerification requires the user to verify their phone number again
+func (s *AdminService) ResetPhoneVerification(tenantID, userID string) error {
+	ctx := context.Background()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var phoneNumber *string
+	err = tx.QueryRow(ctx, `
+		UPDATE users SET phone_verified = false
+		WHERE id = $1 AND tenant_id = $2
+		RETURNING phone_number
+	`, userID, tenantID).Scan(&phoneNumber)
+	if err != nil {
+		return ErrUserNotInTenant
+	}
+
+	// Invalidate any codes that are still outstanding for the number
+	if phoneNumber != nil {
+		_, err = tx.Exec(ctx, `
+			UPDATE phone_verification_codes SET used = true
+			WHERE phone_number = $1 AND used = false
+		`, *phoneNumber)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ChangeRole sets a user's tenant role
+func (s *AdminService) ChangeRole(tenantID, userID, role string) error {
+	ctx := context.Background()
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE users SET role = $3
+		WHERE id = $1 AND tenant_id = $2
+	`, userID, tenantID, role)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotInTenant
+	}
+
+	return nil
+}
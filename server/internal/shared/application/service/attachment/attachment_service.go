@@ -0,0 +1,658 @@
+package attachment
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/quota"
+	"ChitChat/internal/shared/application/service/settings"
+	"ChitChat/internal/shared/application/service/storage"
+	"ChitChat/internal/shared/application/service/websocket"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Chunks of resumable uploads must be at most MaxChunkSize bytes, and all
+// but the last at least MinChunkSize
+const (
+	MinChunkSize = 1 << 20
+	MaxChunkSize = 8 << 20
+)
+
+// Uploads that are not sent with a message, and resumable uploads without
+// progress, are removed after this long
+const unusedTTL = 24 * time.Hour
+
+// sniffLen is how much of a file is used to detect its content type
+const sniffLen = 512
+
+// blobDeletionBatch bounds how many queued blobs the cleanup job removes at once
+const blobDeletionBatch = 500
+
+var (
+	ErrFileTooLarge       = errors.New("file exceeds the maximum upload size")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrUploadNotFound     = errors.New("upload not found")
+	// ErrUploadOffset is returned for chunks that do not continue an upload
+	// where it stands
+	ErrUploadOffset = errors.New("chunk does not start at the upload offset")
+	// ErrChunkSize is returned for chunks over MaxChunkSize, non-final chunks
+	// under MinChunkSize and chunks going past the announced size
+	ErrChunkSize        = errors.New("invalid chunk size")
+	ErrUploadIncomplete = errors.New("upload is incomplete")
+	// ErrProcessing is returned when someone other than the uploader opens
+	// an image whose location data may not have been stripped yet
+	ErrProcessing = errors.New("attachment is still being processed")
+	// ErrUnprocessed is returned when someone other than the uploader opens
+	// an image whose location data could not be stripped
+	ErrUnprocessed = errors.New("image could not be stripped of its location data")
+)
+
+// AttachmentService stores uploaded files in the blob store and controls
+// who may download them. Files become part of a room when a message
+// references them; until then only their uploader can see them. Images are
+// processed in the background once uploaded, while voice notes are
+// analyzed as they are stored.
+type AttachmentService struct {
+	db              *pgxpool.Pool
+	blobStore       storage.BlobStore
+	settingsService *settings.SettingsService
+	quotaService    *quota.QuotaService
+	wsService       *websocket.WebSocketService
+	wake            chan struct{} // signals processing workers
+}
+
+func NewAttachmentService(database *pgxpool.Pool, blobStore storage.BlobStore, settingsService *settings.SettingsService, quotaService *quota.QuotaService, wsService *websocket.WebSocketService) *AttachmentService {
+	return &AttachmentService{
+		db:              database,
+		blobStore:       blobStore,
+		settingsService: settingsService,
+		quotaService:    quotaService,
+		wsService:       wsService,
+		wake:            make(chan struct{}, 1),
+	}
+}
+
+// MaxUploadSize returns the largest file a tenant's users may upload, in bytes
+func (s *AttachmentService) MaxUploadSize(tenantID string) int64 {
+	maxMB := settings.Defaults().MaxUploadSizeMB
+	if tenantSettings, err := s.settingsService.GetSettings(tenantID); err == nil {
+		maxMB = tenantSettings.MaxUploadSizeMB
+	} else {
+		log.Printf("Failed to load settings of tenant %s, using default upload limit: %v", tenantID, err)
+	}
+	return int64(maxMB) << 20
+}
+
+// Columns are the attachment columns read by Scan, for queries aliasing
+// attachments as a
+const Columns = "a.id, a.message_id, a.user_id, a.filename, a.content_type, a.size, a.created_at, " +
+	"a.processing_status, a.width, a.height, a.blurhash, a.thumbnail_key IS NOT NULL, a.duration_ms, a.waveform"
+
+// Scan reads a row selected with Columns into an attachment, followed by
+// any extra columns
+func Scan(row pgx.Row, a *db.Attachment, extra ...any) error {
+	dest := []any{&a.ID, &a.MessageID, &a.UserID, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt,
+		&a.ProcessingStatus, &a.Width, &a.Height, &a.Blurhash, &a.HasThumbnail, &a.DurationMS, &a.Waveform}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// sanitizeFilename keeps the base name of a client-supplied file name,
+// without control characters and at most 255 bytes long
+func sanitizeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
+
+// sniff detects the content type of a file from its first bytes and
+// returns a reader that still yields the whole file
+func sniff(r io.Reader) (string, io.Reader) {
+	buffered := bufio.NewReaderSize(r, sniffLen)
+	head, _ := buffered.Peek(sniffLen)
+	return sniffAudio(head, sniffImage(head, http.DetectContentType(head))), buffered
+}
+
+// Inline reports whether files of a content type may be shown inline by
+// browsers. Anything that could run script is always downloaded instead.
+func Inline(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp", "image/bmp":
+		return true
+	}
+	return strings.HasPrefix(contentType, "video/") || strings.HasPrefix(contentType, "audio/")
+}
+
+// Upload stores a whole file of known size as an attachment of the user
+func (s *AttachmentService) Upload(ctx context.Context, userID, filename string, size int64, r io.Reader) (*db.Attachment, error) {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return nil, db.ErrNoTenantContext
+	}
+	if size > s.MaxUploadSize(tenantID) {
+		return nil, ErrFileTooLarge
+	}
+
+	attachment := &db.Attachment{
+		ID:       uuid.NewString(),
+		UserID:   userID,
+		Filename: sanitizeFilename(filename),
+		Size:     size,
+	}
+	key := "attachments/" + tenantID + "/" + attachment.ID
+
+	var content io.Reader
+	attachment.ContentType, content = sniff(r)
+	content, audio := captureAudio(attachment.ContentType, size, content)
+	if err := s.blobStore.Put(ctx, key, content, size, attachment.ContentType); err != nil {
+		return nil, err
+	}
+	describeAudio(attachment, audio)
+
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		return s.insertAttachment(ctx, tx, tenantID, key, attachment)
+	})
+	if err != nil {
+		s.deleteBlob(key)
+		return nil, err
+	}
+	s.wakeProcessing()
+	return attachment, nil
+}
+
+// insertAttachment records a stored file and meters its storage
+func (s *AttachmentService) insertAttachment(ctx context.Context, tx pgx.Tx, tenantID, key string, attachment *db.Attachment) error {
+	if s.quotaService != nil {
+		if err := s.quotaService.Consume(ctx, tx, tenantID, quota.MetricStorage, attachment.Size); err != nil {
+			return err
+		}
+	}
+	attachment.ProcessingStatus = processingStatus(attachment.ContentType)
+	return tx.QueryRow(ctx, `
+		INSERT INTO attachments (id, tenant_id, user_id, filename, content_type, size, storage_key, processing_status, duration_ms, waveform)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING created_at
+	`, attachment.ID, tenantID, attachment.UserID, attachment.Filename, attachment.ContentType, attachment.Size, key,
+		attachment.ProcessingStatus, attachment.DurationMS, attachment.Waveform).Scan(&attachment.CreatedAt)
+}
+
+// deleteBlob removes a blob that never got a row, logging failures
+func (s *AttachmentService) deleteBlob(key string) {
+	if err := s.blobStore.Delete(context.Background(), key); err != nil {
+		log.Printf("Failed to delete blob %s: %v", key, err)
+	}
+}
+
+// CreateUploadSession starts a resumable upload of a file of the given size
+func (s *AttachmentService) CreateUploadSession(ctx context.Context, userID, filename string, size int64) (*db.UploadSession, error) {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return nil, db.ErrNoTenantContext
+	}
+	if size > s.MaxUploadSize(tenantID) {
+		return nil, ErrFileTooLarge
+	}
+
+	session := db.UploadSession{
+		ID:           uuid.NewString(),
+		Filename:     sanitizeFilename(filename),
+		Size:         size,
+		MinChunkSize: MinChunkSize,
+		MaxChunkSize: MaxChunkSize,
+	}
+	prefix := "uploads/" + tenantID + "/" + session.ID + "/"
+
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `
+			INSERT INTO upload_sessions (id, tenant_id, user_id, filename, size, storage_prefix)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING created_at, updated_at
+		`, session.ID, tenantID, userID, session.Filename, size, prefix).Scan(&session.CreatedAt, &session.UpdatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// uploadSession loads one of the user's uploads, locking it when forUpdate
+// is set. It also returns the upload's chunk count and storage prefix.
+func uploadSession(ctx context.Context, tx pgx.Tx, uploadID, userID string, forUpdate bool) (*db.UploadSession, int, string, error) {
+	query := `
+		SELECT id, filename, size, received, chunks, storage_prefix, created_at, updated_at
+		FROM upload_sessions
+		WHERE id = $1 AND user_id = $2`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	session := db.UploadSession{MinChunkSize: MinChunkSize, MaxChunkSize: MaxChunkSize}
+	var chunks int
+	var prefix string
+	err := tx.QueryRow(ctx, query, uploadID, userID).Scan(&session.ID, &session.Filename, &session.Size,
+		&session.Received, &chunks, &prefix, &session.CreatedAt, &session.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, "", ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, 0, "", err
+	}
+	return &session, chunks, prefix, nil
+}
+
+// chunkKey is the blob key of the chunk with the given index
+func chunkKey(prefix string, index int) string {
+	return fmt.Sprintf("%s%06d", prefix, index)
+}
+
+// GetUploadSession returns the state of one of the user's uploads, so an
+// interrupted upload can resume at Received
+func (s *AttachmentService) GetUploadSession(ctx context.Context, uploadID, userID string) (*db.UploadSession, error) {
+	var session *db.UploadSession
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		session, _, _, err = uploadSession(ctx, tx, uploadID, userID, false)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// UploadChunk appends a chunk to one of the user's uploads. offset must be
+// the number of bytes received so far; on ErrUploadOffset the returned
+// session tells where to continue.
+func (s *AttachmentService) UploadChunk(ctx context.Context, uploadID, userID string, offset int64, chunk []byte) (*db.UploadSession, error) {
+	var session *db.UploadSession
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		// The lock keeps concurrent retries of a chunk from interleaving
+		var chunks int
+		var prefix string
+		var err error
+		session, chunks, prefix, err = uploadSession(ctx, tx, uploadID, userID, true)
+		if err != nil {
+			return err
+		}
+		if offset != session.Received {
+			return ErrUploadOffset
+		}
+
+		n := int64(len(chunk))
+		last := session.Received+n == session.Size
+		if n == 0 || n > MaxChunkSize || session.Received+n > session.Size || (n < MinChunkSize && !last) {
+			return ErrChunkSize
+		}
+
+		if err := s.blobStore.Put(ctx, chunkKey(prefix, chunks), bytes.NewReader(chunk), n, "application/octet-stream"); err != nil {
+			return err
+		}
+
+		return tx.QueryRow(ctx, `
+			UPDATE upload_sessions SET received = received + $2, chunks = chunks + 1, updated_at = NOW()
+			WHERE id = $1
+			RETURNING received, updated_at
+		`, uploadID, n).Scan(&session.Received, &session.UpdatedAt)
+	})
+	if errors.Is(err, ErrUploadOffset) {
+		return session, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// chunkReader reads the chunks of an upload one after the other, opening
+// each only when the previous one is used up
+type chunkReader struct {
+	ctx     context.Context
+	store   storage.BlobStore
+	keys    []string
+	current io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.keys) == 0 {
+				return 0, io.EOF
+			}
+			chunk, err := r.store.Get(r.ctx, r.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			r.current, r.keys = chunk, r.keys[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if errors.Is(err, io.EOF) {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
+
+// CompleteUpload turns a fully received upload into an attachment. The
+// chunks are combined into one blob and removed by the cleanup job.
+func (s *AttachmentService) CompleteUpload(ctx context.Context, uploadID, userID string) (*db.Attachment, error) {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return nil, db.ErrNoTenantContext
+	}
+
+	var session *db.UploadSession
+	var chunks int
+	var prefix string
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		session, chunks, prefix, err = uploadSession(ctx, tx, uploadID, userID, false)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if session.Received != session.Size {
+		return nil, ErrUploadIncomplete
+	}
+
+	attachment := &db.Attachment{
+		ID:       uuid.NewString(),
+		UserID:   userID,
+		Filename: session.Filename,
+		Size:     session.Size,
+	}
+	key := "attachments/" + tenantID + "/" + attachment.ID
+
+	keys := make([]string, chunks)
+	for i := range keys {
+		keys[i] = chunkKey(prefix, i)
+	}
+	chunkContent := &chunkReader{ctx: ctx, store: s.blobStore, keys: keys}
+	defer chunkContent.Close()
+
+	var content io.Reader
+	attachment.ContentType, content = sniff(chunkContent)
+	content, audio := captureAudio(attachment.ContentType, session.Size, content)
+	if err := s.blobStore.Put(ctx, key, content, session.Size, attachment.ContentType); err != nil {
+		return nil, err
+	}
+	describeAudio(attachment, audio)
+
+	err = db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		// Completing twice at once must create only one attachment
+		tag, err := tx.Exec(ctx, "DELETE FROM upload_sessions WHERE id = $1 AND user_id = $2", uploadID, userID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrUploadNotFound
+		}
+		return s.insertAttachment(ctx, tx, tenantID, key, attachment)
+	})
+	if err != nil {
+		s.deleteBlob(key)
+		return nil, err
+	}
+	s.wakeProcessing()
+	return attachment, nil
+}
+
+// AbortUpload cancels one of the user's uploads
+func (s *AttachmentService) AbortUpload(ctx context.Context, uploadID, userID string) error {
+	return db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "DELETE FROM upload_sessions WHERE id = $1 AND user_id = $2", uploadID, userID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrUploadNotFound
+		}
+		return nil
+	})
+}
+
+// visibleAttachment loads an attachment the user may see: one of a message
+// in a room they are a member of, or one they uploaded and have not sent
+// yet. It also returns the blob keys of the attachment and its thumbnail.
+func visibleAttachment(ctx context.Context, tx pgx.Tx, attachmentID, userID string) (*db.Attachment, string, *string, error) {
+	var attachment db.Attachment
+	var key string
+	var thumbnailKey *string
+	err := Scan(tx.QueryRow(ctx, `
+		SELECT `+Columns+`, a.storage_key, a.thumbnail_key
+		FROM attachments a
+		LEFT JOIN messages m ON m.id = a.message_id
+		WHERE a.id = $1 AND (
+			(m.deleted_at IS NULL AND EXISTS (
+				SELECT 1 FROM room_members rm WHERE rm.room_id = m.room_id AND rm.user_id = $2
+			))
+			OR (a.attached_at IS NULL AND a.user_id = $2)
+		)
+	`, attachmentID, userID), &attachment, &key, &thumbnailKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, "", nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return &attachment, key, thumbnailKey, nil
+}
+
+// GetAttachment returns an attachment the user may see, with a download URL
+// signed for them
+func (s *AttachmentService) GetAttachment(ctx context.Context, attachmentID, userID string) (*db.Attachment, error) {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return nil, db.ErrNoTenantContext
+	}
+
+	var attachment *db.Attachment
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		attachment, _, _, err = visibleAttachment(ctx, tx, attachmentID, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	Sign(tenantID, userID, attachment)
+	return attachment, nil
+}
+
+// OpenAttachment opens the content of an attachment the user may see, or
+// its JPEG thumbnail. The caller closes the returned reader.
+func (s *AttachmentService) OpenAttachment(ctx context.Context, attachmentID, userID string, thumbnail bool) (*db.Attachment, io.ReadCloser, error) {
+	var attachment *db.Attachment
+	var key string
+	var thumbnailKey *string
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		attachment, key, thumbnailKey, err = visibleAttachment(ctx, tx, attachmentID, userID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if status := attachment.ProcessingStatus; status != nil && attachment.UserID != userID {
+		switch {
+		case *status == ProcessingPending || *status == ProcessingRunning:
+			return nil, nil, ErrProcessing
+		// Videos are served as they are
+		case *status != ProcessingReady && strings.HasPrefix(attachment.ContentType, "image/"):
+			return nil, nil, ErrUnprocessed
+		}
+	}
+	if thumbnail {
+		if thumbnailKey == nil {
+			return nil, nil, ErrAttachmentNotFound
+		}
+		key = *thumbnailKey
+	}
+
+	content, err := s.blobStore.Get(ctx, key)
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, content, nil
+}
+
+// Cleanup removes attachments that were never sent or whose message was
+// deleted, abandoned uploads, and then the blobs of everything removed
+func (s *AttachmentService) Cleanup() error {
+	ctx := db.SystemContext(context.Background())
+
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			WITH removed AS (
+				DELETE FROM attachments
+				WHERE message_id IS NULL
+				AND (attached_at IS NOT NULL OR created_at < NOW() - make_interval(secs => $1))
+				RETURNING tenant_id, size + COALESCE(thumbnail_size, 0) AS size
+			)
+			SELECT tenant_id, SUM(size)::bigint FROM removed GROUP BY tenant_id
+		`, unusedTTL.Seconds())
+		if err != nil {
+			return err
+		}
+		freed := make(map[string]int64)
+		for rows.Next() {
+			var tenantID string
+			var bytes int64
+			if err := rows.Scan(&tenantID, &bytes); err != nil {
+				rows.Close()
+				return err
+			}
+			freed[tenantID] = bytes
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if s.quotaService != nil {
+			for tenantID, bytes := range freed {
+				if err := s.quotaService.Consume(ctx, tx, tenantID, quota.MetricStorage, -bytes); err != nil {
+					return err
+				}
+			}
+		}
+
+		_, err = tx.Exec(ctx, `
+			DELETE FROM upload_sessions WHERE updated_at < NOW() - make_interval(secs => $1)
+		`, unusedTTL.Seconds())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.deleteQueuedBlobs(ctx)
+}
+
+// deleteQueuedBlobs removes the blobs queued for deletion from the blob
+// store. Blobs that fail stay queued for the next run.
+func (s *AttachmentService) deleteQueuedBlobs(ctx context.Context) error {
+	for {
+		var done []int64
+		var queued int
+		err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+			rows, err := tx.Query(ctx, `
+				SELECT id, storage_key FROM blob_deletions ORDER BY id LIMIT $1
+			`, blobDeletionBatch)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var id int64
+				var key string
+				if err := rows.Scan(&id, &key); err != nil {
+					return err
+				}
+				queued++
+				if err := s.blobStore.Delete(ctx, key); err != nil {
+					log.Printf("Failed to delete blob %s: %v", key, err)
+					continue
+				}
+				done = append(done, id)
+			}
+			return rows.Err()
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(done) > 0 {
+			err = db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, "DELETE FROM blob_deletions WHERE id = ANY($1)", done)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		// Stop on a short batch, or when nothing could be deleted
+		if queued < blobDeletionBatch || len(done) == 0 {
+			return nil
+		}
+	}
+}
+
+// StartCleanupJob periodically removes unused attachments and uploads
+func (s *AttachmentService) StartCleanupJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := s.Cleanup(); err != nil {
+				log.Printf("Attachment cleanup job failed: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,562 @@
+package attachment
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"time"
+)
+
+// Content types of audio that can be sent as a voice note
+const (
+	ContentTypeOggOpus = "audio/ogg"
+	ContentTypeAAC     = "audio/aac"
+	ContentTypeM4A     = "audio/mp4"
+)
+
+const (
+	// maxVoiceNoteSize bounds the audio analyzed as a possible voice note,
+	// as it is kept in memory while it is stored
+	maxVoiceNoteSize = 16 << 20
+	// waveformSamples is the number of bars in a voice note's waveform
+	waveformSamples = 64
+	// waveformPeak is the value of the loudest bar
+	waveformPeak = 100
+	// maxVoiceNoteLength bounds the duration of voice notes; longer ones
+	// come from broken or forged headers
+	maxVoiceNoteLength = 2 * time.Hour
+	// maxAACFrames is the most AAC frames of 1024 samples at 96 kHz that fit
+	// in maxVoiceNoteLength
+	maxAACFrames = uint64(maxVoiceNoteLength/time.Second) * 96000 / 1024
+)
+
+var errInvalidAudio = errors.New("invalid audio")
+
+// audioFrame is one compressed packet of an audio stream
+type audioFrame struct {
+	duration time.Duration
+	size     int
+}
+
+// sniffAudio refines the content type of audio that http.DetectContentType
+// does not recognize or reports as a generic container
+func sniffAudio(head []byte, detected string) string {
+	switch {
+	case len(head) >= 36 && bytes.HasPrefix(head, []byte("OggS")) && string(head[28:36]) == "OpusHead":
+		return ContentTypeOggOpus
+	case len(head) >= 7 && head[0] == 0xFF && head[1]&0xF6 == 0xF0:
+		return ContentTypeAAC
+	case len(head) >= 12 && string(head[4:8]) == "ftyp" && string(head[8:12]) == "M4A ":
+		return ContentTypeM4A
+	}
+	return detected
+}
+
+// IsVoiceContentType reports whether audio of a content type can be sent as
+// a voice note
+func IsVoiceContentType(contentType string) bool {
+	return contentType == ContentTypeOggOpus || contentType == ContentTypeAAC || contentType == ContentTypeM4A
+}
+
+// captureAudio returns a reader that also copies the content of possible
+// voice notes into a buffer, which is nil for other files
+func captureAudio(contentType string, size int64, content io.Reader) (io.Reader, *bytes.Buffer) {
+	if !IsVoiceContentType(contentType) || size > maxVoiceNoteSize {
+		return content, nil
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	return io.TeeReader(content, buf), buf
+}
+
+// describeAudio fills in the duration and waveform of a voice note. Audio
+// whose container does not validate is kept as a plain file.
+func describeAudio(attachment *db.Attachment, content *bytes.Buffer) {
+	if content == nil {
+		return
+	}
+	duration, waveform, err := analyzeAudio(attachment.ContentType, content.Bytes())
+	if err != nil {
+		log.Printf("Attachment %s is not a valid voice note: %v", attachment.ID, err)
+		return
+	}
+	durationMS := int(duration.Milliseconds())
+	attachment.DurationMS = &durationMS
+	attachment.Waveform = waveform
+}
+
+// analyzeAudio validates the container of a voice note and returns its
+// duration and waveform. The audio is not decoded: the waveform follows the
+// bitrate of the stream, which variable bitrate codecs such as Opus raise
+// for loud or busy passages and lower for silence. Constant bitrate streams
+// get a flat waveform.
+func analyzeAudio(contentType string, data []byte) (time.Duration, []int, error) {
+	var frames []audioFrame
+	var duration time.Duration
+	var err error
+	switch contentType {
+	case ContentTypeOggOpus:
+		frames, duration, err = parseOggOpus(data)
+	case ContentTypeAAC:
+		frames, duration, err = parseADTS(data)
+	case ContentTypeM4A:
+		frames, duration, err = parseM4A(data)
+	default:
+		return 0, nil, errInvalidAudio
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if duration <= 0 || len(frames) == 0 {
+		return 0, nil, errInvalidAudio
+	}
+	return duration, waveform(frames), nil
+}
+
+// samplesDuration returns how long a number of samples at a sample rate
+// plays, without overflowing for forged counts
+func samplesDuration(samples, rate uint64) (time.Duration, error) {
+	if rate == 0 || samples/rate >= uint64(maxVoiceNoteLength/time.Second) {
+		return 0, errInvalidAudio
+	}
+	seconds, rest := samples/rate, samples%rate
+	return time.Duration(seconds)*time.Second + time.Duration(rest*uint64(time.Second)/rate), nil
+}
+
+// waveform spreads the bytes of each frame over the waveform's bars it
+// overlaps and scales the bars to the loudest one
+func waveform(frames []audioFrame) []int {
+	var total time.Duration
+	for _, frame := range frames {
+		total += frame.duration
+	}
+	bars := make([]float64, waveformSamples)
+	if total <= 0 {
+		return make([]int, waveformSamples)
+	}
+	width := float64(total) / waveformSamples
+
+	var start float64
+	for _, frame := range frames {
+		end := start + float64(frame.duration)
+		if frame.duration > 0 {
+			rate := float64(frame.size) / float64(frame.duration)
+			for i := int(start / width); i < waveformSamples && float64(i)*width < end; i++ {
+				overlap := min(end, float64(i+1)*width) - max(start, float64(i)*width)
+				if overlap > 0 {
+					bars[i] += rate * overlap
+				}
+			}
+		}
+		start = end
+	}
+
+	var peak float64
+	for _, bar := range bars {
+		peak = max(peak, bar)
+	}
+	samples := make([]int, waveformSamples)
+	if peak == 0 {
+		return samples
+	}
+	for i, bar := range bars {
+		samples[i] = int(bar/peak*waveformPeak + 0.5)
+	}
+	return samples
+}
+
+// oggCRCTable is the lookup table of the CRC-32 used by Ogg pages, which
+// unlike hash/crc32 is not bit-reflected
+var oggCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for range 8 {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func oggCRC(page []byte) uint32 {
+	var crc uint32
+	for i, b := range page {
+		if i >= 22 && i < 26 {
+			b = 0 // the checksum field counts as zero
+		}
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// parseOggOpus reads the packets of the first logical stream of an Ogg
+// file, which must be Opus (RFC 7845). The duration comes from the granule
+// position of the last page, less the decoder's pre-skip.
+func parseOggOpus(data []byte) ([]audioFrame, time.Duration, error) {
+	var frames []audioFrame
+	var packet []byte
+	var serial uint32
+	var preSkip, granule int64
+	packets := 0
+	first := true
+
+	for len(data) > 0 {
+		if len(data) < 27 || string(data[:4]) != "OggS" || data[4] != 0 {
+			return nil, 0, errInvalidAudio
+		}
+		segments := int(data[26])
+		headerLen := 27 + segments
+		if len(data) < headerLen {
+			return nil, 0, errInvalidAudio
+		}
+		bodyLen := 0
+		for _, lacing := range data[27:headerLen] {
+			bodyLen += int(lacing)
+		}
+		if len(data) < headerLen+bodyLen {
+			return nil, 0, errInvalidAudio
+		}
+		page := data[:headerLen+bodyLen]
+		data = data[len(page):]
+		if oggCRC(page) != binary.LittleEndian.Uint32(page[22:26]) {
+			return nil, 0, errInvalidAudio
+		}
+
+		headerType := page[5]
+		pageSerial := binary.LittleEndian.Uint32(page[14:18])
+		if first {
+			if headerType&0x02 == 0 {
+				return nil, 0, errInvalidAudio
+			}
+			serial = pageSerial
+			first = false
+		} else if pageSerial != serial {
+			continue // another multiplexed stream
+		}
+		if headerType&0x01 == 0 && len(packet) > 0 {
+			return nil, 0, errInvalidAudio // a packet was left unfinished
+		}
+
+		body := page[headerLen:]
+		for _, lacing := range page[27:headerLen] {
+			packet = append(packet, body[:lacing]...)
+			body = body[lacing:]
+			if lacing == 255 {
+				continue // the packet goes on in the next segment
+			}
+
+			switch packets {
+			case 0:
+				// Identification header, with version 0.x
+				if len(packet) < 19 || string(packet[:8]) != "OpusHead" || packet[8]>>4 != 0 || packet[9] == 0 {
+					return nil, 0, errInvalidAudio
+				}
+				preSkip = int64(binary.LittleEndian.Uint16(packet[10:12]))
+			case 1:
+				if len(packet) < 8 || string(packet[:8]) != "OpusTags" {
+					return nil, 0, errInvalidAudio
+				}
+			default:
+				samples, err := opusPacketSamples(packet)
+				if err != nil {
+					return nil, 0, err
+				}
+				frames = append(frames, audioFrame{
+					duration: time.Duration(samples) * time.Second / 48000,
+					size:     len(packet),
+				})
+			}
+			packets++
+			packet = packet[:0]
+		}
+
+		if position := int64(binary.LittleEndian.Uint64(page[6:14])); position >= 0 {
+			granule = position
+		}
+		if headerType&0x04 != 0 {
+			break // end of stream
+		}
+	}
+	if len(packet) > 0 || packets < 2 {
+		return nil, 0, errInvalidAudio
+	}
+
+	// Opus granule positions count 48 kHz samples whatever the input rate
+	if granule <= preSkip {
+		return nil, 0, errInvalidAudio
+	}
+	duration, err := samplesDuration(uint64(granule-preSkip), 48000)
+	return frames, duration, err
+}
+
+// opusPacketSamples returns the number of 48 kHz samples in an Opus packet
+// from its table-of-contents byte (RFC 6716, section 3.1)
+func opusPacketSamples(packet []byte) (int, error) {
+	if len(packet) == 0 {
+		return 0, errInvalidAudio
+	}
+	toc := packet[0]
+	config := toc >> 3
+
+	var frameSamples int
+	switch {
+	case config < 12: // SILK: 10, 20, 40 or 60 ms
+		frameSamples = []int{480, 960, 1920, 2880}[config&3]
+	case config < 16: // Hybrid: 10 or 20 ms
+		frameSamples = []int{480, 960}[config&1]
+	default: // CELT: 2.5, 5, 10 or 20 ms
+		frameSamples = []int{120, 240, 480, 960}[config&3]
+	}
+
+	count := 1
+	switch toc & 3 {
+	case 1, 2:
+		count = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0, errInvalidAudio
+		}
+		count = int(packet[1] & 0x3F)
+	}
+
+	// Packets hold at most 120 ms of audio
+	samples := count * frameSamples
+	if count == 0 || samples > 5760 {
+		return 0, errInvalidAudio
+	}
+	return samples, nil
+}
+
+// adtsSampleRates are the sampling frequencies by ADTS index
+var adtsSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// parseADTS reads the frames of a raw AAC stream with ADTS headers. Every
+// raw data block of a frame holds 1024 samples.
+func parseADTS(data []byte) ([]audioFrame, time.Duration, error) {
+	var frames []audioFrame
+	var total uint64
+	sampleRate := 0
+
+	for len(data) > 0 {
+		// Sync word, MPEG-4 or MPEG-2 and layer 0
+		if len(data) < 7 || data[0] != 0xFF || data[1]&0xF6 != 0xF0 {
+			return nil, 0, errInvalidAudio
+		}
+		headerLen := 7
+		if data[1]&0x01 == 0 {
+			headerLen = 9 // followed by a CRC
+		}
+		rateIndex := int(data[2]>>2) & 0x0F
+		if rateIndex >= len(adtsSampleRates) {
+			return nil, 0, errInvalidAudio
+		}
+		rate := adtsSampleRates[rateIndex]
+		if sampleRate == 0 {
+			sampleRate = rate
+		} else if rate != sampleRate {
+			return nil, 0, errInvalidAudio
+		}
+		frameLen := int(data[3]&0x03)<<11 | int(data[4])<<3 | int(data[5]>>5)
+		if frameLen <= headerLen || frameLen > len(data) {
+			return nil, 0, errInvalidAudio
+		}
+		samples := (int(data[6]&0x03) + 1) * 1024
+
+		frames = append(frames, audioFrame{
+			duration: time.Duration(samples) * time.Second / time.Duration(rate),
+			size:     frameLen - headerLen,
+		})
+		total += uint64(samples)
+		data = data[frameLen:]
+	}
+	if sampleRate == 0 {
+		return nil, 0, errInvalidAudio
+	}
+
+	duration, err := samplesDuration(total, uint64(sampleRate))
+	return frames, duration, err
+}
+
+// mp4Box returns the type and payload of the box at the start of data, and
+// the data after it
+func mp4Box(data []byte) (string, []byte, []byte, error) {
+	if len(data) < 8 {
+		return "", nil, nil, errInvalidAudio
+	}
+	size := uint64(binary.BigEndian.Uint32(data))
+	kind := string(data[4:8])
+	headerLen := uint64(8)
+	switch size {
+	case 0: // extends to the end of the file
+		size = uint64(len(data))
+	case 1:
+		if len(data) < 16 {
+			return "", nil, nil, errInvalidAudio
+		}
+		size = binary.BigEndian.Uint64(data[8:16])
+		headerLen = 16
+	}
+	if size < headerLen || size > uint64(len(data)) {
+		return "", nil, nil, errInvalidAudio
+	}
+	return kind, data[headerLen:size], data[size:], nil
+}
+
+// mp4Children returns the payload of the first child box of each type
+func mp4Children(data []byte) (map[string][]byte, error) {
+	children := make(map[string][]byte)
+	for len(data) > 0 {
+		kind, payload, rest, err := mp4Box(data)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := children[kind]; !ok {
+			children[kind] = payload
+		}
+		data = rest
+	}
+	return children, nil
+}
+
+// parseM4A reads the samples of an MP4 file holding a single AAC track, as
+// recorded by phones. The sample table gives the size and duration of
+// every frame.
+func parseM4A(data []byte) ([]audioFrame, time.Duration, error) {
+	top, err := mp4Children(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if top["mdat"] == nil || top["moov"] == nil {
+		return nil, 0, errInvalidAudio
+	}
+
+	// The only track must be a sound track
+	var trak []byte
+	moov := top["moov"]
+	for len(moov) > 0 {
+		kind, payload, rest, err := mp4Box(moov)
+		if err != nil {
+			return nil, 0, err
+		}
+		if kind == "trak" {
+			if trak != nil {
+				return nil, 0, errInvalidAudio
+			}
+			trak = payload
+		}
+		moov = rest
+	}
+	if trak == nil {
+		return nil, 0, errInvalidAudio
+	}
+
+	path := func(box []byte, kinds ...string) ([]byte, error) {
+		for _, kind := range kinds {
+			children, err := mp4Children(box)
+			if err != nil {
+				return nil, err
+			}
+			if box = children[kind]; box == nil {
+				return nil, errInvalidAudio
+			}
+		}
+		return box, nil
+	}
+	hdlr, err := path(trak, "mdia", "hdlr")
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(hdlr) < 12 || string(hdlr[8:12]) != "soun" {
+		return nil, 0, errInvalidAudio
+	}
+
+	mdhd, err := path(trak, "mdia", "mdhd")
+	if err != nil {
+		return nil, 0, err
+	}
+	var timescale uint32
+	switch {
+	case len(mdhd) >= 20 && mdhd[0] == 0:
+		timescale = binary.BigEndian.Uint32(mdhd[12:16])
+	case len(mdhd) >= 32 && mdhd[0] == 1:
+		timescale = binary.BigEndian.Uint32(mdhd[20:24])
+	}
+	if timescale == 0 {
+		return nil, 0, errInvalidAudio
+	}
+
+	stbl, err := path(trak, "mdia", "minf", "stbl")
+	if err != nil {
+		return nil, 0, err
+	}
+	boxes, err := mp4Children(stbl)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The sample description must be AAC
+	stsd := boxes["stsd"]
+	if len(stsd) < 16 || binary.BigEndian.Uint32(stsd[4:8]) != 1 || string(stsd[12:16]) != "mp4a" {
+		return nil, 0, errInvalidAudio
+	}
+
+	stsz := boxes["stsz"]
+	if len(stsz) < 12 {
+		return nil, 0, errInvalidAudio
+	}
+	sampleSize := binary.BigEndian.Uint32(stsz[4:8])
+	count := uint64(binary.BigEndian.Uint32(stsz[8:12]))
+	// The count is checked before frames are allocated for it
+	if count == 0 || count > maxAACFrames || (sampleSize == 0 && uint64(len(stsz)-12) < count*4) ||
+		(sampleSize != 0 && count*uint64(sampleSize) > uint64(len(top["mdat"]))) {
+		return nil, 0, errInvalidAudio
+	}
+	frames := make([]audioFrame, count)
+	for i := range frames {
+		size := sampleSize
+		if size == 0 {
+			size = binary.BigEndian.Uint32(stsz[12+4*i:])
+		}
+		frames[i].size = int(size)
+	}
+
+	// Sample durations come in runs of equal deltas
+	stts := boxes["stts"]
+	if len(stts) < 8 {
+		return nil, 0, errInvalidAudio
+	}
+	entries := uint64(binary.BigEndian.Uint32(stts[4:8]))
+	if uint64(len(stts)-8) < entries*8 {
+		return nil, 0, errInvalidAudio
+	}
+	var sample, total uint64
+	for i := range entries {
+		run := uint64(binary.BigEndian.Uint32(stts[8+8*i:]))
+		delta := uint64(binary.BigEndian.Uint32(stts[12+8*i:]))
+		if run > count-sample {
+			return nil, 0, errInvalidAudio
+		}
+		frameDuration, err := samplesDuration(delta, uint64(timescale))
+		if err != nil {
+			return nil, 0, err
+		}
+		for range run {
+			frames[sample].duration = frameDuration
+			sample++
+		}
+		total += run * delta
+	}
+	if sample != count {
+		return nil, 0, errInvalidAudio
+	}
+
+	duration, err := samplesDuration(total, uint64(timescale))
+	return frames, duration, err
+}
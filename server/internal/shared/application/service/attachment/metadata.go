@@ -0,0 +1,312 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// errMalformed is returned for image files whose structure cannot be parsed
+var errMalformed = errors.New("malformed image file")
+
+// EXIF tags used while stripping location data
+const (
+	tagOrientation = 0x0112
+	tagXMP         = 0x02BC
+	tagGPSInfo     = 0x8825
+)
+
+// maxTIFFDirectories bounds the chain of TIFF directories that is followed,
+// which also stops at offsets pointing back
+const maxTIFFDirectories = 16
+
+// webpMetadataFlags are the EXIF and XMP bits of the WebP extended header
+const webpMetadataFlags = 0x08 | 0x04
+
+var (
+	exifHeader        = []byte("Exif\x00\x00")
+	xmpHeader         = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtendedHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	pngSignature      = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// heifBrands are the major brands of HEIF images, such as HEIC and AVIF
+var heifBrands = map[string]string{
+	"heic": "image/heic", "heix": "image/heic", "heim": "image/heic", "heis": "image/heic",
+	"mif1": "image/heif", "msf1": "image/heif",
+	"avif": "image/avif", "avis": "image/avif",
+}
+
+// sniffImage refines the content type of images that http.DetectContentType
+// does not recognize, so that their location data is not served unnoticed
+func sniffImage(head []byte, detected string) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return "image/tiff"
+	case len(head) >= 12 && string(head[4:8]) == "ftyp" && heifBrands[string(head[8:12])] != "":
+		return heifBrands[string(head[8:12])]
+	}
+	return detected
+}
+
+// stripJPEGLocation removes location data from a JPEG without re-encoding
+// it: the GPS directory of the EXIF data is emptied and XMP packets, which
+// can repeat it, are dropped. The rest of the EXIF data is kept. It also
+// returns the EXIF orientation, 1 when there is none.
+func stripJPEGLocation(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errMalformed
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	orientation := 1
+
+	pos := 2
+	for pos < len(data) {
+		if data[pos] != 0xFF || pos+1 >= len(data) {
+			return nil, 0, errMalformed
+		}
+		marker := data[pos+1]
+
+		// Fill bytes and markers without a length
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out = append(out, data[pos:pos+2]...)
+			pos += 2
+			continue
+		}
+		// End of image, or start of scan after which the entropy-coded
+		// data follows; either way the rest is copied as is
+		if marker == 0xD9 || marker == 0xDA {
+			return append(out, data[pos:]...), orientation, nil
+		}
+
+		if pos+4 > len(data) {
+			return nil, 0, errMalformed
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, 0, errMalformed
+		}
+		segment := data[pos:end]
+		payload := segment[4:]
+
+		if marker == 0xE1 {
+			switch {
+			case bytes.HasPrefix(payload, exifHeader):
+				// Work on a copy, the input stays untouched
+				segment = append([]byte(nil), segment...)
+				orientation = stripTIFFLocation(segment[4+len(exifHeader):])
+			case bytes.HasPrefix(payload, xmpHeader), bytes.HasPrefix(payload, xmpExtendedHeader):
+				pos = end
+				continue
+			}
+		}
+
+		out = append(out, segment...)
+		pos = end
+	}
+
+	return out, orientation, nil
+}
+
+// tiffTypeSizes are the byte sizes of the TIFF field types
+var tiffTypeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// stripTIFFLocation empties the GPS directories and clears the XMP packets
+// of EXIF data in place and returns the orientation of the first image.
+// Malformed data is left as it is.
+func stripTIFFLocation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	orientation := 1
+	ifd := order.Uint32(tiff[4:8])
+	// Multi-page TIFF images have a directory per page
+	for n := 0; ifd != 0 && n < maxTIFFDirectories; n++ {
+		entries, ok := tiffEntries(tiff, ifd, order)
+		if !ok {
+			break
+		}
+
+		for i := 0; i < entries; i++ {
+			entry := tiff[ifd+2+uint32(i)*12:]
+			switch order.Uint16(entry[0:2]) {
+			case tagOrientation:
+				if value := int(order.Uint16(entry[8:10])); n == 0 && value >= 1 && value <= 8 {
+					orientation = value
+				}
+			case tagGPSInfo:
+				clearTIFFDirectory(tiff, order.Uint32(entry[8:12]), order)
+			case tagXMP:
+				clearTIFFValue(tiff, entry, order)
+			}
+		}
+
+		ifd = order.Uint32(tiff[ifd+2+uint32(entries)*12:])
+	}
+
+	return orientation
+}
+
+// tiffEntries returns the entry count of the directory at offset, if the
+// whole directory lies within the data
+func tiffEntries(tiff []byte, offset uint32, order binary.ByteOrder) (int, bool) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 0, false
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	if uint64(offset)+2+uint64(entries)*12+4 > uint64(len(tiff)) {
+		return 0, false
+	}
+	return entries, true
+}
+
+// clearTIFFDirectory zeroes the values of a directory and leaves it
+// without entries
+func clearTIFFDirectory(tiff []byte, offset uint32, order binary.ByteOrder) {
+	entries, ok := tiffEntries(tiff, offset, order)
+	if !ok {
+		return
+	}
+
+	for i := 0; i < entries; i++ {
+		clearTIFFValue(tiff, tiff[offset+2+uint32(i)*12:], order)
+	}
+
+	end := uint64(offset) + 2 + uint64(entries)*12 + 4
+	clear(tiff[offset:end])
+}
+
+// clearTIFFValue zeroes the value of a directory entry, keeping the entry
+func clearTIFFValue(tiff []byte, entry []byte, order binary.ByteOrder) {
+	size := uint64(tiffTypeSizes[order.Uint16(entry[2:4])]) * uint64(order.Uint32(entry[4:8]))
+	// Values over 4 bytes are stored elsewhere
+	if size <= 4 {
+		clear(entry[8:12])
+		return
+	}
+	start := uint64(order.Uint32(entry[8:12]))
+	if start+size <= uint64(len(tiff)) {
+		clear(tiff[start : start+size])
+	}
+}
+
+// stripTIFFImageLocation removes location data from a TIFF image the way
+// stripTIFFLocation does for EXIF data, on a copy of it
+func stripTIFFImageLocation(data []byte) ([]byte, error) {
+	if len(data) < 8 || (string(data[:4]) != "II*\x00" && string(data[:4]) != "MM\x00*") {
+		return nil, errMalformed
+	}
+
+	out := append([]byte(nil), data...)
+	stripTIFFLocation(out)
+	return out, nil
+}
+
+// stripPNGLocation removes the chunks of a PNG that can hold location data:
+// EXIF data and XMP packets stored as text
+func stripPNGLocation(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errMalformed
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errMalformed
+		}
+		length := uint64(binary.BigEndian.Uint32(data[pos : pos+4]))
+		end := uint64(pos) + 12 + length
+		if end > uint64(len(data)) {
+			return nil, errMalformed
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		body := data[pos+8 : uint64(pos)+8+length]
+
+		drop := chunkType == "eXIf" ||
+			((chunkType == "iTXt" || chunkType == "tEXt" || chunkType == "zTXt") &&
+				bytes.HasPrefix(body, []byte("XML:com.adobe.xmp\x00")))
+		if !drop {
+			out = append(out, data[pos:end]...)
+		}
+
+		pos = int(end)
+		if chunkType == "IEND" {
+			break
+		}
+	}
+
+	return out, nil
+}
+
+// stripWebPLocation removes the chunks of a WebP that can hold location
+// data, EXIF data and XMP packets, and clears their flags in the extended
+// header
+func stripWebPLocation(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errMalformed
+	}
+	// Anything after the RIFF file is dropped
+	if size := uint64(binary.LittleEndian.Uint32(data[4:8])) + 8; size < uint64(len(data)) {
+		data = data[:size]
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errMalformed
+		}
+		length := uint64(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		// Chunks are padded to an even size, which some encoders leave
+		// out of the last one
+		end := uint64(pos) + 8 + length + length%2
+		if end == uint64(len(data))+1 && length%2 == 1 {
+			end--
+		}
+		if end > uint64(len(data)) {
+			return nil, errMalformed
+		}
+		chunk := data[pos:end]
+
+		switch string(chunk[:4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk = append([]byte(nil), chunk...)
+			if len(chunk) > 8 {
+				chunk[8] &^= webpMetadataFlags
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, chunk...)
+		}
+
+		pos = int(end)
+	}
+
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
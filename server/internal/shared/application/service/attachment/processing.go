@@ -0,0 +1,368 @@
+package attachment
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/quota"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	_ "image/png" // registers the PNG decoder
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Processing states of images and videos
+const (
+	ProcessingPending     = "pending"
+	ProcessingRunning     = "processing"
+	ProcessingReady       = "ready"
+	ProcessingFailed      = "failed"
+	ProcessingUnsupported = "unsupported"
+)
+
+const (
+	// thumbnailSide bounds the width and height of thumbnails
+	thumbnailSide = 320
+	// blurhashSide bounds the image a blurhash is computed from
+	blurhashSide = 32
+	// maxProcessBytes and maxProcessPixels bound the images that are
+	// processed, as they are decoded in memory
+	maxProcessBytes  = 64 << 20
+	maxProcessPixels = 40_000_000
+	// staleProcessing is when an attachment left processing by a stopped
+	// server is picked up again
+	staleProcessing = 10 * time.Minute
+	// processingPollInterval is how often workers look for attachments
+	// queued by other server instances
+	processingPollInterval = 30 * time.Second
+)
+
+// strippable are the image types whose location data can be stripped
+var strippable = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/tiff": true,
+}
+
+// processingStatus returns the initial processing state of a file: images
+// whose location data can be stripped are processed, other images and
+// videos are not supported and other files are not processed at all
+func processingStatus(contentType string) *string {
+	var status string
+	switch {
+	case strippable[contentType]:
+		status = ProcessingPending
+	case strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/"):
+		status = ProcessingUnsupported
+	default:
+		return nil
+	}
+	return &status
+}
+
+// processedImage is the outcome of processing an image. Images the
+// standard library cannot decode get no preview: no dimensions, blurhash
+// or thumbnail.
+type processedImage struct {
+	content   []byte // the image without location data, nil when unchanged
+	width     int
+	height    int
+	blurhash  string
+	thumbnail []byte // nil without a preview
+}
+
+// processImage strips location data from an image and renders its
+// thumbnail and blurhash. Dimensions are those of the image as displayed,
+// after applying its EXIF orientation.
+func processImage(original []byte, contentType string) (*processedImage, error) {
+	content := original
+	orientation := 1
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		content, orientation, err = stripJPEGLocation(original)
+	case "image/png":
+		content, err = stripPNGLocation(original)
+	case "image/webp":
+		content, err = stripWebPLocation(original)
+	case "image/tiff":
+		content, err = stripTIFFImageLocation(original)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &processedImage{}
+	if !bytes.Equal(content, original) {
+		result.content = content
+	}
+
+	// The image is safe to share once stripped, with or without a preview
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil || config.Width*config.Height > maxProcessPixels {
+		return result, nil
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return result, nil
+	}
+	full := toRGBA(decoded)
+
+	width, height := fitWithin(config.Width, config.Height, thumbnailSide)
+	thumbnail := orient(resize(full, width, height), orientation)
+
+	result.width, result.height = config.Width, config.Height
+	if orientation >= 5 {
+		result.width, result.height = config.Height, config.Width
+	}
+
+	width, height = fitWithin(thumbnail.Bounds().Dx(), thumbnail.Bounds().Dy(), blurhashSide)
+	xComponents, yComponents := 4, 3
+	if height > width {
+		xComponents, yComponents = 3, 4
+	}
+	result.blurhash = encodeBlurhash(resize(thumbnail, width, height), xComponents, yComponents)
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, thumbnail, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	result.thumbnail = encoded.Bytes()
+
+	return result, nil
+}
+
+// wakeProcessing tells a worker that an attachment was queued
+func (s *AttachmentService) wakeProcessing() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// StartProcessingWorkers starts workers that process queued images. Workers
+// of all server instances share the queue.
+func (s *AttachmentService) StartProcessingWorkers(workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			ticker := time.NewTicker(processingPollInterval)
+			defer ticker.Stop()
+
+			for {
+				for {
+					processed, err := s.processNext()
+					if err != nil {
+						log.Printf("Attachment processing failed: %v", err)
+						break
+					}
+					if !processed {
+						break
+					}
+				}
+
+				select {
+				case <-s.wake:
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+}
+
+// queuedAttachment is an attachment claimed for processing
+type queuedAttachment struct {
+	id          string
+	tenantID    string
+	contentType string
+	size        int64
+	key         string
+}
+
+// processNext processes the oldest queued attachment and reports whether
+// there was one
+func (s *AttachmentService) processNext() (bool, error) {
+	ctx := db.SystemContext(context.Background())
+
+	var queued queuedAttachment
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `
+			UPDATE attachments SET processing_status = $1, processing_started_at = NOW()
+			WHERE id = (
+				SELECT id FROM attachments
+				WHERE processing_status = $2
+				OR (processing_status = $1 AND processing_started_at < NOW() - make_interval(secs => $3))
+				ORDER BY created_at
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, tenant_id, content_type, size, storage_key
+		`, ProcessingRunning, ProcessingPending, staleProcessing.Seconds()).Scan(
+			&queued.id, &queued.tenantID, &queued.contentType, &queued.size, &queued.key)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	tenantCtx := db.ContextWithTenant(context.Background(), queued.tenantID)
+	if err := s.process(tenantCtx, queued); err != nil {
+		log.Printf("Failed to process attachment %s: %v", queued.id, err)
+		err = s.finish(tenantCtx, func(tx pgx.Tx) (*db.Attachment, error) {
+			var a db.Attachment
+			err := Scan(tx.QueryRow(tenantCtx, `
+				UPDATE attachments a SET processing_status = $2, processed_at = NOW()
+				WHERE a.id = $1
+				RETURNING `+Columns, queued.id, ProcessingFailed), &a)
+			return &a, err
+		})
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// process processes one attachment and stores the results
+func (s *AttachmentService) process(ctx context.Context, queued queuedAttachment) (err error) {
+	if queued.size > maxProcessBytes {
+		return fmt.Errorf("file of %d bytes is too large to process", queued.size)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while processing: %v", r)
+		}
+	}()
+
+	content, err := s.blobStore.Get(ctx, queued.key)
+	if err != nil {
+		return err
+	}
+	original, err := io.ReadAll(io.LimitReader(content, maxProcessBytes+1))
+	content.Close()
+	if err != nil {
+		return err
+	}
+
+	result, err := processImage(original, queued.contentType)
+	if err != nil {
+		return err
+	}
+
+	// Replacing the content keeps its key, so existing URLs stay valid. The
+	// new size is recorded right away, whatever happens next.
+	if result.content != nil {
+		size := int64(len(result.content))
+		if err := s.blobStore.Put(ctx, queued.key, bytes.NewReader(result.content), size, queued.contentType); err != nil {
+			return err
+		}
+		err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+			tag, err := tx.Exec(ctx, "UPDATE attachments SET size = $2 WHERE id = $1", queued.id, size)
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() == 0 || s.quotaService == nil {
+				return nil
+			}
+			return s.quotaService.Consume(ctx, tx, queued.tenantID, quota.MetricStorage, size-queued.size)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if result.thumbnail == nil {
+		return s.finish(ctx, func(tx pgx.Tx) (*db.Attachment, error) {
+			var a db.Attachment
+			err := Scan(tx.QueryRow(ctx, `
+				UPDATE attachments a SET processing_status = $2, processed_at = NOW()
+				WHERE a.id = $1
+				RETURNING `+Columns, queued.id, ProcessingReady), &a)
+			return &a, err
+		})
+	}
+
+	thumbnailKey := "thumbnails/" + queued.tenantID + "/" + queued.id
+	thumbnailSize := int64(len(result.thumbnail))
+	if err := s.blobStore.Put(ctx, thumbnailKey, bytes.NewReader(result.thumbnail), thumbnailSize, "image/jpeg"); err != nil {
+		return err
+	}
+
+	err = s.finish(ctx, func(tx pgx.Tx) (*db.Attachment, error) {
+		var a db.Attachment
+		err := Scan(tx.QueryRow(ctx, `
+			UPDATE attachments a
+			SET processing_status = $2, processed_at = NOW(), width = $3, height = $4, blurhash = $5,
+				thumbnail_key = $6, thumbnail_size = $7
+			WHERE a.id = $1
+			RETURNING `+Columns, queued.id, ProcessingReady, result.width, result.height, result.blurhash,
+			thumbnailKey, thumbnailSize), &a)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Deleted while processing
+			s.deleteBlob(thumbnailKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if s.quotaService != nil {
+			err = s.quotaService.Consume(ctx, tx, queued.tenantID, quota.MetricStorage, thumbnailSize)
+		}
+		return &a, err
+	})
+	if err != nil {
+		s.deleteBlob(thumbnailKey)
+	}
+	return err
+}
+
+// finish records the outcome of processing with update and tells the room
+// of the attachment's message, or its uploader while it is not sent yet.
+// Attachments deleted in the meantime are skipped.
+func (s *AttachmentService) finish(ctx context.Context, update func(tx pgx.Tx) (*db.Attachment, error)) error {
+	var attachment *db.Attachment
+	var roomID string
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		attachment, err = update(tx)
+		if err != nil {
+			return err
+		}
+		if attachment.MessageID != nil {
+			return tx.QueryRow(ctx, "SELECT room_id FROM messages WHERE id = $1", *attachment.MessageID).Scan(&roomID)
+		}
+		return nil
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.wsService == nil {
+		return nil
+	}
+	if roomID != "" {
+		s.wsService.BroadcastToRoom(roomID, "attachment_processed", map[string]interface{}{
+			"room_id":    roomID,
+			"message_id": attachment.MessageID,
+			"attachment": attachment,
+		}, "")
+	} else {
+		s.wsService.SendToUser(attachment.UserID, "attachment_processed", map[string]interface{}{
+			"attachment": attachment,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package attachment
+
+import (
+	"ChitChat/internal/shared/application/service/auth"
+	"ChitChat/internal/shared/application/service/db"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// URLTTL is how long signed download URLs stay valid
+const URLTTL = time.Hour
+
+// ErrInvalidSignature is returned for download URLs that were tampered with
+// or have expired
+var ErrInvalidSignature = errors.New("invalid or expired download URL")
+
+// urlSecret returns the key download URLs are signed with
+func urlSecret() []byte {
+	if secret := os.Getenv("ATTACHMENT_URL_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return auth.JWTSecret()
+}
+
+// signature binds a download URL to the attachment, the user it was issued
+// to and its expiry
+func signature(tenantID, attachmentID, userID string, expires int64) string {
+	mac := hmac.New(sha256.New, urlSecret())
+	mac.Write([]byte(tenantID + "|" + attachmentID + "|" + userID + "|" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign sets the download URLs of an attachment for one user, relative to
+// the API. The URLs work without an Authorization header, so they can be
+// used directly as the source of an image, but the user must still be
+// allowed to see the attachment when downloading.
+func Sign(tenantID, userID string, attachment *db.Attachment) {
+	query, expiresAt := signedQuery(tenantID, attachment.ID, userID)
+	path := "/chat/files/" + url.PathEscape(attachment.ID)
+
+	attachment.URL = path + "?" + query
+	if attachment.HasThumbnail {
+		attachment.ThumbnailURL = path + "/thumbnail?" + query
+	}
+	attachment.URLExpiresAt = &expiresAt
+}
+
+// signedQuery returns the query string of a signed download URL, which is
+// the same for an attachment and its thumbnail
+func signedQuery(tenantID, attachmentID, userID string) (string, time.Time) {
+	expiresAt := time.Now().Add(URLTTL).Truncate(time.Second)
+	expires := expiresAt.Unix()
+
+	query := url.Values{}
+	query.Set("tenant", tenantID)
+	query.Set("user", userID)
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", signature(tenantID, attachmentID, userID, expires))
+
+	return query.Encode(), expiresAt
+}
+
+// VerifyURL checks the query parameters of a signed download URL and
+// returns the tenant and user it was issued to
+func VerifyURL(attachmentID string, query url.Values) (string, string, error) {
+	tenantID := query.Get("tenant")
+	userID := query.Get("user")
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || tenantID == "" || userID == "" {
+		return "", "", ErrInvalidSignature
+	}
+	if time.Now().Unix() > expires {
+		return "", "", ErrInvalidSignature
+	}
+
+	expected := signature(tenantID, attachmentID, userID, expires)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return "", "", ErrInvalidSignature
+	}
+	return tenantID, userID, nil
+}
@@ -2,20 +2,17 @@ package auth
 
 import (
 	"errors"
-	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtSecret = []byte("supersecretkey")
-
-func RegisterUser(username, password string) (string, error) {
+func RegisterUser(username, password, tenantID, role string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return "", err
 	}
-	user, err := CreateUser(username, string(hash))
+	user, err := CreateUser(username, string(hash), tenantID, role)
 	if err != nil {
 		if err.Error() == "ERROR: duplicate key value violates unique constraint \"users_email_key\" (SQLSTATE 23505)" {
 			return "", errors.New("user already exists")
@@ -44,30 +41,28 @@ func Authenticate(username, password string) (string, error) {
 		return "", errors.New("user not found")
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": username,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
+	tokenString, err := GenerateToken(jwt.MapClaims{
+		"user_id":   user.ID,
+		"tenant_id": user.TenantID,
+		"username":  username,
 	})
-	tokenString, err := token.SignedString(jwtSecret)
 	if err != nil {
 		return "", err
 	}
 	return tokenString, nil
 }
 
-func Signup(username, password string) (string, error) {
-	userID, err := RegisterUser(username, password)
+func Signup(username, password, tenantID, role string) (string, error) {
+	userID, err := RegisterUser(username, password, tenantID, role)
 	if err != nil {
 		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  userID,
-		"username": username,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
+	tokenString, err := GenerateToken(jwt.MapClaims{
+		"user_id":   userID,
+		"tenant_id": tenantID,
+		"username":  username,
 	})
-	tokenString, err := token.SignedString(jwtSecret)
 	if err != nil {
 		return "", err
 	}
@@ -81,7 +76,7 @@ func ValidateToken(tokenString string) (jwt.MapClaims, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
-		return jwtSecret, nil
+		return JWTSecret(), nil
 	})
 
 	if err != nil {
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// EmailService interface for sending plain text emails
+type EmailService interface {
+	SendEmail(to, subject, body string) error
+}
+
+// ConsoleEmailService is a development implementation that prints emails to console
+type ConsoleEmailService struct{}
+
+func NewConsoleEmailService() *ConsoleEmailService {
+	return &ConsoleEmailService{}
+}
+
+func (s *ConsoleEmailService) SendEmail(to, subject, body string) error {
+	fmt.Printf("Email to %s: %s\n%s\n", to, subject, body)
+	return nil
+}
+
+// SMTPEmailService sends emails through an SMTP relay
+type SMTPEmailService struct {
+	addr     string
+	username string
+	password string
+	host     string
+	from     string
+}
+
+func NewSMTPEmailService() *SMTPEmailService {
+	host := os.Getenv("SMTP_HOST")
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	return &SMTPEmailService{
+		addr:     host + ":" + port,
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		host:     host,
+		from:     os.Getenv("SMTP_FROM"),
+	}
+}
+
+func (s *SMTPEmailService) SendEmail(to, subject, body string) error {
+	// Header values must not contain line breaks
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+
+	msg := "From: " + s.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body
+
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	return smtp.SendMail(s.addr, auth, s.from, []string{to}, []byte(msg))
+}
+
+// GetEmailService returns the appropriate email service based on environment
+func GetEmailService() EmailService {
+	// Check if an SMTP relay is configured
+	if os.Getenv("SMTP_HOST") != "" && os.Getenv("SMTP_FROM") != "" {
+		return NewSMTPEmailService()
+	}
+
+	// Default to console service for development
+	return NewConsoleEmailService()
+}
@@ -2,12 +2,13 @@ package auth
 
 import (
 	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/quota"
 	"context"
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"log"
 	"math/big"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -15,14 +16,16 @@ import (
 )
 
 type PhoneAuthService struct {
-	db         *pgxpool.Pool
-	smsService SMSService
+	db           *pgxpool.Pool
+	smsService   SMSService
+	quotaService *quota.QuotaService
 }
 
-func NewPhoneAuthService(database *pgxpool.Pool) *PhoneAuthService {
+func NewPhoneAuthService(database *pgxpool.Pool, quotaService *quota.QuotaService) *PhoneAuthService {
 	return &PhoneAuthService{
-		db:         database,
-		smsService: GetSMSService(),
+		db:           database,
+		smsService:   GetSMSService(),
+		quotaService: quotaService,
 	}
 }
 
@@ -39,8 +42,11 @@ func (s *PhoneAuthService) generateVerificationCode() (string, error) {
 	return code, nil
 }
 
-// SendVerificationCode sends a verification code to the phone number
-func (s *PhoneAuthService) SendVerificationCode(phoneNumber string) error {
+// SendVerificationCode sends a verification code to the phone number. The
+// SMS counts towards the quota of tenantID and uses the tenant's senderID,
+// empty for the default sender. The code is only stored once the quota
+// allows the SMS.
+func (s *PhoneAuthService) SendVerificationCode(phoneNumber, tenantID, senderID string) error {
 	ctx := context.Background()
 
 	// Generate a 6-digit verification code
@@ -49,6 +55,12 @@ func (s *PhoneAuthService) SendVerificationCode(phoneNumber string) error {
 		return err
 	}
 
+	if s.quotaService != nil {
+		if err := s.quotaService.Consume(ctx, s.db, tenantID, quota.MetricSMS, 1); err != nil {
+			return err
+		}
+	}
+
 	// Set expiration time (10 minutes from now)
 	expiresAt := time.Now().Add(10 * time.Minute)
 
@@ -58,19 +70,37 @@ func (s *PhoneAuthService) SendVerificationCode(phoneNumber string) error {
 		VALUES ($1, $2, $3)
 	`, phoneNumber, code, expiresAt)
 	if err != nil {
+		if s.quotaService != nil {
+			s.quotaService.Consume(ctx, s.db, tenantID, quota.MetricSMS, -1)
+		}
 		return err
 	}
 
 	// Send SMS with verification code
 	message := fmt.Sprintf("Your ChitChat verification code is: %s", code)
-	err = s.smsService.SendSMS(phoneNumber, message)
+	err = s.smsService.SendSMS(phoneNumber, message, senderID)
 	if err != nil {
+		s.recordOTPEvent(ctx, phoneNumber, "send_failed")
+		if s.quotaService != nil {
+			s.quotaService.Consume(ctx, s.db, tenantID, quota.MetricSMS, -1)
+		}
 		return fmt.Errorf("failed to send SMS: %v", err)
 	}
 
+	s.recordOTPEvent(ctx, phoneNumber, "sent")
 	return nil
 }
 
+// recordOTPEvent logs an OTP send or failure for system statistics
+func (s *PhoneAuthService) recordOTPEvent(ctx context.Context, phoneNumber, event string) {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO otp_events (phone_number, event) VALUES ($1, $2)
+	`, phoneNumber, event)
+	if err != nil {
+		log.Printf("Failed to record OTP event: %v", err)
+	}
+}
+
 // VerifyCode verifies the provided code for a phone number
 func (s *PhoneAuthService) VerifyCode(phoneNumber, code string) (bool, error) {
 	ctx := context.Background()
@@ -85,16 +115,19 @@ func (s *PhoneAuthService) VerifyCode(phoneNumber, code string) (bool, error) {
 	`, phoneNumber, code).Scan(&verificationCode.ID, &verificationCode.PhoneNumber, &verificationCode.Code, &verificationCode.ExpiresAt, &verificationCode.Used)
 
 	if err != nil {
+		s.recordOTPEvent(ctx, phoneNumber, "verify_failed")
 		return false, errors.New("invalid verification code")
 	}
 
 	// Check if code is expired
 	if time.Now().After(verificationCode.ExpiresAt) {
+		s.recordOTPEvent(ctx, phoneNumber, "verify_failed")
 		return false, errors.New("verification code expired")
 	}
 
 	// Check if code is already used
 	if verificationCode.Used {
+		s.recordOTPEvent(ctx, phoneNumber, "verify_failed")
 		return false, errors.New("verification code already used")
 	}
 
@@ -111,8 +144,8 @@ func (s *PhoneAuthService) VerifyCode(phoneNumber, code string) (bool, error) {
 	return true, nil
 }
 
-// CreateUserWithPhone creates a new user with phone number
-func (s *PhoneAuthService) CreateUserWithPhone(phoneNumber, name string) (*db.User, error) {
+// CreateUserWithPhone creates a new user with phone number in the given tenant
+func (s *PhoneAuthService) CreateUserWithPhone(phoneNumber, name, tenantID, role string) (*db.User, error) {
 	ctx := context.Background()
 
 	// Check if user already exists with this phone number
@@ -126,20 +159,13 @@ func (s *PhoneAuthService) CreateUserWithPhone(phoneNumber, name string) (*db.Us
 		return nil, errors.New("user with this phone number already exists")
 	}
 
-	// Get default tenant ID
-	var tenantID string
-	err = s.db.QueryRow(ctx, "SELECT id FROM tenants LIMIT 1").Scan(&tenantID)
-	if err != nil {
-		return nil, err
-	}
-
 	// Create new user
 	var user db.User
 	err = s.db.QueryRow(ctx, `
 		INSERT INTO users (id, tenant_id, phone_number, name, role, phone_verified)
-		VALUES (gen_random_uuid(), $1, $2, $3, 'user', true)
+		VALUES (gen_random_uuid(), $1, $2, $3, $4, true)
 		RETURNING id, tenant_id, phone_number, name, role, phone_verified, created_at
-	`, tenantID, phoneNumber, name).Scan(&user.ID, &user.TenantID, &user.PhoneNumber, &user.Name, &user.Role, &user.PhoneVerified, &user.CreatedAt)
+	`, tenantID, phoneNumber, name, role).Scan(&user.ID, &user.TenantID, &user.PhoneNumber, &user.Name, &user.Role, &user.PhoneVerified, &user.CreatedAt)
 
 	if err != nil {
 		return nil, err
@@ -177,18 +203,11 @@ func (s *PhoneAuthService) AuthenticateWithPhone(phoneNumber string) (string, er
 	}
 
 	// Generate JWT token
-	jwtSecret := []byte(os.Getenv("JWT_SECRET"))
-	if len(jwtSecret) == 0 {
-		jwtSecret = []byte("supersecretkey")
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	tokenString, err := GenerateToken(jwt.MapClaims{
 		"user_id":      user.ID,
+		"tenant_id":    user.TenantID,
 		"phone_number": phoneNumber,
-		"exp":          time.Now().Add(time.Hour * 72).Unix(),
 	})
-
-	tokenString, err := token.SignedString(jwtSecret)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"context"
+	"errors"
+)
+
+// Roles a user can hold. Owners and admins manage their own tenant, while
+// superadmins operate the platform across all tenants.
+const (
+	RoleUser       = "user"
+	RoleAdmin      = "admin"
+	RoleOwner      = "owner"
+	RoleSuperAdmin = "superadmin"
+)
+
+var (
+	ErrAccountNotFound  = errors.New("account not found")
+	ErrAccountSuspended = errors.New("account suspended")
+	ErrAccountDeleted   = errors.New("account pending deletion")
+	ErrTenantSuspended  = errors.New("tenant suspended")
+	ErrSessionRevoked   = errors.New("session revoked")
+)
+
+// Session is the account state behind an authenticated token
+type Session struct {
+	UserID   string
+	TenantID string
+	Role     string
+}
+
+// LoadSession checks that the account behind a token may still use the API
+// and returns its current tenant and role. tokenTenantID and issuedAt are the
+// token's tenant_id and iat claims; tokens issued before tenant_id was added
+// carry no tenant and are not checked against it. Accounts pending deletion
+// are only let through with allowDeleted, so that they can be restored.
+func LoadSession(userID, tokenTenantID string, issuedAt int64, allowDeleted bool) (*Session, error) {
+	ctx := context.Background()
+
+	session := Session{UserID: userID}
+	var suspended, tenantSuspended, purged, deleted, revoked bool
+	err := db.GetDB().QueryRow(ctx, `
+		SELECT u.tenant_id, u.role,
+			u.suspended_at IS NOT NULL,
+			t.status <> 'active',
+			u.purged_at IS NOT NULL,
+			u.deleted_at IS NOT NULL,
+			COALESCE(u.tokens_valid_after > to_timestamp($2)::timestamp, false)
+		FROM users u
+		JOIN tenants t ON t.id = u.tenant_id
+		WHERE u.id = $1
+	`, userID, issuedAt).Scan(&session.TenantID, &session.Role, &suspended, &tenantSuspended, &purged, &deleted, &revoked)
+	if err != nil || purged {
+		return nil, ErrAccountNotFound
+	}
+	if deleted && !allowDeleted {
+		return nil, ErrAccountDeleted
+	}
+	if suspended {
+		return nil, ErrAccountSuspended
+	}
+	if tenantSuspended {
+		return nil, ErrTenantSuspended
+	}
+	if revoked || (tokenTenantID != "" && tokenTenantID != session.TenantID) {
+		return nil, ErrSessionRevoked
+	}
+
+	return &session, nil
+}
+
+// TenantID extracts the tenant_id claim of a token, or "" when it is missing
+func TenantID(claims map[string]interface{}) string {
+	tenantID, _ := claims["tenant_id"].(string)
+	return tenantID
+}
+
+// IssuedAt extracts the iat claim of a token, or 0 when it is missing
+func IssuedAt(claims map[string]interface{}) int64 {
+	if iat, ok := claims["iat"].(float64); ok {
+		return int64(iat)
+	}
+	return 0
+}
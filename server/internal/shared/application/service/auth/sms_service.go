@@ -5,9 +5,10 @@ import (
 	"os"
 )
 
-// SMSService interface for sending SMS messages
+// SMSService interface for sending SMS messages. An empty senderID uses the
+// provider's default sender.
 type SMSService interface {
-	SendSMS(to, message string) error
+	SendSMS(to, message, senderID string) error
 }
 
 // ConsoleSMSService is a development implementation that prints SMS to console
@@ -17,7 +18,11 @@ func NewConsoleSMSService() *ConsoleSMSService {
 	return &ConsoleSMSService{}
 }
 
-func (s *ConsoleSMSService) SendSMS(to, message string) error {
+func (s *ConsoleSMSService) SendSMS(to, message, senderID string) error {
+	if senderID != "" {
+		fmt.Printf("SMS from %s to %s: %s\n", senderID, to, message)
+		return nil
+	}
 	fmt.Printf("SMS to %s: %s\n", to, message)
 	return nil
 }
@@ -37,7 +42,7 @@ func NewTwilioSMSService() *TwilioSMSService {
 	}
 }
 
-func (s *TwilioSMSService) SendSMS(to, message string) error {
+func (s *TwilioSMSService) SendSMS(to, message, senderID string) error {
 	// TODO: Implement Twilio SMS sending
 	// This would require adding the Twilio Go SDK to go.mod
 	// Example implementation:
@@ -47,7 +52,11 @@ func (s *TwilioSMSService) SendSMS(to, message string) error {
 	// })
 	// params := &twilio.CreateMessageParams{}
 	// params.SetTo(to)
-	// params.SetFrom(s.fromNumber)
+	// from := s.fromNumber
+	// if senderID != "" {
+	//     from = senderID // alphanumeric sender ID
+	// }
+	// params.SetFrom(from)
 	// params.SetBody(message)
 	// _, err := client.Api.CreateMessage(params)
 	// return err
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// JWTSecret returns the key used to sign and verify JWT tokens
+func JWTSecret() []byte {
+	secret := []byte(os.Getenv("JWT_SECRET"))
+	if len(secret) == 0 {
+		secret = []byte("supersecretkey")
+	}
+	return secret
+}
+
+// GenerateToken signs a JWT token with the given claims. The issue time is
+// always set so sessions can be revoked, and tokens expire after 72 hours
+// unless the claims say otherwise.
+func GenerateToken(claims jwt.MapClaims) (string, error) {
+	now := time.Now()
+	claims["iat"] = now.Unix()
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = now.Add(time.Hour * 72).Unix()
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(JWTSecret())
+}
@@ -6,13 +6,13 @@ import (
 	"errors"
 )
 
-func CreateUser(email, passwordHash string) (*db.User, error) {
+func CreateUser(email, passwordHash, tenantID, role string) (*db.User, error) {
 	row := db.GetDB().QueryRow(context.Background(),
-		`INSERT INTO users (id, email, role, password_hash, tenant_id) VALUES (gen_random_uuid(), $1, 'user', $2, (SELECT id FROM tenants LIMIT 1)) RETURNING id, email, password_hash`,
-		email, passwordHash,
+		`INSERT INTO users (id, email, role, password_hash, tenant_id) VALUES (gen_random_uuid(), $1, $3, $2, $4) RETURNING id, tenant_id, email, role, password_hash`,
+		email, passwordHash, role, tenantID,
 	)
 	var user db.User
-	if err := row.Scan(&user.ID, &user.Email, &user.PasswordHash); err != nil {
+	if err := row.Scan(&user.ID, &user.TenantID, &user.Email, &user.Role, &user.PasswordHash); err != nil {
 		return nil, err
 	}
 	return &user, nil
@@ -20,11 +20,11 @@ func CreateUser(email, passwordHash string) (*db.User, error) {
 
 func FindUserByEmail(username string) (*db.User, error) {
 	row := db.GetDB().QueryRow(context.Background(),
-		`SELECT id, email, password_hash FROM users WHERE email=$1`,
+		`SELECT id, tenant_id, email, role, password_hash, phone_number, phone_verified FROM users WHERE email=$1`,
 		username,
 	)
 	var user db.User
-	if err := row.Scan(&user.ID, &user.Email, &user.PasswordHash); err != nil {
+	if err := row.Scan(&user.ID, &user.TenantID, &user.Email, &user.Role, &user.PasswordHash, &user.PhoneNumber, &user.PhoneVerified); err != nil {
 		return nil, errors.New("user not found")
 	}
 	return &user, nil
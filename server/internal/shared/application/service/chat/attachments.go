@@ -0,0 +1,116 @@
+package chat
+
+import (
+	"ChitChat/internal/shared/application/service/attachment"
+	"ChitChat/internal/shared/application/service/db"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidAttachment is returned when a message references uploads that
+// are not the sender's own unsent uploads
+var ErrInvalidAttachment = errors.New("attachments must be unsent uploads of the sender")
+
+// ErrEmptyMessage is returned for messages with neither content nor
+// attachments
+var ErrEmptyMessage = errors.New("message needs content or attachments")
+
+// linkAttachments attaches the message's uploads to it. Each upload can
+// only be sent once, by its uploader.
+func linkAttachments(ctx context.Context, tx pgx.Tx, message *db.Message) error {
+	ids := make(map[string]bool, len(message.AttachmentIDs))
+	for _, id := range message.AttachmentIDs {
+		ids[id] = true
+	}
+
+	rows, err := tx.Query(ctx, `
+		UPDATE attachments a SET message_id = $1, attached_at = NOW()
+		WHERE a.id = ANY($2) AND a.user_id = $3 AND a.attached_at IS NULL
+		RETURNING `+attachment.Columns, message.ID, message.AttachmentIDs, message.UserID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	attached := make(map[string]db.Attachment, len(ids))
+	for rows.Next() {
+		var a db.Attachment
+		if err := attachment.Scan(rows, &a); err != nil {
+			return err
+		}
+		attached[a.ID] = a
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(attached) != len(ids) {
+		return ErrInvalidAttachment
+	}
+
+	// Keep the order the sender listed them in
+	message.Attachments = make([]db.Attachment, 0, len(attached))
+	for _, id := range message.AttachmentIDs {
+		if a, ok := attached[id]; ok {
+			message.Attachments = append(message.Attachments, a)
+			delete(attached, id)
+		}
+	}
+	return nil
+}
+
+// attachAttachments adds the attachments of messages, with download URLs
+// signed for the viewer
+func attachAttachments(ctx context.Context, tx pgx.Tx, messages []db.Message, viewerID string) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	tenantID, _ := db.TenantFromContext(ctx)
+
+	index := make(map[string]int, len(messages))
+	ids := make([]string, len(messages))
+	for i, message := range messages {
+		index[message.ID] = i
+		ids[i] = message.ID
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT `+attachment.Columns+`
+		FROM attachments a
+		WHERE a.message_id = ANY($1)
+		ORDER BY a.attached_at, a.created_at, a.id
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a db.Attachment
+		if err := attachment.Scan(rows, &a); err != nil {
+			return err
+		}
+		if tenantID != "" && viewerID != "" {
+			attachment.Sign(tenantID, viewerID, &a)
+		}
+		i := index[*a.MessageID]
+		messages[i].Attachments = append(messages[i].Attachments, a)
+	}
+
+	return rows.Err()
+}
+
+// signedFor returns a copy of a live message whose attachments carry download
+// URLs signed for a recipient
+func signedFor(message *db.Message, userID string) *db.Message {
+	if len(message.Attachments) == 0 {
+		return message
+	}
+	signed := *message
+	signed.Attachments = append([]db.Attachment(nil), message.Attachments...)
+	for i := range signed.Attachments {
+		attachment.Sign(message.TenantID, userID, &signed.Attachments[i])
+	}
+	return &signed
+}
@@ -2,266 +2,478 @@ package chat
 
 import (
 	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/notification"
+	"ChitChat/internal/shared/application/service/quota"
+	"ChitChat/internal/shared/application/service/settings"
 	"ChitChat/internal/shared/application/service/websocket"
 	"context"
+	"errors"
 	"fmt"
+	"log"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/oklog/ulid/v2"
-) 
+)
 
+// ErrUserNotFound is returned when a user does not exist in the caller's tenant
+var ErrUserNotFound = errors.New("user not found")
+
+// ChatService implements rooms and messages. Every method takes a context
+// scoped to the caller's tenant and runs its queries under that tenant's
+// row-level security settings, so rows of other tenants are never visible.
 type ChatService struct {
-	db        *pgxpool.Pool
-	wsService *websocket.WebSocketService
+	db                  *pgxpool.Pool
+	wsService           *websocket.WebSocketService
+	notificationService *notification.NotificationService
+	quotaService        *quota.QuotaService
+	settingsService     *settings.SettingsService
 }
 
-func NewChatService(database *pgxpool.Pool, wsService *websocket.WebSocketService) *ChatService {
-	return &ChatService{
-		db:        database,
-		wsService: wsService,
+func NewChatService(database *pgxpool.Pool, wsService *websocket.WebSocketService, notificationService *notification.NotificationService, quotaService *quota.QuotaService, settingsService *settings.SettingsService) *ChatService {
+	s := &ChatService{
+		db:                  database,
+		wsService:           wsService,
+		notificationService: notificationService,
+		quotaService:        quotaService,
+		settingsService:     settingsService,
+	}
+
+	if wsService != nil {
+		wsService.SetSubscribeAuthorizer(s.canSubscribe)
+		wsService.RegisterHandler("mark_read", s.handleMarkRead)
+		wsService.RegisterHandler("mark_listened", s.handleMarkListened)
+		wsService.RegisterHandler("ack", s.handleAck)
+		wsService.RequireReadLimit(maxAckSize)
+		wsService.RegisterHandler("add_reaction", s.handleReaction)
+		wsService.RegisterHandler("remove_reaction", s.handleReaction)
+		wsService.AddConnectionListener(s)
 	}
+
+	return s
 }
 
-// CreateRoom creates a new chat room (group or direct) and adds members
-func (s *ChatService) CreateRoom(room *db.Room, userIDs []string) error {
-	ctx := context.Background()
+// canSubscribe only lets WebSocket clients subscribe to rooms their user is a
+// member of, which also keeps them out of other tenants' rooms
+func (s *ChatService) canSubscribe(client *websocket.Client, roomID string) bool {
+	ctx := db.ContextWithTenant(context.Background(), client.TenantID)
 
-	tx, err := s.db.Begin(ctx)
+	isMember, err := s.VerifyUserIsRoomMember(ctx, client.UserID, roomID)
 	if err != nil {
-		return err
+		log.Printf("Failed to verify membership of user %s in room %s: %v", client.UserID, roomID, err)
+		return false
 	}
-	defer tx.Rollback(ctx)
+	return isMember
+}
 
-	// Get tenant ID from the first user
-	var tenantID string
-	err = tx.QueryRow(ctx, "SELECT tenant_id FROM users WHERE id = $1", userIDs[0]).Scan(&tenantID)
-	if err != nil {
-		return err
-	}
+// roomColumns selects a room aliased as r, in the order scanRoom reads them
+const roomColumns = "r.id, r.tenant_id, r.name, r.type, r.description, r.avatar_url, r.topic, r.created_at"
 
-	// Create the room
-	err = tx.QueryRow(ctx, `
-		INSERT INTO rooms (id, tenant_id, name, type) 
-		VALUES ($1, $2, $3, $4) 
-		RETURNING id, tenant_id, name, type, created_at
-	`, room.ID, tenantID, room.Name, room.Type).Scan(&room.ID, &room.TenantID, &room.Name, &room.Type, &room.CreatedAt)
-	if err != nil {
-		return err
-	}
+// scanRoom reads a row selected with roomColumns
+func scanRoom(row pgx.Row, room *db.Room) error {
+	return row.Scan(&room.ID, &room.TenantID, &room.Name, &room.Type, &room.Description, &room.AvatarURL, &room.Topic, &room.CreatedAt)
+}
+
+// messageColumns selects a message aliased as m, in the order scanMessage
+// reads them
+const messageColumns = "m.id, m.tenant_id, m.room_id, m.user_id, m.type, m.content, m.sent_at, m.edited_at, m.deleted_at, m.deleted_by, m.reply_to_id, m.thread_root_id, m.reply_count, m.last_reply_at, m.mentions"
+
+// scanMessage reads a row selected with messageColumns, followed by any
+// extra columns
+func scanMessage(row pgx.Row, msg *db.Message, extra ...any) error {
+	dest := []any{&msg.ID, &msg.TenantID, &msg.RoomID, &msg.UserID, &msg.Type, &msg.Content, &msg.SentAt, &msg.EditedAt, &msg.DeletedAt, &msg.DeletedBy, &msg.ReplyToID, &msg.ThreadRootID, &msg.ReplyCount, &msg.LastReplyAt, &msg.Mentions}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// visibleTo filters out messages aliased as m that the user in the given
+// query parameter deleted for themselves
+func visibleTo(param string) string {
+	return "NOT EXISTS (SELECT 1 FROM message_hides h WHERE h.message_id = m.id AND h.user_id = " + param + ")"
+}
 
-	// Add all users as room members
-	for _, userID := range userIDs {
-		_, err = tx.Exec(ctx, "INSERT INTO room_members (room_id, user_id) VALUES ($1, $2)", room.ID, userID)
+// userInTenant checks that a user exists in the tenant of the transaction
+func userInTenant(ctx context.Context, tx pgx.Tx, tenantID, userID string) (bool, error) {
+	var exists bool
+	err := tx.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND tenant_id = $2)
+	`, userID, tenantID).Scan(&exists)
+	return exists, err
+}
+
+// CreateRoom creates a new chat room (group or direct) in the context's tenant
+// and adds members. The creator owns group rooms.
+func (s *ChatService) CreateRoom(ctx context.Context, room *db.Room, creatorID string, userIDs []string) error {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return db.ErrNoTenantContext
+	}
+
+	return db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		// Create the room
+		err := scanRoom(tx.QueryRow(ctx, `
+			INSERT INTO rooms AS r (id, tenant_id, name, type, description, avatar_url, topic) 
+			VALUES ($1, $2, $3, $4, $5, $6, $7) 
+			RETURNING `+roomColumns,
+			room.ID, tenantID, room.Name, room.Type, room.Description, room.AvatarURL, room.Topic), room)
 		if err != nil {
 			return err
 		}
-	}
 
-	return tx.Commit(ctx)
+		// Add all users as room members
+		for _, userID := range userIDs {
+			role := RoomRoleMember
+			if room.Type == "group" && userID == creatorID {
+				role = RoomRoleOwner
+			}
+			_, err = tx.Exec(ctx, "INSERT INTO room_members (room_id, user_id, tenant_id, role) VALUES ($1, $2, $3, $4)", room.ID, userID, tenantID, role)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
-// FindOrCreateDirectRoom finds an existing direct message room between two users or creates a new one
-func (s *ChatService) FindOrCreateDirectRoom(userID1, userID2 string) (*db.Room, error) {
-	ctx := context.Background()
+// FindOrCreateDirectRoom finds an existing direct message room between two users or creates a new one.
+// Both users must belong to the context's tenant.
+func (s *ChatService) FindOrCreateDirectRoom(ctx context.Context, userID1, userID2 string) (*db.Room, error) {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return nil, db.ErrNoTenantContext
+	}
 
-	// First, try to find an existing direct room between these users
 	var room db.Room
-	err := s.db.QueryRow(ctx, `
-		SELECT r.id, r.tenant_id, r.name, r.type, r.created_at
-		FROM rooms r
-		JOIN room_members rm1 ON r.id = rm1.room_id
-		JOIN room_members rm2 ON r.id = rm2.room_id
-		WHERE r.type = 'direct' 
-		AND rm1.user_id = $1 
-		AND rm2.user_id = $2
-		LIMIT 1
-	`, userID1, userID2).Scan(&room.ID, &room.TenantID, &room.Name, &room.Type, &room.CreatedAt)
-
-	if err == nil {
-		// Room found, return it
-		return &room, nil
-	}
-
-	// Room not found, create a new one
-	tx, err := s.db.Begin(ctx)
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback(ctx)
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		exists, err := userInTenant(ctx, tx, tenantID, userID2)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrUserNotFound
+		}
 
-	// Get tenant ID from one of the users
-	var tenantID string
-	err = tx.QueryRow(ctx, "SELECT tenant_id FROM users WHERE id = $1", userID1).Scan(&tenantID)
-	if err != nil {
-		return nil, err
-	}
+		// First, try to find an existing direct room between these users
+		err = scanRoom(tx.QueryRow(ctx, `
+			SELECT `+roomColumns+`
+			FROM rooms r
+			JOIN room_members rm1 ON r.id = rm1.room_id
+			JOIN room_members rm2 ON r.id = rm2.room_id
+			WHERE r.type = 'direct' 
+			AND rm1.user_id = $1 
+			AND rm2.user_id = $2
+			LIMIT 1
+		`, userID1, userID2), &room)
+		if err == nil {
+			// Room found, return it
+			return nil
+		}
 
-	// Create new room
-	roomID := uuid.New().String()
-	err = tx.QueryRow(ctx, `
-		INSERT INTO rooms (id, tenant_id, name, type) 
-		VALUES ($1, $2, 'Direct Message', 'direct') 
-		RETURNING id, tenant_id, name, type, created_at
-	`, roomID, tenantID).Scan(&room.ID, &room.TenantID, &room.Name, &room.Type, &room.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
+		// Room not found, create a new one
+		roomID := uuid.New().String()
+		err = scanRoom(tx.QueryRow(ctx, `
+			INSERT INTO rooms AS r (id, tenant_id, name, type) 
+			VALUES ($1, $2, 'Direct Message', 'direct') 
+			RETURNING `+roomColumns,
+			roomID, tenantID), &room)
+		if err != nil {
+			return err
+		}
 
-	// Add both users as room members
-	_, err = tx.Exec(ctx, "INSERT INTO room_members (room_id, user_id) VALUES ($1, $2)", roomID, userID1)
-	if err != nil {
-		return nil, err
-	}
+		// Add both users as room members
+		for _, userID := range []string{userID1, userID2} {
+			_, err = tx.Exec(ctx, "INSERT INTO room_members (room_id, user_id, tenant_id) VALUES ($1, $2, $3)", roomID, userID, tenantID)
+			if err != nil {
+				return err
+			}
+		}
 
-	_, err = tx.Exec(ctx, "INSERT INTO room_members (room_id, user_id) VALUES ($1, $2)", roomID, userID2)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if err = tx.Commit(ctx); err != nil {
-		return nil, err
-	}
-
 	return &room, nil
 }
 
-// SaveMessage saves a message to the database
-func (s *ChatService) SaveMessage(message *db.Message) error {
-	ctx := context.Background()
+// SaveMessage saves a message to a room of the context's tenant
+func (s *ChatService) SaveMessage(ctx context.Context, message *db.Message) error {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return db.ErrNoTenantContext
+	}
+
+	if message.Content == "" && len(message.AttachmentIDs) == 0 {
+		return ErrEmptyMessage
+	}
+	if message.Type == "" {
+		message.Type = MessageTypeUser
+	}
+	if message.Type == MessageTypeVoice && (message.Content != "" || len(message.AttachmentIDs) != 1) {
+		return ErrInvalidVoiceNote
+	}
 
 	// Generate ULID for message ID if not provided
 	if message.ID == "" {
 		message.ID = s.generateULID()
 	}
 
-	// Get tenant ID from the user
-	var tenantID string
-	err := s.db.QueryRow(ctx, "SELECT tenant_id FROM users WHERE id = $1", message.UserID).Scan(&tenantID)
-	if err != nil {
-		return err
-	}
+	var thread *db.ThreadUpdate
+	var followerIDs, mentionedIDs []string
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		if message.ReplyToID != nil {
+			if err := checkReplyTarget(ctx, tx, message.RoomID, *message.ReplyToID); err != nil {
+				return err
+			}
+		}
+		if message.ThreadRootID != nil {
+			if err := checkThreadRoot(ctx, tx, message.RoomID, *message.ThreadRootID); err != nil {
+				return err
+			}
+		}
+		mentionKinds, err := s.resolveMentions(ctx, tx, message)
+		if err != nil {
+			return err
+		}
 
-	_, err = s.db.Exec(ctx, `
-		INSERT INTO messages (id, tenant_id, room_id, user_id, content) 
-		VALUES ($1, $2, $3, $4, $5)
-	`, message.ID, tenantID, message.RoomID, message.UserID, message.Content)
+		// Usage is metered in the same transaction, so a message over quota
+		// is neither stored nor counted
+		if s.quotaService != nil {
+			if err := s.quotaService.RecordActiveUser(ctx, tx, tenantID, message.UserID); err != nil {
+				return err
+			}
+			if err := s.quotaService.Consume(ctx, tx, tenantID, quota.MetricMessages, 1); err != nil {
+				return err
+			}
+			if err := s.quotaService.Consume(ctx, tx, tenantID, quota.MetricStorage, int64(len(message.Content))); err != nil {
+				return err
+			}
+		}
 
+		if message.Mentions == nil {
+			message.Mentions = []string{}
+		}
+		err = tx.QueryRow(ctx, `
+			INSERT INTO messages (id, tenant_id, room_id, user_id, content, reply_to_id, thread_root_id, mentions, search_language, type) 
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9::regconfig, $10)
+			RETURNING tenant_id, sent_at
+		`, message.ID, tenantID, message.RoomID, message.UserID, message.Content, message.ReplyToID, message.ThreadRootID, message.Mentions, s.searchLanguage(tenantID), message.Type).Scan(&message.TenantID, &message.SentAt)
+		if err != nil {
+			return err
+		}
+		mentionedIDs, err = recordMentions(ctx, tx, message, mentionKinds)
+		if err != nil {
+			return err
+		}
+		if len(message.AttachmentIDs) > 0 {
+			if err := linkAttachments(ctx, tx, message); err != nil {
+				return err
+			}
+		}
+		if message.Type == MessageTypeVoice && message.Attachments[0].DurationMS == nil {
+			return ErrInvalidVoiceNote
+		}
+		saved := []db.Message{*message}
+		if err := attachReplyPreviews(ctx, tx, saved); err != nil {
+			return err
+		}
+		message.ReplyTo = saved[0].ReplyTo
+		if err := touchRoom(ctx, tx, message); err != nil {
+			return err
+		}
+		if message.ThreadRootID != nil {
+			// Followers must be known before receipts are created for them
+			thread, followerIDs, err = addThreadReply(ctx, tx, message)
+			if err != nil {
+				return err
+			}
+			return createReceipts(ctx, tx, message)
+		}
+		if err := createReceipts(ctx, tx, message); err != nil {
+			return err
+		}
+
+		// Sending a message means the sender has read the room up to it
+		_, err = tx.Exec(ctx, `
+			UPDATE room_members SET last_read_message_id = $1, last_read_at = NOW()
+			WHERE room_id = $2 AND user_id = $3
+		`, message.ID, message.RoomID, message.UserID)
+		return err
+	})
 	if err != nil {
 		return err
 	}
+	*message = *signedFor(message, message.UserID)
+
+	// Thread replies only reach the thread's followers
+	if thread != nil {
+		s.sendThreadReply(message, thread, followerIDs)
+		if s.notificationService != nil {
+			mentioned := s.notifyMentioned(message, mentionedIDs)
+			s.notifyThreadFollowers(message, followerIDs, mentioned)
+		}
+		return nil
+	}
 
 	// Broadcast message via WebSocket if service is available
 	if s.wsService != nil {
 		fmt.Printf("Broadcasting message to room %s: %s\n", message.RoomID, message.Content)
-		s.wsService.BroadcastMessage(message.RoomID, message)
+		// Every recipient gets download URLs signed for them
+		s.wsService.BroadcastToRoomPerUser(message.RoomID, "new_message", func(userID string) interface{} {
+			return signedFor(message, userID)
+		}, "")
 	} else {
 		fmt.Printf("WebSocket service not available for broadcasting\n")
 	}
 
+	// Notify the other room members, skipping anyone in do-not-disturb.
+	// Mentioned members get a mention notification instead.
+	if s.notificationService != nil {
+		mentioned := s.notifyMentioned(message, mentionedIDs)
+		s.notifyRoomMembers(ctx, message, mentioned)
+	}
+
 	return nil
 }
 
+// notifyRoomMembers sends a new message notification to every member except
+// the sender and those to skip
+func (s *ChatService) notifyRoomMembers(ctx context.Context, message *db.Message, skip map[string]bool) {
+	memberIDs, err := s.GetRoomMembers(ctx, message.RoomID)
+	if err != nil {
+		log.Printf("Failed to load members of room %s for notifications: %v", message.RoomID, err)
+		return
+	}
+
+	recipients := make([]string, 0, len(memberIDs))
+	for _, memberID := range memberIDs {
+		if memberID != message.UserID && !skip[memberID] {
+			recipients = append(recipients, memberID)
+		}
+	}
+
+	s.notificationService.NotifyUsers(recipients, db.Notification{
+		Type:     "new_message",
+		RoomID:   message.RoomID,
+		Priority: notification.PriorityNormal,
+		Payload:  message,
+	})
+}
+
 // generateULID creates a new ULID for message IDs
 func (s *ChatService) generateULID() string {
 	return ulid.Make().String()
 }
 
 // VerifyUserIsRoomMember checks if a user is a member of a specific room
-func (s *ChatService) VerifyUserIsRoomMember(userID, roomID string) (bool, error) {
-	ctx := context.Background()
-
+func (s *ChatService) VerifyUserIsRoomMember(ctx context.Context, userID, roomID string) (bool, error) {
 	var exists bool
-	err := s.db.QueryRow(ctx, `
-		SELECT EXISTS(
-			SELECT 1 FROM room_members 
-			WHERE room_id = $1 AND user_id = $2
-		)
-	`, roomID, userID).Scan(&exists)
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `
+			SELECT EXISTS(
+				SELECT 1 FROM room_members 
+				WHERE room_id = $1 AND user_id = $2
+			)
+		`, roomID, userID).Scan(&exists)
+	})
 
 	return exists, err
 }
 
-// GetMessagesByRoom retrieves messages for a specific room with pagination
-func (s *ChatService) GetMessagesByRoom(roomID string, page, limit int) ([]db.Message, error) {
-	ctx := context.Background()
-
-	offset := (page - 1) * limit
-
-	rows, err := s.db.Query(ctx, `
-		SELECT m.id, m.tenant_id, m.room_id, m.user_id, m.content, m.sent_at
-		FROM messages m
-		WHERE m.room_id = $1
-		ORDER BY m.id DESC
-		LIMIT $2 OFFSET $3
-	`, roomID, limit, offset)
-	if err != nil {
-		return nil, err
-	}
+// scanMessages reads message rows into a slice
+func scanMessages(rows pgx.Rows) ([]db.Message, error) {
 	defer rows.Close()
 
 	var messages []db.Message
 	for rows.Next() {
 		var msg db.Message
-		err := rows.Scan(&msg.ID, &msg.TenantID, &msg.RoomID, &msg.UserID, &msg.Content, &msg.SentAt)
-		if err != nil {
+		if err := scanMessage(rows, &msg); err != nil {
 			return nil, err
 		}
 		messages = append(messages, msg)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
 	return messages, nil
 }
 
-// GetMessagesByRoomCursor retrieves messages for a specific room using cursor-based pagination
-func (s *ChatService) GetMessagesByRoomCursor(roomID string, cursor string, limit int) ([]db.Message, string, error) {
-	ctx := context.Background()
-
-	var rows pgx.Rows
-	var err error
+// GetMessagesByRoom retrieves messages for a specific room with pagination,
+// leaving out messages the viewer deleted for themselves
+func (s *ChatService) GetMessagesByRoom(ctx context.Context, roomID, viewerID string, page, limit int) ([]db.Message, error) {
+	offset := (page - 1) * limit
 
-	if cursor == "" {
-		// First page - get the most recent messages using ULID sorting
-		rows, err = s.db.Query(ctx, `
-			SELECT m.id, m.tenant_id, m.room_id, m.user_id, m.content, m.sent_at
-			FROM messages m
-			WHERE m.room_id = $1
-			ORDER BY m.id DESC
-			LIMIT $2
-		`, roomID, limit+1) // Get one extra to determine if there are more pages
-	} else {
-		// Subsequent pages - use ULID cursor for efficient pagination
-		rows, err = s.db.Query(ctx, `
-			SELECT m.id, m.tenant_id, m.room_id, m.user_id, m.content, m.sent_at
+	var messages []db.Message
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT `+messageColumns+`
 			FROM messages m
-			WHERE m.room_id = $1
-			AND m.id < $2
+			WHERE m.room_id = $1 AND m.thread_root_id IS NULL AND `+visibleTo("$4")+`
 			ORDER BY m.id DESC
-			LIMIT $3
-		`, roomID, cursor, limit+1) // Get one extra to determine if there are more pages
-	}
+			LIMIT $2 OFFSET $3
+		`, roomID, limit, offset, viewerID)
+		if err != nil {
+			return err
+		}
 
+		messages, err = scanMessages(rows)
+		if err != nil {
+			return err
+		}
+		return attachMessageDetails(ctx, tx, messages, viewerID)
+	})
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	defer rows.Close()
 
+	return messages, nil
+}
+
+// GetMessagesByRoomCursor retrieves messages for a specific room using cursor-based pagination.
+// Messages deleted for everyone stay in the timeline as tombstones, messages
+// the viewer deleted for themselves are left out.
+func (s *ChatService) GetMessagesByRoomCursor(ctx context.Context, roomID, viewerID string, cursor string, limit int) ([]db.Message, string, error) {
 	var messages []db.Message
-	for rows.Next() {
-		var msg db.Message
-		err := rows.Scan(&msg.ID, &msg.TenantID, &msg.RoomID, &msg.UserID, &msg.Content, &msg.SentAt)
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		var rows pgx.Rows
+		var err error
+
+		if cursor == "" {
+			// First page - get the most recent messages using ULID sorting
+			rows, err = tx.Query(ctx, `
+				SELECT `+messageColumns+`
+				FROM messages m
+				WHERE m.room_id = $1 AND m.thread_root_id IS NULL AND `+visibleTo("$3")+`
+				ORDER BY m.id DESC
+				LIMIT $2
+			`, roomID, limit+1, viewerID) // Get one extra to determine if there are more pages
+		} else {
+			// Subsequent pages - use ULID cursor for efficient pagination
+			rows, err = tx.Query(ctx, `
+				SELECT `+messageColumns+`
+				FROM messages m
+				WHERE m.room_id = $1 AND m.thread_root_id IS NULL
+				AND m.id < $2
+				AND `+visibleTo("$4")+`
+				ORDER BY m.id DESC
+				LIMIT $3
+			`, roomID, cursor, limit+1, viewerID) // Get one extra to determine if there are more pages
+		}
 		if err != nil {
-			return nil, "", err
+			return err
 		}
-		messages = append(messages, msg)
-	}
 
-	if err = rows.Err(); err != nil {
+		messages, err = scanMessages(rows)
+		if err != nil {
+			return err
+		}
+		return attachMessageDetails(ctx, tx, messages, viewerID)
+	})
+	if err != nil {
 		return nil, "", err
 	}
 
@@ -277,43 +489,35 @@ func (s *ChatService) GetMessagesByRoomCursor(roomID string, cursor string, limi
 }
 
 // GetMessagesByRoomCursorForward retrieves newer messages (for real-time updates)
-func (s *ChatService) GetMessagesByRoomCursorForward(roomID string, cursor string, limit int) ([]db.Message, string, error) {
-	ctx := context.Background()
-
-	var rows pgx.Rows
-	var err error
-
+func (s *ChatService) GetMessagesByRoomCursorForward(ctx context.Context, roomID, viewerID string, cursor string, limit int) ([]db.Message, string, error) {
 	if cursor == "" {
 		// If no cursor, return empty (no newer messages)
 		return []db.Message{}, "", nil
 	}
 
-	// Get messages newer than the cursor using ULID sorting
-	rows, err = s.db.Query(ctx, `
-		SELECT m.id, m.tenant_id, m.room_id, m.user_id, m.content, m.sent_at
-		FROM messages m
-		WHERE m.room_id = $1
-		AND m.id > $2
-		ORDER BY m.id ASC
-		LIMIT $3
-	`, roomID, cursor, limit+1) // Get one extra to determine if there are more pages
-
-	if err != nil {
-		return nil, "", err
-	}
-	defer rows.Close()
-
 	var messages []db.Message
-	for rows.Next() {
-		var msg db.Message
-		err := rows.Scan(&msg.ID, &msg.TenantID, &msg.RoomID, &msg.UserID, &msg.Content, &msg.SentAt)
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		// Get messages newer than the cursor using ULID sorting
+		rows, err := tx.Query(ctx, `
+			SELECT `+messageColumns+`
+			FROM messages m
+			WHERE m.room_id = $1 AND m.thread_root_id IS NULL
+			AND m.id > $2
+			AND `+visibleTo("$4")+`
+			ORDER BY m.id ASC
+			LIMIT $3
+		`, roomID, cursor, limit+1, viewerID) // Get one extra to determine if there are more pages
 		if err != nil {
-			return nil, "", err
+			return err
 		}
-		messages = append(messages, msg)
-	}
 
-	if err = rows.Err(); err != nil {
+		messages, err = scanMessages(rows)
+		if err != nil {
+			return err
+		}
+		return attachMessageDetails(ctx, tx, messages, viewerID)
+	})
+	if err != nil {
 		return nil, "", err
 	}
 
@@ -328,55 +532,21 @@ func (s *ChatService) GetMessagesByRoomCursorForward(roomID string, cursor strin
 	return messages, nextCursor, nil
 }
 
-// GetUserChatRooms retrieves all chat rooms that a user is a member of
-func (s *ChatService) GetUserChatRooms(userID string) ([]db.Room, error) {
-	ctx := context.Background()
-
-	rows, err := s.db.Query(ctx, `
-		SELECT r.id, r.tenant_id, r.name, r.type, r.created_at
-		FROM rooms r
-		JOIN room_members rm ON r.id = rm.room_id
-		WHERE rm.user_id = $1
-		ORDER BY r.created_at DESC
-	`, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var rooms []db.Room
-	for rows.Next() {
-		var room db.Room
-		err := rows.Scan(&room.ID, &room.TenantID, &room.Name, &room.Type, &room.CreatedAt)
-		if err != nil {
-			return nil, err
-		}
-		rooms = append(rooms, room)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return rooms, nil
-}
-
 // CheckIfDirectRoomExists checks if a direct message room already exists between two users
-func (s *ChatService) CheckIfDirectRoomExists(userID1, userID2 string) (*db.Room, error) {
-	ctx := context.Background()
-
+func (s *ChatService) CheckIfDirectRoomExists(ctx context.Context, userID1, userID2 string) (*db.Room, error) {
 	var room db.Room
-	err := s.db.QueryRow(ctx, `
-		SELECT r.id, r.tenant_id, r.name, r.type, r.created_at
-		FROM rooms r
-		JOIN room_members rm1 ON r.id = rm1.room_id
-		JOIN room_members rm2 ON r.id = rm2.room_id
-		WHERE r.type = 'direct' 
-		AND rm1.user_id = $1 
-		AND rm2.user_id = $2
-		LIMIT 1
-	`, userID1, userID2).Scan(&room.ID, &room.TenantID, &room.Name, &room.Type, &room.CreatedAt)
-
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		return scanRoom(tx.QueryRow(ctx, `
+			SELECT `+roomColumns+`
+			FROM rooms r
+			JOIN room_members rm1 ON r.id = rm1.room_id
+			JOIN room_members rm2 ON r.id = rm2.room_id
+			WHERE r.type = 'direct' 
+			AND rm1.user_id = $1 
+			AND rm2.user_id = $2
+			LIMIT 1
+		`, userID1, userID2), &room)
+	})
 	if err != nil {
 		return nil, err // Room doesn't exist
 	}
@@ -384,125 +554,218 @@ func (s *ChatService) CheckIfDirectRoomExists(userID1, userID2 string) (*db.Room
 	return &room, nil
 }
 
-// ValidateUsersExist checks if all provided user IDs exist in the database
-func (s *ChatService) ValidateUsersExist(userIDs []string) error {
-	ctx := context.Background()
+// AreContacts reports whether two users already share a room
+func (s *ChatService) AreContacts(ctx context.Context, userID1, userID2 string) (bool, error) {
+	var shared bool
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM room_members rm1
+				JOIN room_members rm2 ON rm1.room_id = rm2.room_id
+				WHERE rm1.user_id = $1 AND rm2.user_id = $2
+			)
+		`, userID1, userID2).Scan(&shared)
+	})
+	return shared, err
+}
 
-	for _, userID := range userIDs {
-		var exists bool
-		err := s.db.QueryRow(ctx, `
-			SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)
-		`, userID).Scan(&exists)
+// ValidateUsersExist checks if all provided user IDs exist in the context's tenant
+func (s *ChatService) ValidateUsersExist(ctx context.Context, userIDs []string) error {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return db.ErrNoTenantContext
+	}
 
-		if err != nil {
-			return err
-		}
+	return db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		for _, userID := range userIDs {
+			exists, err := userInTenant(ctx, tx, tenantID, userID)
+			if err != nil {
+				return err
+			}
 
-		if !exists {
-			return fmt.Errorf("user with ID %s does not exist", userID)
+			if !exists {
+				return fmt.Errorf("user with ID %s does not exist", userID)
+			}
 		}
-	}
 
-	return nil
+		return nil
+	})
 }
 
 // GetRoomMembers retrieves all members of a specific room
-func (s *ChatService) GetRoomMembers(roomID string) ([]string, error) {
-	ctx := context.Background()
-
-	rows, err := s.db.Query(ctx, `
-		SELECT user_id FROM room_members WHERE room_id = $1
-	`, roomID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
+func (s *ChatService) GetRoomMembers(ctx context.Context, roomID string) ([]string, error) {
 	var userIDs []string
-	for rows.Next() {
-		var userID string
-		err := rows.Scan(&userID)
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT user_id FROM room_members WHERE room_id = $1
+		`, roomID)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var userID string
+			if err := rows.Scan(&userID); err != nil {
+				return err
+			}
+			userIDs = append(userIDs, userID)
 		}
-		userIDs = append(userIDs, userID)
-	}
 
-	if err = rows.Err(); err != nil {
+		return rows.Err()
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return userIDs, nil
 }
 
-// AddMemberToRoom adds a user to a group chat room
-func (s *ChatService) AddMemberToRoom(roomID, userID string) error {
-	ctx := context.Background()
-
-	// Check if room exists and is a group room
-	var roomType string
-	err := s.db.QueryRow(ctx, "SELECT type FROM rooms WHERE id = $1", roomID).Scan(&roomType)
-	if err != nil {
-		return fmt.Errorf("room not found")
+// AddMemberToRoom adds a user of the context's tenant to a group chat room on
+// behalf of actorID
+func (s *ChatService) AddMemberToRoom(ctx context.Context, roomID, actorID, userID string) error {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return db.ErrNoTenantContext
 	}
 
-	if roomType != "group" {
-		return fmt.Errorf("can only add members to group rooms")
-	}
+	var message *db.Message
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		// Check if room exists and is a group room
+		var roomType string
+		err := tx.QueryRow(ctx, "SELECT type FROM rooms WHERE id = $1", roomID).Scan(&roomType)
+		if err != nil {
+			return fmt.Errorf("room not found")
+		}
+
+		if roomType != "group" {
+			return fmt.Errorf("can only add members to group rooms")
+		}
+
+		// Users of other tenants are reported as missing rather than forbidden
+		exists, err := userInTenant(ctx, tx, tenantID, userID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrUserNotFound
+		}
 
-	// Check if user is already a member
-	isMember, err := s.VerifyUserIsRoomMember(userID, roomID)
+		// Check if user is already a member
+		var isMember bool
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM room_members WHERE room_id = $1 AND user_id = $2)
+		`, roomID, userID).Scan(&isMember)
+		if err != nil {
+			return err
+		}
+		if isMember {
+			return fmt.Errorf("user is already a member of this room")
+		}
+
+		// Add user to room
+		_, err = tx.Exec(ctx, "INSERT INTO room_members (room_id, user_id, tenant_id) VALUES ($1, $2, $3)", roomID, userID, tenantID)
+		if err != nil {
+			return err
+		}
+
+		memberName, err := userName(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		message, err = s.postSystemMessage(ctx, tx, roomID, actorID, "added "+memberName)
+		return err
+	})
 	if err != nil {
 		return err
 	}
-	if isMember {
-		return fmt.Errorf("user is already a member of this room")
-	}
 
-	// Add user to room
-	_, err = s.db.Exec(ctx, "INSERT INTO room_members (room_id, user_id) VALUES ($1, $2)", roomID, userID)
-	return err
+	event := map[string]string{
+		"room_id":  roomID,
+		"user_id":  userID,
+		"added_by": actorID,
+	}
+	s.broadcastRoomChange(roomID, "member_added", event, message)
+	if s.wsService != nil {
+		// The new member is not subscribed to the room yet
+		s.wsService.SendToUser(userID, "member_added", event)
+	}
+	return nil
 }
 
-// RemoveMemberFromRoom removes a user from a group chat room
-func (s *ChatService) RemoveMemberFromRoom(roomID, userID string) error {
-	ctx := context.Background()
+// RemoveMemberFromRoom removes a user from a group chat room on behalf of actorID
+func (s *ChatService) RemoveMemberFromRoom(ctx context.Context, roomID, actorID, userID string) error {
+	var message *db.Message
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		// Check if room exists and is a group room
+		var roomType string
+		err := tx.QueryRow(ctx, "SELECT type FROM rooms WHERE id = $1", roomID).Scan(&roomType)
+		if err != nil {
+			return fmt.Errorf("room not found")
+		}
 
-	// Check if room exists and is a group room
-	var roomType string
-	err := s.db.QueryRow(ctx, "SELECT type FROM rooms WHERE id = $1", roomID).Scan(&roomType)
+		if roomType != "group" {
+			return fmt.Errorf("can only remove members from group rooms")
+		}
+
+		// The owner can only leave, never be removed
+		tag, err := tx.Exec(ctx, "DELETE FROM room_members WHERE room_id = $1 AND user_id = $2 AND role <> 'owner'", roomID, userID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrMemberNotFound
+		}
+		if err := deleteReceipts(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+		if err := deleteThreadFollows(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+
+		memberName, err := userName(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		message, err = s.postSystemMessage(ctx, tx, roomID, actorID, "removed "+memberName)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("room not found")
+		return err
 	}
 
-	if roomType != "group" {
-		return fmt.Errorf("can only remove members from group rooms")
+	event := map[string]string{
+		"room_id":    roomID,
+		"user_id":    userID,
+		"removed_by": actorID,
 	}
-
-	// Remove user from room
-	_, err = s.db.Exec(ctx, "DELETE FROM room_members WHERE room_id = $1 AND user_id = $2", roomID, userID)
-	return err
+	if s.wsService != nil {
+		s.wsService.UnsubscribeUser(userID, roomID)
+		s.wsService.SendToUser(userID, "member_removed", event)
+	}
+	s.broadcastRoomChange(roomID, "member_removed", event, message)
+	return nil
 }
 
 // GetRoomInfo retrieves detailed information about a room including member count
-func (s *ChatService) GetRoomInfo(roomID string) (*db.Room, int, error) {
-	ctx := context.Background()
-
-	// Get room details
+func (s *ChatService) GetRoomInfo(ctx context.Context, roomID string) (*db.Room, int, error) {
 	var room db.Room
-	err := s.db.QueryRow(ctx, `
-		SELECT id, tenant_id, name, type, created_at
-		FROM rooms WHERE id = $1
-	`, roomID).Scan(&room.ID, &room.TenantID, &room.Name, &room.Type, &room.CreatedAt)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	// Get member count
 	var memberCount int
-	err = s.db.QueryRow(ctx, `
-		SELECT COUNT(*) FROM room_members WHERE room_id = $1
-	`, roomID).Scan(&memberCount)
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		// Get room details
+		err := scanRoom(tx.QueryRow(ctx, `
+			SELECT `+roomColumns+`
+			FROM rooms r WHERE r.id = $1
+		`, roomID), &room)
+		if err != nil {
+			return err
+		}
+
+		// Get member count
+		return tx.QueryRow(ctx, `
+			SELECT COUNT(*) FROM room_members WHERE room_id = $1
+		`, roomID).Scan(&memberCount)
+	})
 	if err != nil {
 		return nil, 0, err
 	}
@@ -511,32 +774,27 @@ func (s *ChatService) GetRoomInfo(roomID string) (*db.Room, int, error) {
 }
 
 // GetRecentMessages gets the most recent messages from a room (for preview)
-func (s *ChatService) GetRecentMessages(roomID string, limit int) ([]db.Message, error) {
-	ctx := context.Background()
-
-	rows, err := s.db.Query(ctx, `
-		SELECT m.id, m.tenant_id, m.room_id, m.user_id, m.content, m.sent_at
-		FROM messages m
-		WHERE m.room_id = $1
-		ORDER BY m.id DESC
-		LIMIT $2
-	`, roomID, limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
+func (s *ChatService) GetRecentMessages(ctx context.Context, roomID, viewerID string, limit int) ([]db.Message, error) {
 	var messages []db.Message
-	for rows.Next() {
-		var msg db.Message
-		err := rows.Scan(&msg.ID, &msg.TenantID, &msg.RoomID, &msg.UserID, &msg.Content, &msg.SentAt)
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT `+messageColumns+`
+			FROM messages m
+			WHERE m.room_id = $1 AND m.thread_root_id IS NULL AND `+visibleTo("$3")+`
+			ORDER BY m.id DESC
+			LIMIT $2
+		`, roomID, limit, viewerID)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		messages = append(messages, msg)
-	}
 
-	if err = rows.Err(); err != nil {
+		messages, err = scanMessages(rows)
+		if err != nil {
+			return err
+		}
+		return attachMessageDetails(ctx, tx, messages, viewerID)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,333 @@
+package chat
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/websocket"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Delivery states of a message for one recipient
+const (
+	DeliverySent      = "sent"
+	DeliveryDelivered = "delivered"
+	DeliveryRead      = "read"
+)
+
+// maxAckBatch caps the message IDs accepted in one acknowledgement and the
+// messages redelivered at once
+const maxAckBatch = 500
+
+// maxAckSize is the largest WebSocket message clients may send, so an ack
+// of maxAckBatch ULIDs (26 characters, quoted and comma separated) fits
+// with its envelope
+const maxAckSize = maxAckBatch*(26+3) + 1024
+
+// ErrNotMessageAuthor is returned when someone other than the author asks for
+// something only the author of a message may do or see
+var ErrNotMessageAuthor = errors.New("user is not the author of this message")
+
+// statusChange is a receipt that moved to a new delivery state
+type statusChange struct {
+	messageID   string
+	roomID      string
+	senderID    string
+	senderHides bool // the sender hides read receipts, so is not told about reads
+}
+
+// createReceipts starts a message as sent to every other member of its room,
+// or to the other followers of its thread for thread replies
+func createReceipts(ctx context.Context, tx pgx.Tx, message *db.Message) error {
+	if message.ThreadRootID != nil {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO message_receipts (message_id, user_id, room_id, tenant_id)
+			SELECT $1, user_id, room_id, tenant_id FROM thread_follows
+			WHERE thread_root_id = $2 AND user_id <> $3
+		`, message.ID, *message.ThreadRootID, message.UserID)
+		return err
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO message_receipts (message_id, user_id, room_id, tenant_id)
+		SELECT $1, user_id, room_id, tenant_id FROM room_members
+		WHERE room_id = $2 AND user_id <> $3
+	`, message.ID, message.RoomID, message.UserID)
+	return err
+}
+
+// deleteReceipts drops a former member's receipts for a room, so nothing of it
+// is redelivered to them
+func deleteReceipts(ctx context.Context, tx pgx.Tx, roomID, userID string) error {
+	_, err := tx.Exec(ctx, "DELETE FROM message_receipts WHERE room_id = $1 AND user_id = $2", roomID, userID)
+	return err
+}
+
+// scanStatusChanges reads the message_id, room_id, sender and sender privacy
+// columns returned by a receipt update
+func scanStatusChanges(rows pgx.Rows) ([]statusChange, error) {
+	defer rows.Close()
+
+	var changes []statusChange
+	for rows.Next() {
+		var change statusChange
+		if err := rows.Scan(&change.messageID, &change.roomID, &change.senderID, &change.senderHides); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// sendStatusUpdates tells each sender which of their messages reached a new
+// state for a recipient, one event per sender and room
+func (s *ChatService) sendStatusUpdates(recipientID, status string, at time.Time, changes []statusChange) {
+	if s.wsService == nil {
+		return
+	}
+
+	type key struct{ senderID, roomID string }
+	updates := make(map[key]*db.MessageStatusUpdate)
+	var order []key
+	for _, change := range changes {
+		if status == DeliveryRead && change.senderHides {
+			continue
+		}
+		k := key{change.senderID, change.roomID}
+		if updates[k] == nil {
+			updates[k] = &db.MessageStatusUpdate{
+				RoomID: change.roomID,
+				UserID: recipientID,
+				Status: status,
+				At:     at,
+			}
+			order = append(order, k)
+		}
+		updates[k].MessageIDs = append(updates[k].MessageIDs, change.messageID)
+	}
+
+	for _, k := range order {
+		s.wsService.SendToUser(k.senderID, "message_status", updates[k])
+	}
+}
+
+// handleAck marks messages as delivered to the client's user. The content is
+// a message ID or a list of them.
+func (s *ChatService) handleAck(client *websocket.Client, message *websocket.Message) {
+	var messageIDs []string
+	switch content := message.Content.(type) {
+	case string:
+		messageIDs = []string{content}
+	case []interface{}:
+		for _, item := range content {
+			if id, ok := item.(string); ok {
+				messageIDs = append(messageIDs, id)
+			}
+		}
+	}
+	if len(messageIDs) == 0 || len(messageIDs) > maxAckBatch {
+		s.wsService.SendErrorToClient(client, "Ack must contain between 1 and 500 message IDs")
+		return
+	}
+
+	ctx := db.ContextWithTenant(context.Background(), client.TenantID)
+	if err := s.AcknowledgeMessages(ctx, client.UserID, messageIDs); err != nil {
+		log.Printf("Failed to acknowledge messages for user %s: %v", client.UserID, err)
+		s.wsService.SendErrorToClient(client, "Failed to acknowledge messages")
+	}
+}
+
+// AcknowledgeMessages marks messages as delivered to a user and tells their
+// senders. Messages already delivered or read are left alone.
+func (s *ChatService) AcknowledgeMessages(ctx context.Context, userID string, messageIDs []string) error {
+	var changes []statusChange
+	now := time.Now().UTC()
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			UPDATE message_receipts mr SET status = 'delivered', delivered_at = $3
+			FROM messages m
+			JOIN users su ON su.id = m.user_id
+			WHERE m.id = mr.message_id
+			AND mr.user_id = $1 AND mr.message_id = ANY($2) AND mr.status = 'sent'
+			RETURNING mr.message_id, mr.room_id, m.user_id, su.hide_read_receipts
+		`, userID, messageIDs, now)
+		if err != nil {
+			return err
+		}
+
+		changes, err = scanStatusChanges(rows)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.sendStatusUpdates(userID, DeliveryDelivered, now, changes)
+	return nil
+}
+
+// markReceiptsRead moves a member's receipts in a room's main timeline, or in
+// one thread, up to a message to read. Members who hide read receipts only
+// report delivery. It returns the state the receipts moved to and which ones
+// changed.
+func markReceiptsRead(ctx context.Context, tx pgx.Tx, roomID, userID, upTo string, threadRootID *string, hidden bool, at time.Time) (string, []statusChange, error) {
+	status := DeliveryRead
+	query := `
+		UPDATE message_receipts mr
+		SET status = 'read', delivered_at = COALESCE(mr.delivered_at, $4), read_at = $4
+		FROM messages m
+		JOIN users su ON su.id = m.user_id
+		WHERE m.id = mr.message_id
+		AND mr.room_id = $1 AND mr.user_id = $2 AND mr.message_id <= $3 AND mr.status <> 'read'
+		AND m.thread_root_id IS NOT DISTINCT FROM $5
+		RETURNING mr.message_id, mr.room_id, m.user_id, su.hide_read_receipts
+	`
+	if hidden {
+		status = DeliveryDelivered
+		query = `
+			UPDATE message_receipts mr SET status = 'delivered', delivered_at = $4
+			FROM messages m
+			JOIN users su ON su.id = m.user_id
+			WHERE m.id = mr.message_id
+			AND mr.room_id = $1 AND mr.user_id = $2 AND mr.message_id <= $3 AND mr.status = 'sent'
+			AND m.thread_root_id IS NOT DISTINCT FROM $5
+			RETURNING mr.message_id, mr.room_id, m.user_id, su.hide_read_receipts
+		`
+	}
+
+	rows, err := tx.Query(ctx, query, roomID, userID, upTo, at, threadRootID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	changes, err := scanStatusChanges(rows)
+	return status, changes, err
+}
+
+// GetPendingMessages returns the oldest messages not yet delivered to a user,
+// with their details as the user sees them
+func (s *ChatService) GetPendingMessages(ctx context.Context, userID string, limit int) ([]db.Message, bool, error) {
+	var messages []db.Message
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT `+messageColumns+`
+			FROM message_receipts mr
+			JOIN messages m ON m.id = mr.message_id
+			WHERE mr.user_id = $1 AND mr.status = 'sent' AND `+visibleTo("$1")+`
+			ORDER BY mr.message_id
+			LIMIT $2
+		`, userID, limit+1) // Get one extra to determine if there are more
+		if err != nil {
+			return err
+		}
+
+		messages, err = scanMessages(rows)
+		if err != nil {
+			return err
+		}
+		return attachMessageDetails(ctx, tx, messages, userID)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	if messages == nil {
+		messages = []db.Message{}
+	}
+	return messages, hasMore, nil
+}
+
+// UserConnected redelivers messages a user has not acknowledged, such as
+// messages sent while they were offline or dropped by a full client buffer
+func (s *ChatService) UserConnected(userID string) {
+	// A user's ID identifies their tenant, so the lookup can skip tenant scoping
+	ctx := db.SystemContext(context.Background())
+
+	messages, hasMore, err := s.GetPendingMessages(ctx, userID, maxAckBatch)
+	if err != nil {
+		log.Printf("Failed to load pending messages for user %s: %v", userID, err)
+		return
+	}
+	if len(messages) == 0 {
+		return
+	}
+
+	s.wsService.SendToUser(userID, "pending_messages", map[string]interface{}{
+		"messages": messages,
+		"has_more": hasMore,
+	})
+}
+
+// UserDisconnected is part of websocket.ConnectionListener; undelivered
+// messages simply stay pending
+func (s *ChatService) UserDisconnected(userID string) {}
+
+// GetMessageDelivery lists the delivery state of a message for each
+// recipient. Only the author may see it, and authors who hide their own read
+// receipts see reads as deliveries and no plays of voice notes. Plays by
+// recipients who hide their read receipts are left out too.
+func (s *ChatService) GetMessageDelivery(ctx context.Context, roomID, messageID, userID string) ([]db.MessageDelivery, error) {
+	deliveries := []db.MessageDelivery{}
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		var authorID string
+		var hidden bool
+		err := tx.QueryRow(ctx, `
+			SELECT m.user_id, u.hide_read_receipts
+			FROM messages m
+			JOIN users u ON u.id = $3
+			WHERE m.id = $1 AND m.room_id = $2
+		`, messageID, roomID, userID).Scan(&authorID, &hidden)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if authorID != userID {
+			return ErrNotMessageAuthor
+		}
+
+		rows, err := tx.Query(ctx, `
+			SELECT mr.user_id, u.name, mr.status, mr.delivered_at, mr.read_at,
+				CASE WHEN u.hide_read_receipts THEN NULL ELSE mr.listened_at END
+			FROM message_receipts mr
+			JOIN users u ON u.id = mr.user_id
+			WHERE mr.message_id = $1
+			ORDER BY u.name
+		`, messageID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var delivery db.MessageDelivery
+			if err := rows.Scan(&delivery.UserID, &delivery.Name, &delivery.Status, &delivery.DeliveredAt, &delivery.ReadAt, &delivery.ListenedAt); err != nil {
+				return err
+			}
+			if hidden {
+				if delivery.Status == DeliveryRead {
+					delivery.Status = DeliveryDelivered
+					delivery.ReadAt = nil
+				}
+				delivery.ListenedAt = nil
+			}
+			deliveries = append(deliveries, delivery)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
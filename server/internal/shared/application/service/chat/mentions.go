@@ -0,0 +1,219 @@
+package chat
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/notification"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Mention kinds, also used as the mention entities for @here and @room
+const (
+	MentionUser = "user"
+	MentionHere = "here"
+	MentionRoom = "room"
+)
+
+// maxMentions caps the distinct mentions of one message
+const maxMentions = 50
+
+// ErrInvalidMention is returned when a message mentions someone who is not a
+// member of its room, or too many people
+var ErrInvalidMention = errors.New("mentions must be members of the room")
+
+// ErrMentionRoomPermission is the ErrRoomPermission returned when a member
+// whose role does not allow it mentions @room
+var ErrMentionRoomPermission = fmt.Errorf("%w: only room admins can mention @room", ErrRoomPermission)
+
+var (
+	// mentionTokenPattern finds @here and @room in message content
+	mentionTokenPattern = regexp.MustCompile(`(?:^|\s)@(here|room)\b`)
+	// userMentionPattern finds user mentions written as <@user_id>
+	userMentionPattern = regexp.MustCompile(`<@([0-9a-fA-F-]{36})>`)
+)
+
+// parseMentions merges the mentions sent as entities with those written in
+// the content, without duplicates: user IDs first, then "here" and "room"
+func parseMentions(content string, entities []string) []string {
+	seen := make(map[string]bool)
+	var userIDs []string
+	var groups []string
+	add := func(mention string) {
+		if mention == "" || seen[mention] {
+			return
+		}
+		seen[mention] = true
+		if mention == MentionHere || mention == MentionRoom {
+			groups = append(groups, mention)
+		} else {
+			userIDs = append(userIDs, mention)
+		}
+	}
+
+	for _, entity := range entities {
+		add(entity)
+	}
+	for _, match := range mentionTokenPattern.FindAllStringSubmatch(content, -1) {
+		add(match[1])
+	}
+	for _, match := range userMentionPattern.FindAllStringSubmatch(content, -1) {
+		add(match[1])
+	}
+
+	sort.Strings(groups)
+	return append(userIDs, groups...)
+}
+
+// resolveMentions validates a new message's mentions against its room and
+// returns the kind of mention of each mentioned member other than the
+// sender. @room needs a room admin, @here reaches the members who are online.
+func (s *ChatService) resolveMentions(ctx context.Context, tx pgx.Tx, message *db.Message) (map[string]string, error) {
+	message.Mentions = parseMentions(message.Content, message.Mentions)
+	if len(message.Mentions) == 0 {
+		return nil, nil
+	}
+	if len(message.Mentions) > maxMentions {
+		return nil, ErrInvalidMention
+	}
+
+	role, roomType, err := memberRole(ctx, tx, message.RoomID, message.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, "SELECT user_id::text FROM room_members WHERE room_id = $1", message.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	memberIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]bool, len(memberIDs))
+	for _, memberID := range memberIDs {
+		members[memberID] = true
+	}
+
+	// A member mentioned several ways keeps the most direct kind
+	kinds := make(map[string]string)
+	for _, mention := range message.Mentions {
+		switch mention {
+		case MentionRoom:
+			if !RoomRolePermits(roomType, role, ActionMentionRoom) {
+				return nil, ErrMentionRoomPermission
+			}
+			for _, memberID := range memberIDs {
+				if kinds[memberID] == "" {
+					kinds[memberID] = MentionRoom
+				}
+			}
+		case MentionHere:
+			for _, memberID := range memberIDs {
+				if s.wsService != nil && s.wsService.IsUserOnline(memberID) && kinds[memberID] != MentionUser {
+					kinds[memberID] = MentionHere
+				}
+			}
+		default:
+			if !members[mention] {
+				return nil, ErrInvalidMention
+			}
+			kinds[mention] = MentionUser
+		}
+	}
+	delete(kinds, message.UserID)
+
+	return kinds, nil
+}
+
+// recordMentions stores the mentions of a saved message for the inboxes of
+// the mentioned members and returns their IDs
+func recordMentions(ctx context.Context, tx pgx.Tx, message *db.Message, kinds map[string]string) ([]string, error) {
+	mentionedIDs := make([]string, 0, len(kinds))
+	for userID, kind := range kinds {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO message_mentions (message_id, user_id, room_id, tenant_id, kind)
+			VALUES ($1, $2, $3, $4, $5)
+		`, message.ID, userID, message.RoomID, message.TenantID, kind)
+		if err != nil {
+			return nil, err
+		}
+		mentionedIDs = append(mentionedIDs, userID)
+	}
+	return mentionedIDs, nil
+}
+
+// notifyMentioned sends a high priority mention notification to each
+// mentioned member and returns them, so they can be left out of the regular
+// new message notification
+func (s *ChatService) notifyMentioned(message *db.Message, mentionedIDs []string) map[string]bool {
+	mentioned := make(map[string]bool, len(mentionedIDs))
+	for _, userID := range mentionedIDs {
+		mentioned[userID] = true
+	}
+	if len(mentionedIDs) > 0 {
+		s.notificationService.NotifyUsers(mentionedIDs, db.Notification{
+			Type:     "mention",
+			RoomID:   message.RoomID,
+			Priority: notification.PriorityHigh,
+			Payload:  message,
+		})
+	}
+	return mentioned
+}
+
+// GetMentions lists the messages that mention a user in rooms they still
+// belong to, newest first, and whether the user has read each of them. Pass
+// the returned cursor to get older mentions; it is empty on the last page.
+func (s *ChatService) GetMentions(ctx context.Context, userID, cursor string, limit int) ([]db.Mention, string, error) {
+	mentions := []db.Mention{}
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		// Thread replies are read through the thread's marker, other messages
+		// through the room's
+		rows, err := tx.Query(ctx, `
+			SELECT `+messageColumns+`, mm.kind,
+				CASE WHEN m.thread_root_id IS NULL
+					THEN m.id <= COALESCE(rm.last_read_message_id, '')
+					ELSE m.id <= COALESCE(tf.last_read_message_id, '')
+				END
+			FROM message_mentions mm
+			JOIN messages m ON m.id = mm.message_id
+			JOIN room_members rm ON rm.room_id = mm.room_id AND rm.user_id = mm.user_id
+			LEFT JOIN thread_follows tf ON tf.thread_root_id = m.thread_root_id AND tf.user_id = mm.user_id
+			WHERE mm.user_id = $1
+			AND ($2 = '' OR mm.message_id < $2)
+			AND m.deleted_at IS NULL
+			AND `+visibleTo("$1")+`
+			ORDER BY mm.message_id DESC
+			LIMIT $3
+		`, userID, cursor, limit+1) // Get one extra to determine if there are more pages
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var mention db.Mention
+			if err := scanMessage(rows, &mention.Message, &mention.Kind, &mention.Read); err != nil {
+				return err
+			}
+			mentions = append(mentions, mention)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if len(mentions) > limit {
+		mentions = mentions[:limit]
+		nextCursor = mentions[limit-1].Message.ID
+	}
+
+	return mentions, nextCursor, nil
+}
@@ -0,0 +1,155 @@
+package chat
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/quota"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DeleteMessage deletes a message for everyone, leaving a tombstone in its
+// place so cursors into the room stay valid. The content, edit history,
+// reactions, mentions and pins of the message are removed, and its
+// attachments are left to the attachment cleanup job. Authors may
+// delete their own messages; room admins and tenant moderators may delete
+// anyone's.
+func (s *ChatService) DeleteMessage(ctx context.Context, roomID, messageID, userID string, tenantModerator bool) (*db.Message, error) {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return nil, db.ErrNoTenantContext
+	}
+
+	var message db.Message
+	deleted := false
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		err := scanMessage(tx.QueryRow(ctx, `
+			SELECT `+messageColumns+`
+			FROM messages m
+			WHERE m.id = $1 AND m.room_id = $2
+			FOR UPDATE
+		`, messageID, roomID), &message)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if !tenantModerator {
+			role, roomType, err := memberRole(ctx, tx, roomID, userID)
+			if err != nil {
+				return err
+			}
+			if message.UserID != userID && !RoomRolePermits(roomType, role, ActionDeleteOthersMessages) {
+				return ErrRoomPermission
+			}
+		}
+		if message.Type == MessageTypeSystem {
+			return fmt.Errorf("system messages cannot be deleted")
+		}
+		if message.DeletedAt != nil {
+			return nil
+		}
+
+		// Give back the storage of the content and its revisions
+		var revisionBytes int64
+		err = tx.QueryRow(ctx, `
+			WITH removed AS (
+				DELETE FROM message_revisions WHERE message_id = $1 RETURNING content
+			)
+			SELECT COALESCE(SUM(octet_length(content)), 0) FROM removed
+		`, messageID).Scan(&revisionBytes)
+		if err != nil {
+			return err
+		}
+		if s.quotaService != nil {
+			freed := int64(len(message.Content)) + revisionBytes
+			if err := s.quotaService.Consume(ctx, tx, tenantID, quota.MetricStorage, -freed); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec(ctx, "DELETE FROM pinned_messages WHERE message_id = $1", messageID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM message_reactions WHERE message_id = $1", messageID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM message_mentions WHERE message_id = $1", messageID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "UPDATE attachments SET message_id = NULL WHERE message_id = $1", messageID); err != nil {
+			return err
+		}
+
+		deleted = true
+		return scanMessage(tx.QueryRow(ctx, `
+			UPDATE messages m SET content = '', mentions = '{}', deleted_at = NOW(), deleted_by = $2
+			WHERE m.id = $1
+			RETURNING `+messageColumns, messageID, userID), &message)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if deleted && s.wsService != nil {
+		s.wsService.BroadcastToRoom(roomID, "message_deleted", map[string]interface{}{
+			"room_id":    roomID,
+			"message_id": messageID,
+			"deleted_by": userID,
+			"deleted_at": message.DeletedAt,
+		}, "")
+	}
+	return &message, nil
+}
+
+// HideMessage deletes a message for one member only. Hidden messages are left
+// out of that member's timeline, unread count and room preview.
+func (s *ChatService) HideMessage(ctx context.Context, roomID, messageID, userID string) error {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return db.ErrNoTenantContext
+	}
+
+	var hiddenAt time.Time
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		if _, _, err := memberRole(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+
+		var exists bool
+		err := tx.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM messages WHERE id = $1 AND room_id = $2)
+		`, messageID, roomID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrMessageNotFound
+		}
+
+		return tx.QueryRow(ctx, `
+			INSERT INTO message_hides (message_id, user_id, tenant_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, message_id) DO UPDATE SET hidden_at = message_hides.hidden_at
+			RETURNING hidden_at
+		`, messageID, userID, tenantID).Scan(&hiddenAt)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Only the member's own devices need to drop the message
+	if s.wsService != nil {
+		s.wsService.SendToUser(userID, "message_hidden", map[string]interface{}{
+			"room_id":    roomID,
+			"message_id": messageID,
+			"hidden_at":  hiddenAt,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package chat
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/quota"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrEditWindowExpired is returned when a message is edited after the
+// tenant's edit window has closed
+var ErrEditWindowExpired = errors.New("edit window has expired")
+
+// EditMessage replaces the content of a user's own message, keeping the
+// previous content as a revision. editWindowMinutes limits how long after
+// sending a message may be edited; 0 means no limit.
+func (s *ChatService) EditMessage(ctx context.Context, roomID, messageID, userID, content string, editWindowMinutes int) (*db.Message, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("message content cannot be empty")
+	}
+
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return nil, db.ErrNoTenantContext
+	}
+
+	var message db.Message
+	changed := false
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		if _, _, err := memberRole(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+
+		var withinWindow bool
+		err := scanMessage(tx.QueryRow(ctx, `
+			SELECT `+messageColumns+`, ($3 = 0 OR m.sent_at > NOW() - make_interval(mins => $3))
+			FROM messages m
+			WHERE m.id = $1 AND m.room_id = $2 AND m.deleted_at IS NULL
+			FOR UPDATE
+		`, messageID, roomID, editWindowMinutes), &message, &withinWindow)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if message.Type != MessageTypeUser || message.UserID != userID {
+			return ErrNotMessageAuthor
+		}
+		if !withinWindow {
+			return ErrEditWindowExpired
+		}
+		if message.Content == content {
+			return nil
+		}
+
+		// The new content is stored alongside the old revision, so all of
+		// it counts towards storage
+		if s.quotaService != nil {
+			if err := s.quotaService.Consume(ctx, tx, tenantID, quota.MetricStorage, int64(len(content))); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO message_revisions (message_id, tenant_id, content, edited_by)
+			VALUES ($1, $2, $3, $4)
+		`, message.ID, tenantID, message.Content, userID)
+		if err != nil {
+			return err
+		}
+
+		changed = true
+		return tx.QueryRow(ctx, `
+			UPDATE messages SET content = $1, edited_at = NOW()
+			WHERE id = $2
+			RETURNING content, edited_at
+		`, content, messageID).Scan(&message.Content, &message.EditedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if changed && s.wsService != nil {
+		s.wsService.BroadcastToRoom(roomID, "message_updated", message, "")
+	}
+	return &message, nil
+}
+
+// GetMessageRevisions lists the previous versions of a message, oldest
+// first. The author, room admins and tenant moderators may see them.
+func (s *ChatService) GetMessageRevisions(ctx context.Context, roomID, messageID, userID string, tenantModerator bool) ([]db.MessageRevision, error) {
+	revisions := []db.MessageRevision{}
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		var authorID string
+		err := tx.QueryRow(ctx, "SELECT user_id FROM messages WHERE id = $1 AND room_id = $2", messageID, roomID).Scan(&authorID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if !tenantModerator {
+			role, roomType, err := memberRole(ctx, tx, roomID, userID)
+			if err != nil {
+				return err
+			}
+			if authorID != userID && !RoomRolePermits(roomType, role, ActionViewRevisions) {
+				return ErrRoomPermission
+			}
+		}
+
+		rows, err := tx.Query(ctx, `
+			SELECT id, message_id, content, edited_by, edited_at
+			FROM message_revisions
+			WHERE message_id = $1
+			ORDER BY id
+		`, messageID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var revision db.MessageRevision
+			if err := rows.Scan(&revision.ID, &revision.MessageID, &revision.Content, &revision.EditedBy, &revision.EditedAt); err != nil {
+				return err
+			}
+			revisions = append(revisions, revision)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
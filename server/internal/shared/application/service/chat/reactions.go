@@ -0,0 +1,187 @@
+package chat
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/websocket"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxEmojiLength bounds the bytes of one reaction, enough for the longest
+// emoji ZWJ sequences
+const maxEmojiLength = 64
+
+// ErrInvalidEmoji is returned for reactions that are empty, too long or
+// contain whitespace
+var ErrInvalidEmoji = errors.New("invalid emoji")
+
+// validEmoji checks that a reaction is a short token without whitespace.
+// Any such token is accepted so clients can add custom emoji like ":party:".
+func validEmoji(emoji string) bool {
+	if emoji == "" || len(emoji) > maxEmojiLength {
+		return false
+	}
+	return strings.IndexFunc(emoji, unicode.IsSpace) < 0
+}
+
+// handleReaction adds or removes a reaction over the WebSocket. The content
+// holds the message_id and emoji.
+func (s *ChatService) handleReaction(client *websocket.Client, message *websocket.Message) {
+	content, _ := message.Content.(map[string]interface{})
+	messageID, _ := content["message_id"].(string)
+	emoji, _ := content["emoji"].(string)
+	if message.RoomID == "" || messageID == "" {
+		s.wsService.SendErrorToClient(client, "Room ID and message ID are required")
+		return
+	}
+
+	ctx := db.ContextWithTenant(context.Background(), client.TenantID)
+	var err error
+	if message.Type == "add_reaction" {
+		err = s.AddReaction(ctx, message.RoomID, messageID, client.UserID, emoji)
+	} else {
+		err = s.RemoveReaction(ctx, message.RoomID, messageID, client.UserID, emoji)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotRoomMember):
+			s.wsService.SendErrorToClient(client, "Not a member of this room")
+		case errors.Is(err, ErrMessageNotFound):
+			s.wsService.SendErrorToClient(client, "Message not found")
+		case errors.Is(err, ErrInvalidEmoji):
+			s.wsService.SendErrorToClient(client, "Invalid emoji")
+		default:
+			log.Printf("Failed to update reaction of user %s to message %s: %v", client.UserID, messageID, err)
+			s.wsService.SendErrorToClient(client, "Failed to update reaction")
+		}
+	}
+}
+
+// AddReaction reacts to a message of the room on behalf of a member. Adding
+// a reaction twice has no further effect.
+func (s *ChatService) AddReaction(ctx context.Context, roomID, messageID, userID, emoji string) error {
+	if !validEmoji(emoji) {
+		return ErrInvalidEmoji
+	}
+
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return db.ErrNoTenantContext
+	}
+
+	added := false
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		if _, _, err := memberRole(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+
+		// Tombstones cannot be reacted to
+		var exists bool
+		err := tx.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM messages WHERE id = $1 AND room_id = $2 AND deleted_at IS NULL)
+		`, messageID, roomID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrMessageNotFound
+		}
+
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO message_reactions (message_id, user_id, emoji, tenant_id)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT DO NOTHING
+		`, messageID, userID, emoji, tenantID)
+		added = tag.RowsAffected() > 0
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if added && s.wsService != nil {
+		s.wsService.BroadcastToRoom(roomID, "reaction_added", db.MessageReaction{
+			RoomID:    roomID,
+			MessageID: messageID,
+			UserID:    userID,
+			Emoji:     emoji,
+		}, "")
+	}
+	return nil
+}
+
+// RemoveReaction takes back a member's reaction to a message of the room
+func (s *ChatService) RemoveReaction(ctx context.Context, roomID, messageID, userID, emoji string) error {
+	removed := false
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		if _, _, err := memberRole(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, `
+			DELETE FROM message_reactions mr
+			USING messages m
+			WHERE m.id = mr.message_id AND m.room_id = $1
+			AND mr.message_id = $2 AND mr.user_id = $3 AND mr.emoji = $4
+		`, roomID, messageID, userID, emoji)
+		removed = tag.RowsAffected() > 0
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if removed && s.wsService != nil {
+		s.wsService.BroadcastToRoom(roomID, "reaction_removed", db.MessageReaction{
+			RoomID:    roomID,
+			MessageID: messageID,
+			UserID:    userID,
+			Emoji:     emoji,
+		}, "")
+	}
+	return nil
+}
+
+// attachReactions fills in the reaction counts of messages as seen by a
+// viewer, each message's emoji in the order they were first used
+func attachReactions(ctx context.Context, tx pgx.Tx, messages []db.Message, viewerID string) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(messages))
+	ids := make([]string, len(messages))
+	for i, message := range messages {
+		index[message.ID] = i
+		ids[i] = message.ID
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT message_id, emoji, COUNT(*), bool_or(user_id = $2)
+		FROM message_reactions
+		WHERE message_id = ANY($1)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(created_at), emoji
+	`, ids, viewerID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID string
+		var reaction db.ReactionCount
+		if err := rows.Scan(&messageID, &reaction.Emoji, &reaction.Count, &reaction.ReactedByMe); err != nil {
+			return err
+		}
+		i := index[messageID]
+		messages[i].Reactions = append(messages[i].Reactions, reaction)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,207 @@
+package chat
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/websocket"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrReadReceiptsHidden is returned when a user who hides their own read
+// receipts asks for other members' receipts
+var ErrReadReceiptsHidden = errors.New("read receipts are hidden")
+
+// handleMarkRead lets a client mark a room as read over the WebSocket. The
+// content is the message ID to mark read up to, or empty for the whole room.
+func (s *ChatService) handleMarkRead(client *websocket.Client, message *websocket.Message) {
+	messageID, _ := message.Content.(string)
+	if message.RoomID == "" {
+		s.wsService.SendErrorToClient(client, "Room ID is required")
+		return
+	}
+
+	ctx := db.ContextWithTenant(context.Background(), client.TenantID)
+	if _, err := s.MarkRoomRead(ctx, message.RoomID, client.UserID, messageID); err != nil {
+		switch {
+		case errors.Is(err, ErrNotRoomMember):
+			s.wsService.SendErrorToClient(client, "Not a member of this room")
+		case errors.Is(err, ErrMessageNotFound):
+			s.wsService.SendErrorToClient(client, "Message not found")
+		default:
+			log.Printf("Failed to mark room %s read for user %s: %v", message.RoomID, client.UserID, err)
+			s.wsService.SendErrorToClient(client, "Failed to mark room as read")
+		}
+	}
+}
+
+// MarkRoomRead moves a member's read marker forward to a message of the room,
+// or to the room's last message when messageID is empty. The marker never
+// moves backwards. It returns the marker after the update and, when it moved,
+// sends a read receipt to the room and delivery updates to the senders.
+func (s *ChatService) MarkRoomRead(ctx context.Context, roomID, userID, messageID string) (string, error) {
+	var marker *string
+	var receipt *db.ReadReceipt
+	var hidden bool
+	var status string
+	var changes []statusChange
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		if _, _, err := memberRole(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+		if err := tx.QueryRow(ctx, "SELECT hide_read_receipts FROM users WHERE id = $1", userID).Scan(&hidden); err != nil {
+			return err
+		}
+
+		if messageID == "" {
+			err := tx.QueryRow(ctx, "SELECT last_message_id FROM rooms WHERE id = $1", roomID).Scan(&marker)
+			if err != nil || marker == nil {
+				return err
+			}
+			messageID = *marker
+		} else {
+			var exists bool
+			err := tx.QueryRow(ctx, `
+				SELECT EXISTS(SELECT 1 FROM messages WHERE id = $1 AND room_id = $2)
+			`, messageID, roomID).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return ErrMessageNotFound
+			}
+		}
+
+		var readAt time.Time
+		err := tx.QueryRow(ctx, `
+			UPDATE room_members SET last_read_message_id = $3, last_read_at = NOW()
+			WHERE room_id = $1 AND user_id = $2
+			AND (last_read_message_id IS NULL OR last_read_message_id < $3)
+			RETURNING last_read_at
+		`, roomID, userID, messageID).Scan(&readAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Already read further than this message
+			return tx.QueryRow(ctx, `
+				SELECT last_read_message_id FROM room_members WHERE room_id = $1 AND user_id = $2
+			`, roomID, userID).Scan(&marker)
+		}
+		if err != nil {
+			return err
+		}
+
+		marker = &messageID
+		receipt = &db.ReadReceipt{
+			RoomID:            roomID,
+			UserID:            userID,
+			LastReadMessageID: messageID,
+			ReadAt:            readAt,
+		}
+
+		status, changes, err = markReceiptsRead(ctx, tx, roomID, userID, messageID, nil, hidden, readAt)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The reader's own devices always learn about the new marker, the rest of
+	// the room only when the reader shares receipts
+	if receipt != nil && s.wsService != nil {
+		s.sendStatusUpdates(userID, status, receipt.ReadAt, changes)
+		if hidden {
+			s.wsService.SendToUser(userID, "read_receipt", receipt)
+		} else {
+			s.wsService.BroadcastToRoom(roomID, "read_receipt", receipt, "")
+		}
+	}
+
+	if marker == nil {
+		return "", nil
+	}
+	return *marker, nil
+}
+
+// GetMessageReaders lists the members who have read a message of the room,
+// leaving out its author and members who hide their read receipts
+func (s *ChatService) GetMessageReaders(ctx context.Context, roomID, messageID, userID string) ([]db.MessageReader, error) {
+	readers := []db.MessageReader{}
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		if _, _, err := memberRole(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+
+		var hidden bool
+		if err := tx.QueryRow(ctx, "SELECT hide_read_receipts FROM users WHERE id = $1", userID).Scan(&hidden); err != nil {
+			return err
+		}
+		if hidden {
+			return ErrReadReceiptsHidden
+		}
+
+		var authorID string
+		err := tx.QueryRow(ctx, "SELECT user_id FROM messages WHERE id = $1 AND room_id = $2", messageID, roomID).Scan(&authorID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, `
+			SELECT rm.user_id, u.name, rm.last_read_at
+			FROM room_members rm
+			JOIN users u ON u.id = rm.user_id
+			WHERE rm.room_id = $1
+			AND rm.last_read_message_id >= $2
+			AND rm.user_id <> $3
+			AND NOT u.hide_read_receipts
+			ORDER BY rm.last_read_at
+		`, roomID, messageID, authorID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var reader db.MessageReader
+			var readAt *time.Time
+			if err := rows.Scan(&reader.UserID, &reader.Name, &readAt); err != nil {
+				return err
+			}
+			if readAt != nil {
+				reader.ReadAt = *readAt
+			}
+			readers = append(readers, reader)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return readers, nil
+}
+
+// GetChatSettings returns a user's chat privacy settings
+func (s *ChatService) GetChatSettings(ctx context.Context, userID string) (*db.ChatSettings, error) {
+	var settings db.ChatSettings
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, "SELECT hide_read_receipts FROM users WHERE id = $1", userID).Scan(&settings.HideReadReceipts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// UpdateChatSettings changes a user's chat privacy settings
+func (s *ChatService) UpdateChatSettings(ctx context.Context, userID string, settings db.ChatSettings) error {
+	return db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "UPDATE users SET hide_read_receipts = $1 WHERE id = $2", settings.HideReadReceipts, userID)
+		return err
+	})
+}
@@ -0,0 +1,168 @@
+package chat
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// replySnippetLength is how many characters of a quoted message a reply
+// preview shows
+const replySnippetLength = 100
+
+// ErrInvalidReply is returned when a reply quotes a message that is not part
+// of the same room or has been deleted
+var ErrInvalidReply = errors.New("reply must quote a message of the same room")
+
+// checkReplyTarget verifies that a quoted message belongs to the room and
+// still exists
+func checkReplyTarget(ctx context.Context, tx pgx.Tx, roomID, replyToID string) error {
+	var exists bool
+	err := tx.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM messages WHERE id = $1 AND room_id = $2 AND deleted_at IS NULL)
+	`, replyToID, roomID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrInvalidReply
+	}
+	return nil
+}
+
+// attachReplyPreviews fills in a preview of the message each reply quotes
+func attachReplyPreviews(ctx context.Context, tx pgx.Tx, messages []db.Message) error {
+	var ids []string
+	for _, message := range messages {
+		if message.ReplyToID != nil {
+			ids = append(ids, *message.ReplyToID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT m.id, m.user_id, u.name, LEFT(m.content, $2), m.deleted_at IS NOT NULL
+		FROM messages m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.id = ANY($1)
+	`, ids, replySnippetLength)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	previews := make(map[string]*db.MessagePreview)
+	for rows.Next() {
+		var preview db.MessagePreview
+		if err := rows.Scan(&preview.ID, &preview.UserID, &preview.UserName, &preview.Snippet, &preview.Deleted); err != nil {
+			return err
+		}
+		previews[preview.ID] = &preview
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range messages {
+		if messages[i].ReplyToID != nil {
+			messages[i].ReplyTo = previews[*messages[i].ReplyToID]
+		}
+	}
+	return nil
+}
+
+// attachMessageDetails fills in the reply previews, reactions, attachments
+// and listened state of messages as seen by a viewer
+func attachMessageDetails(ctx context.Context, tx pgx.Tx, messages []db.Message, viewerID string) error {
+	if err := attachReplyPreviews(ctx, tx, messages); err != nil {
+		return err
+	}
+	if err := attachReactions(ctx, tx, messages, viewerID); err != nil {
+		return err
+	}
+	if err := attachAttachments(ctx, tx, messages, viewerID); err != nil {
+		return err
+	}
+	return attachListened(ctx, tx, messages, viewerID)
+}
+
+// GetMessageWindow returns a message of the room with up to before older and
+// after newer messages around it, newest first, for jumping to a quoted
+// message. The surrounding messages come from the same thread, or the main
+// timeline for top-level messages. It also reports whether there are more
+// messages on either side.
+func (s *ChatService) GetMessageWindow(ctx context.Context, roomID, viewerID, messageID string, before, after int) ([]db.Message, bool, bool, error) {
+	var messages []db.Message
+	var hasOlder, hasNewer bool
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		var target db.Message
+		err := scanMessage(tx.QueryRow(ctx, `
+			SELECT `+messageColumns+`
+			FROM messages m
+			WHERE m.id = $1 AND m.room_id = $2 AND `+visibleTo("$3")+`
+		`, messageID, roomID, viewerID), &target)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		// Get one extra on each side to determine if there are more
+		rows, err := tx.Query(ctx, `
+			SELECT `+messageColumns+`
+			FROM messages m
+			WHERE m.room_id = $1 AND m.id > $2 AND `+visibleTo("$4")+`
+			AND m.thread_root_id IS NOT DISTINCT FROM $5
+			ORDER BY m.id ASC
+			LIMIT $3
+		`, roomID, messageID, after+1, viewerID, target.ThreadRootID)
+		if err != nil {
+			return err
+		}
+		newer, err := scanMessages(rows)
+		if err != nil {
+			return err
+		}
+		if hasNewer = len(newer) > after; hasNewer {
+			newer = newer[:after]
+		}
+
+		rows, err = tx.Query(ctx, `
+			SELECT `+messageColumns+`
+			FROM messages m
+			WHERE m.room_id = $1 AND m.id < $2 AND `+visibleTo("$4")+`
+			AND m.thread_root_id IS NOT DISTINCT FROM $5
+			ORDER BY m.id DESC
+			LIMIT $3
+		`, roomID, messageID, before+1, viewerID, target.ThreadRootID)
+		if err != nil {
+			return err
+		}
+		older, err := scanMessages(rows)
+		if err != nil {
+			return err
+		}
+		if hasOlder = len(older) > before; hasOlder {
+			older = older[:before]
+		}
+
+		messages = make([]db.Message, 0, len(newer)+1+len(older))
+		for i := len(newer) - 1; i >= 0; i-- {
+			messages = append(messages, newer[i])
+		}
+		messages = append(messages, target)
+		messages = append(messages, older...)
+
+		return attachMessageDetails(ctx, tx, messages, viewerID)
+	})
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	return messages, hasOlder, hasNewer, nil
+}
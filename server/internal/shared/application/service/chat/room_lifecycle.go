@@ -0,0 +1,280 @@
+package chat
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	MessageTypeUser   = "user"
+	MessageTypeVoice  = "voice"
+	MessageTypeSystem = "system"
+)
+
+// userName returns a user's display name within a transaction
+func userName(ctx context.Context, tx pgx.Tx, userID string) (string, error) {
+	var name string
+	err := tx.QueryRow(ctx, "SELECT name FROM users WHERE id = $1", userID).Scan(&name)
+	return name, err
+}
+
+// postSystemMessage records a room change in the room's timeline. The text
+// follows the name of the member who made the change. System messages are
+// not metered and do not notify anyone.
+func (s *ChatService) postSystemMessage(ctx context.Context, tx pgx.Tx, roomID, actorID, text string) (*db.Message, error) {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return nil, db.ErrNoTenantContext
+	}
+
+	actorName, err := userName(ctx, tx, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	message := db.Message{
+		ID:      s.generateULID(),
+		RoomID:  roomID,
+		UserID:  actorID,
+		Type:    MessageTypeSystem,
+		Content: actorName + " " + text,
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO messages (id, tenant_id, room_id, user_id, type, content)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING tenant_id, sent_at
+	`, message.ID, tenantID, message.RoomID, message.UserID, message.Type, message.Content).Scan(&message.TenantID, &message.SentAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := touchRoom(ctx, tx, &message); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// broadcastRoomChange sends a room event followed by the system message
+// that records it
+func (s *ChatService) broadcastRoomChange(roomID, eventType string, content interface{}, message *db.Message) {
+	if s.wsService == nil {
+		return
+	}
+	s.wsService.BroadcastToRoom(roomID, eventType, content, "")
+	if message != nil {
+		s.wsService.BroadcastMessage(roomID, message)
+	}
+}
+
+// UpdateRoom changes the name, description, avatar or topic of a group room
+func (s *ChatService) UpdateRoom(ctx context.Context, roomID, actorID string, req db.UpdateRoomRequest) (*db.Room, error) {
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		return nil, fmt.Errorf("room name cannot be empty")
+	}
+
+	var room db.Room
+	var message *db.Message
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		err := scanRoom(tx.QueryRow(ctx, "SELECT "+roomColumns+" FROM rooms r WHERE r.id = $1 FOR UPDATE", roomID), &room)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("room not found")
+		}
+		if err != nil {
+			return err
+		}
+		if room.Type != "group" {
+			return fmt.Errorf("only group rooms can be edited")
+		}
+
+		// Describe each change for the timeline
+		var changes []string
+		if req.Name != nil && strings.TrimSpace(*req.Name) != room.Name {
+			room.Name = strings.TrimSpace(*req.Name)
+			changes = append(changes, fmt.Sprintf("renamed the room to %q", room.Name))
+		}
+		if req.Description != nil && *req.Description != room.Description {
+			room.Description = *req.Description
+			changes = append(changes, "changed the room description")
+		}
+		if req.AvatarURL != nil && *req.AvatarURL != room.AvatarURL {
+			room.AvatarURL = *req.AvatarURL
+			changes = append(changes, "changed the room avatar")
+		}
+		if req.Topic != nil && *req.Topic != room.Topic {
+			room.Topic = *req.Topic
+			if room.Topic == "" {
+				changes = append(changes, "cleared the topic")
+			} else {
+				changes = append(changes, fmt.Sprintf("set the topic to %q", room.Topic))
+			}
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE rooms SET name = $1, description = $2, avatar_url = $3, topic = $4
+			WHERE id = $5
+		`, room.Name, room.Description, room.AvatarURL, room.Topic, roomID)
+		if err != nil {
+			return err
+		}
+
+		message, err = s.postSystemMessage(ctx, tx, roomID, actorID, strings.Join(changes, ", "))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if message != nil {
+		s.broadcastRoomChange(roomID, "room_updated", room, message)
+	}
+	return &room, nil
+}
+
+// LeaveRoom removes a user from a group room at their own request. When the
+// owner leaves, ownership passes to the longest-standing admin, or member if
+// there are no admins. The room is deleted when its last member leaves.
+func (s *ChatService) LeaveRoom(ctx context.Context, roomID, userID string) error {
+	var message *db.Message
+	var newOwnerID string
+	deleted := false
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		role, roomType, err := memberRole(ctx, tx, roomID, userID)
+		if err != nil {
+			return err
+		}
+		if roomType != "group" {
+			return fmt.Errorf("can only leave group rooms")
+		}
+
+		// Post before leaving, the author of a system message must exist
+		message, err = s.postSystemMessage(ctx, tx, roomID, userID, "left the room")
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM room_members WHERE room_id = $1 AND user_id = $2", roomID, userID)
+		if err != nil {
+			return err
+		}
+		if err := deleteReceipts(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+		if err := deleteThreadFollows(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+		if role != RoomRoleOwner {
+			return nil
+		}
+
+		err = tx.QueryRow(ctx, `
+			SELECT user_id FROM room_members
+			WHERE room_id = $1
+			ORDER BY CASE role WHEN 'admin' THEN 0 ELSE 1 END, joined_at, user_id
+			LIMIT 1
+		`, roomID).Scan(&newOwnerID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			deleted = true
+			_, err = tx.Exec(ctx, "DELETE FROM rooms WHERE id = $1", roomID)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE room_members SET role = $1 WHERE room_id = $2 AND user_id = $3", RoomRoleOwner, roomID, newOwnerID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.wsService == nil {
+		return nil
+	}
+	if deleted {
+		s.wsService.CloseRoom(roomID)
+		s.wsService.SendToUser(userID, "room_deleted", map[string]string{"room_id": roomID})
+		return nil
+	}
+
+	event := map[string]string{
+		"room_id": roomID,
+		"user_id": userID,
+	}
+	s.wsService.UnsubscribeUser(userID, roomID)
+	s.wsService.SendToUser(userID, "member_left", event)
+	s.broadcastRoomChange(roomID, "member_left", event, message)
+	if newOwnerID != "" {
+		s.broadcastRoleChange(roomID, newOwnerID, RoomRoleOwner)
+	}
+	return nil
+}
+
+// DeleteRoom deletes a group room with its members, messages and pins
+func (s *ChatService) DeleteRoom(ctx context.Context, roomID string) error {
+	var memberIDs []string
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		var roomType string
+		err := tx.QueryRow(ctx, "SELECT type FROM rooms WHERE id = $1 FOR UPDATE", roomID).Scan(&roomType)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("room not found")
+		}
+		if err != nil {
+			return err
+		}
+		if roomType != "group" {
+			return fmt.Errorf("only group rooms can be deleted")
+		}
+
+		rows, err := tx.Query(ctx, "SELECT user_id FROM room_members WHERE room_id = $1", roomID)
+		if err != nil {
+			return err
+		}
+		memberIDs, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM rooms WHERE id = $1", roomID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Members are told directly since not all of them are subscribed to the room
+	if s.wsService != nil {
+		s.wsService.CloseRoom(roomID)
+		for _, memberID := range memberIDs {
+			s.wsService.SendToUser(memberID, "room_deleted", map[string]string{"room_id": roomID})
+		}
+	}
+	return nil
+}
+
+// SetRoomArchived archives or unarchives a room for one member. Archiving
+// only hides the room from that member's room list.
+func (s *ChatService) SetRoomArchived(ctx context.Context, roomID, userID string, archived bool) error {
+	return db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			UPDATE room_members
+			SET archived_at = CASE WHEN $3::boolean THEN COALESCE(archived_at, NOW()) END
+			WHERE room_id = $1 AND user_id = $2
+		`, roomID, userID, archived)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNotRoomMember
+		}
+		return nil
+	})
+}
@@ -0,0 +1,174 @@
+package chat
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/user"
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidCursor is returned for room list cursors that were not issued by
+// GetUserChatRooms
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// touchRoom makes a new message the room's latest activity
+func touchRoom(ctx context.Context, tx pgx.Tx, message *db.Message) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE rooms SET last_message_id = $1, last_activity_at = $2
+		WHERE id = $3 AND (last_message_id IS NULL OR last_message_id < $1)
+	`, message.ID, message.SentAt, message.RoomID)
+	return err
+}
+
+// encodeRoomCursor makes an opaque cursor from the position of the last room
+// of a page
+func encodeRoomCursor(lastActivityAt time.Time, roomID string) string {
+	raw := lastActivityAt.UTC().Format(time.RFC3339Nano) + "|" + roomID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeRoomCursor reads a cursor made by encodeRoomCursor
+func decodeRoomCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	at, roomID, found := strings.Cut(string(raw), "|")
+	if !found {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	lastActivityAt, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return lastActivityAt, roomID, nil
+}
+
+// GetUserChatRooms lists a user's rooms, either the archived ones or the rest,
+// most recently active first. Each room comes with its last message, the
+// user's unread count and, for direct rooms, the other participant. Pass the
+// returned cursor to get the next page; it is empty on the last page.
+func (s *ChatService) GetUserChatRooms(ctx context.Context, userID string, archived bool, cursor string, limit int) ([]db.RoomSummary, string, error) {
+	var afterActivity *time.Time
+	var afterRoomID *string
+	if cursor != "" {
+		at, roomID, err := decodeRoomCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		afterActivity, afterRoomID = &at, &roomID
+	}
+
+	rooms := []db.RoomSummary{}
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		// Unread messages are other members' messages after the read marker,
+		// leaving out deleted messages, thread replies and messages the user
+		// hid. The preview is the latest top-level message the user has not
+		// hidden.
+		rows, err := tx.Query(ctx, `
+			SELECT `+roomColumns+`, r.last_activity_at,
+				lm.id, lm.tenant_id, lm.room_id, lm.user_id, lm.type, lm.content, lm.sent_at, lm.edited_at, lm.deleted_at, lm.deleted_by, lm.reply_to_id, lm.reply_count, lm.last_reply_at,
+				(
+					SELECT COUNT(*) FROM messages um
+					WHERE um.room_id = r.id
+					AND um.id > COALESCE(rm.last_read_message_id, '')
+					AND um.user_id <> rm.user_id
+					AND um.type <> 'system'
+					AND um.deleted_at IS NULL
+					AND um.thread_root_id IS NULL
+					AND NOT EXISTS (SELECT 1 FROM message_hides h WHERE h.message_id = um.id AND h.user_id = rm.user_id)
+				),
+				p.id, p.name, p.deleted
+			FROM room_members rm
+			JOIN rooms r ON r.id = rm.room_id
+			LEFT JOIN LATERAL (
+				SELECT m.* FROM messages m
+				WHERE m.room_id = r.id AND m.thread_root_id IS NULL AND `+visibleTo("rm.user_id")+`
+				ORDER BY m.id DESC
+				LIMIT 1
+			) lm ON TRUE
+			LEFT JOIN LATERAL (
+				SELECT u.id, CASE WHEN u.deleted_at IS NULL THEN u.name ELSE $6 END AS name, u.deleted_at IS NOT NULL AS deleted
+				FROM room_members om
+				JOIN users u ON u.id = om.user_id
+				WHERE r.type = 'direct' AND om.room_id = r.id AND om.user_id <> rm.user_id
+				LIMIT 1
+			) p ON TRUE
+			WHERE rm.user_id = $1
+			AND (rm.archived_at IS NOT NULL) = $2
+			AND ($3::timestamp IS NULL OR (r.last_activity_at, r.id) < ($3::timestamp, $4::uuid))
+			ORDER BY r.last_activity_at DESC, r.id DESC
+			LIMIT $5
+		`, userID, archived, afterActivity, afterRoomID, limit+1, user.DeletedUserName) // Get one extra to determine if there are more pages
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var room db.RoomSummary
+			var lastID, lastTenantID, lastRoomID, lastUserID, lastType, lastContent *string
+			var lastSentAt, lastEditedAt, lastDeletedAt, lastReplyAt *time.Time
+			var lastReplyCount *int
+			var lastDeletedBy, lastReplyToID *string
+			var participantID, participantName *string
+			var participantDeleted *bool
+			err := rows.Scan(
+				&room.ID, &room.TenantID, &room.Name, &room.Type, &room.Description, &room.AvatarURL, &room.Topic, &room.CreatedAt,
+				&room.LastActivityAt,
+				&lastID, &lastTenantID, &lastRoomID, &lastUserID, &lastType, &lastContent, &lastSentAt, &lastEditedAt, &lastDeletedAt, &lastDeletedBy, &lastReplyToID, &lastReplyCount, &lastReplyAt,
+				&room.UnreadCount,
+				&participantID, &participantName, &participantDeleted,
+			)
+			if err != nil {
+				return err
+			}
+
+			room.Archived = archived
+			if lastID != nil {
+				room.LastMessage = &db.Message{
+					ID:          *lastID,
+					TenantID:    *lastTenantID,
+					RoomID:      *lastRoomID,
+					UserID:      *lastUserID,
+					Type:        *lastType,
+					Content:     *lastContent,
+					SentAt:      *lastSentAt,
+					EditedAt:    lastEditedAt,
+					DeletedAt:   lastDeletedAt,
+					DeletedBy:   lastDeletedBy,
+					ReplyToID:   lastReplyToID,
+					ReplyCount:  *lastReplyCount,
+					LastReplyAt: lastReplyAt,
+				}
+			}
+			if participantID != nil {
+				room.Participant = &db.PublicUser{
+					ID:      *participantID,
+					Name:    *participantName,
+					Deleted: *participantDeleted,
+				}
+			}
+			rooms = append(rooms, room)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if len(rooms) > limit {
+		rooms = rooms[:limit]
+		last := rooms[limit-1]
+		nextCursor = encodeRoomCursor(last.LastActivityAt, last.ID)
+	}
+
+	return rooms, nextCursor, nil
+}
@@ -0,0 +1,357 @@
+package chat
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	RoomRoleOwner  = "owner"
+	RoomRoleAdmin  = "admin"
+	RoomRoleMember = "member"
+)
+
+// Room actions that depend on the member's role
+const (
+	ActionInvite               = "invite"
+	ActionRemove               = "remove"
+	ActionEdit                 = "edit"
+	ActionDelete               = "delete"
+	ActionPin                  = "pin"
+	ActionDeleteOthersMessages = "delete_others_messages"
+	ActionViewRevisions        = "view_revisions"
+	ActionMentionRoom          = "mention_room"
+	ActionManageRoles          = "manage_roles"
+)
+
+var (
+	ErrNotRoomMember   = errors.New("user is not a member of this room")
+	ErrMemberNotFound  = errors.New("member not found in this room")
+	ErrRoomPermission  = errors.New("insufficient room role for this action")
+	ErrMessageNotFound = errors.New("message not found")
+)
+
+// roomRoleRank orders room roles by how much of the room they control
+var roomRoleRank = map[string]int{
+	RoomRoleMember: 0,
+	RoomRoleAdmin:  1,
+	RoomRoleOwner:  2,
+}
+
+// groupPermissions lists the lowest role allowed to perform each action in
+// a group room
+var groupPermissions = map[string]string{
+	ActionInvite:               RoomRoleAdmin,
+	ActionRemove:               RoomRoleAdmin,
+	ActionEdit:                 RoomRoleAdmin,
+	ActionPin:                  RoomRoleAdmin,
+	ActionDeleteOthersMessages: RoomRoleAdmin,
+	ActionViewRevisions:        RoomRoleAdmin,
+	ActionMentionRoom:          RoomRoleAdmin,
+	ActionManageRoles:          RoomRoleOwner,
+	ActionDelete:               RoomRoleOwner,
+}
+
+// directPermissions lists the actions both participants of a direct room may
+// perform; everything else is unavailable in direct rooms
+var directPermissions = map[string]bool{
+	ActionPin: true,
+}
+
+// RoomRolePermits reports whether a role may perform an action in a room of
+// the given type
+func RoomRolePermits(roomType, role, action string) bool {
+	if roomType == "direct" {
+		return directPermissions[action]
+	}
+
+	minRole, ok := groupPermissions[action]
+	if !ok {
+		return false
+	}
+	return roomRoleRank[role] >= roomRoleRank[minRole]
+}
+
+// memberRole returns a user's role and the room's type within a transaction
+func memberRole(ctx context.Context, tx pgx.Tx, roomID, userID string) (string, string, error) {
+	var role, roomType string
+	err := tx.QueryRow(ctx, `
+		SELECT rm.role, r.type
+		FROM room_members rm
+		JOIN rooms r ON r.id = rm.room_id
+		WHERE rm.room_id = $1 AND rm.user_id = $2
+	`, roomID, userID).Scan(&role, &roomType)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", ErrNotRoomMember
+	}
+	return role, roomType, err
+}
+
+// GetMemberRole returns a user's role in a room
+func (s *ChatService) GetMemberRole(ctx context.Context, roomID, userID string) (string, error) {
+	var role string
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		role, _, err = memberRole(ctx, tx, roomID, userID)
+		return err
+	})
+	return role, err
+}
+
+// AuthorizeRoomAction returns ErrNotRoomMember or ErrRoomPermission unless
+// the user may perform the action in the room
+func (s *ChatService) AuthorizeRoomAction(ctx context.Context, roomID, userID, action string) error {
+	return db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		role, roomType, err := memberRole(ctx, tx, roomID, userID)
+		if err != nil {
+			return err
+		}
+		if !RoomRolePermits(roomType, role, action) {
+			return ErrRoomPermission
+		}
+		return nil
+	})
+}
+
+// AuthorizeMemberAction is AuthorizeRoomAction for actions aimed at another
+// member, who must also rank below the acting user. Nobody can act on the
+// owner, and admins cannot act on fellow admins.
+func (s *ChatService) AuthorizeMemberAction(ctx context.Context, roomID, actorID, targetID, action string) error {
+	return db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		actorRole, roomType, err := memberRole(ctx, tx, roomID, actorID)
+		if err != nil {
+			return err
+		}
+		if !RoomRolePermits(roomType, actorRole, action) {
+			return ErrRoomPermission
+		}
+
+		targetRole, _, err := memberRole(ctx, tx, roomID, targetID)
+		if errors.Is(err, ErrNotRoomMember) {
+			return ErrMemberNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if roomRoleRank[actorRole] <= roomRoleRank[targetRole] {
+			return ErrRoomPermission
+		}
+		return nil
+	})
+}
+
+// GetRoomMembersWithRoles lists the members of a room with their roles,
+// owner first
+func (s *ChatService) GetRoomMembersWithRoles(ctx context.Context, roomID string) ([]db.RoomMember, error) {
+	members := []db.RoomMember{}
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT rm.room_id, rm.user_id, rm.role, u.name
+			FROM room_members rm
+			JOIN users u ON u.id = rm.user_id
+			WHERE rm.room_id = $1
+			ORDER BY CASE rm.role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END, u.name
+		`, roomID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var member db.RoomMember
+			if err := rows.Scan(&member.RoomID, &member.UserID, &member.Role, &member.Name); err != nil {
+				return err
+			}
+			members = append(members, member)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// SetMemberRole promotes a member to admin or demotes an admin to member.
+// Ownership only changes hands through TransferOwnership.
+func (s *ChatService) SetMemberRole(ctx context.Context, roomID, userID, role string) error {
+	if role != RoomRoleAdmin && role != RoomRoleMember {
+		return fmt.Errorf("role must be %s or %s", RoomRoleAdmin, RoomRoleMember)
+	}
+
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		currentRole, roomType, err := memberRole(ctx, tx, roomID, userID)
+		if errors.Is(err, ErrNotRoomMember) {
+			return ErrMemberNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if roomType != "group" {
+			return fmt.Errorf("roles only apply to group rooms")
+		}
+		if currentRole == RoomRoleOwner {
+			return fmt.Errorf("transfer ownership to change the owner's role")
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE room_members SET role = $1 WHERE room_id = $2 AND user_id = $3", role, roomID, userID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.broadcastRoleChange(roomID, userID, role)
+	return nil
+}
+
+// TransferOwnership makes another member the owner of a group room. The
+// previous owner stays in the room as an admin.
+func (s *ChatService) TransferOwnership(ctx context.Context, roomID, ownerID, newOwnerID string) error {
+	if ownerID == newOwnerID {
+		return fmt.Errorf("user already owns this room")
+	}
+
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		role, roomType, err := memberRole(ctx, tx, roomID, ownerID)
+		if err != nil {
+			return err
+		}
+		if roomType != "group" || role != RoomRoleOwner {
+			return ErrRoomPermission
+		}
+		if _, _, err := memberRole(ctx, tx, roomID, newOwnerID); errors.Is(err, ErrNotRoomMember) {
+			return ErrMemberNotFound
+		} else if err != nil {
+			return err
+		}
+
+		// Demote first, the unique owner index allows one owner at a time
+		_, err = tx.Exec(ctx, "UPDATE room_members SET role = $1 WHERE room_id = $2 AND user_id = $3", RoomRoleAdmin, roomID, ownerID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "UPDATE room_members SET role = $1 WHERE room_id = $2 AND user_id = $3", RoomRoleOwner, roomID, newOwnerID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.broadcastRoleChange(roomID, ownerID, RoomRoleAdmin)
+	s.broadcastRoleChange(roomID, newOwnerID, RoomRoleOwner)
+	return nil
+}
+
+// broadcastRoleChange tells room subscribers that a member's role changed
+func (s *ChatService) broadcastRoleChange(roomID, userID, role string) {
+	if s.wsService == nil {
+		return
+	}
+	s.wsService.BroadcastToRoom(roomID, "member_role_changed", map[string]string{
+		"room_id": roomID,
+		"user_id": userID,
+		"role":    role,
+	}, "")
+}
+
+// PinMessage pins a message of the room
+func (s *ChatService) PinMessage(ctx context.Context, roomID, messageID, userID string) (*db.PinnedMessage, error) {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return nil, db.ErrNoTenantContext
+	}
+
+	var pinned db.PinnedMessage
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		err := scanMessage(tx.QueryRow(ctx, `
+			SELECT `+messageColumns+`
+			FROM messages m WHERE m.id = $1 AND m.room_id = $2 AND m.deleted_at IS NULL
+		`, messageID, roomID), &pinned.Message)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRow(ctx, `
+			INSERT INTO pinned_messages (room_id, message_id, tenant_id, pinned_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (room_id, message_id) DO UPDATE SET pinned_by = EXCLUDED.pinned_by, pinned_at = NOW()
+			RETURNING pinned_by, pinned_at
+		`, roomID, messageID, tenantID, userID).Scan(&pinned.PinnedBy, &pinned.PinnedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.wsService != nil {
+		s.wsService.BroadcastToRoom(roomID, "message_pinned", pinned, "")
+	}
+	return &pinned, nil
+}
+
+// UnpinMessage removes a pin from the room
+func (s *ChatService) UnpinMessage(ctx context.Context, roomID, messageID string) error {
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "DELETE FROM pinned_messages WHERE room_id = $1 AND message_id = $2", roomID, messageID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrMessageNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.wsService != nil {
+		s.wsService.BroadcastToRoom(roomID, "message_unpinned", map[string]string{
+			"room_id":    roomID,
+			"message_id": messageID,
+		}, "")
+	}
+	return nil
+}
+
+// GetPinnedMessages lists the pinned messages of a room, most recently pinned first
+func (s *ChatService) GetPinnedMessages(ctx context.Context, roomID string) ([]db.PinnedMessage, error) {
+	pins := []db.PinnedMessage{}
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT `+messageColumns+`, p.pinned_by, p.pinned_at
+			FROM pinned_messages p
+			JOIN messages m ON m.id = p.message_id
+			WHERE p.room_id = $1
+			ORDER BY p.pinned_at DESC
+		`, roomID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var pin db.PinnedMessage
+			if err := scanMessage(rows, &pin.Message, &pin.PinnedBy, &pin.PinnedAt); err != nil {
+				return err
+			}
+			pins = append(pins, pin)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pins, nil
+}
@@ -0,0 +1,221 @@
+package chat
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"context"
+	"encoding/base64"
+	"errors"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrEmptySearch is returned for searches without any words to look for
+var ErrEmptySearch = errors.New("search query is empty")
+
+// defaultSearchLanguage is used when a tenant's settings cannot be loaded
+const defaultSearchLanguage = "english"
+
+// Snippet highlights are marked with control characters by ts_headline and
+// only turned into tags after the rest of the snippet has been escaped
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// SearchFilter narrows a message search. Empty fields do not filter.
+type SearchFilter struct {
+	RoomID     string
+	AuthorID   string
+	From       *time.Time // inclusive
+	To         *time.Time // exclusive
+	MentionsMe bool
+	// HasAttachment keeps only messages with (true) or without (false)
+	// attachments
+	HasAttachment *bool
+}
+
+// searchLanguage is the text search configuration new messages of a tenant
+// are indexed with and searches of the tenant are parsed with
+func (s *ChatService) searchLanguage(tenantID string) string {
+	if s.settingsService == nil {
+		return defaultSearchLanguage
+	}
+	settings, err := s.settingsService.GetSettings(tenantID)
+	if err != nil {
+		log.Printf("Failed to load settings of tenant %s, searching in %s: %v", tenantID, defaultSearchLanguage, err)
+		return defaultSearchLanguage
+	}
+	if settings.SearchLanguage == "" {
+		return defaultSearchLanguage
+	}
+	return settings.SearchLanguage
+}
+
+// encodeSearchCursor makes an opaque cursor from the position of the last
+// result of a page. Ranks are real in Postgres, so they round-trip as float32.
+func encodeSearchCursor(rank float32, messageID string) string {
+	raw := strconv.FormatFloat(float64(rank), 'g', -1, 32) + "|" + messageID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeSearchCursor reads a cursor made by encodeSearchCursor
+func decodeSearchCursor(cursor string) (float32, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	r, messageID, found := strings.Cut(string(raw), "|")
+	if !found || messageID == "" {
+		return 0, "", ErrInvalidCursor
+	}
+	rank, err := strconv.ParseFloat(r, 32)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	return float32(rank), messageID, nil
+}
+
+// highlight escapes a snippet for HTML and marks its matched words
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, highlightStart, "<mark>")
+	return strings.ReplaceAll(snippet, highlightStop, "</mark>")
+}
+
+// SearchMessages finds the messages of the user's rooms that match a web
+// search style query ("quoted phrases", or, -excluded), best matches first.
+// Deleted messages, messages the user hid and system messages are never
+// returned. Pass the returned cursor to get the next page; it is empty on
+// the last page.
+func (s *ChatService) SearchMessages(ctx context.Context, userID, query string, filter SearchFilter, cursor string, limit int) ([]db.SearchResult, string, error) {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return nil, "", db.ErrNoTenantContext
+	}
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, "", ErrEmptySearch
+	}
+
+	var afterRank *float32
+	var afterID *string
+	if cursor != "" {
+		rank, messageID, err := decodeSearchCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		afterRank, afterID = &rank, &messageID
+	}
+
+	var roomID, authorID *string
+	if filter.RoomID != "" {
+		roomID = &filter.RoomID
+	}
+	if filter.AuthorID != "" {
+		authorID = &filter.AuthorID
+	}
+
+	// sent_at is stored in UTC without a time zone
+	var from, to *time.Time
+	if filter.From != nil {
+		t := filter.From.UTC()
+		from = &t
+	}
+	if filter.To != nil {
+		t := filter.To.UTC()
+		to = &t
+	}
+
+	language := s.searchLanguage(tenantID)
+	headlineOptions := "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MaxWords=35, MinWords=15, MaxFragments=2"
+
+	results := []db.SearchResult{}
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		if roomID != nil {
+			if _, _, err := memberRole(ctx, tx, *roomID, userID); err != nil {
+				return err
+			}
+		}
+
+		// Matches are ranked first and only the page's snippets are built,
+		// as ts_headline works on the whole content of a message
+		rows, err := tx.Query(ctx, `
+			WITH hits AS (
+				SELECT m.id, ts_rank(m.search_vector, q.query) AS rank, q.query
+				FROM messages m
+				CROSS JOIN websearch_to_tsquery($2::regconfig, $3) AS q(query)
+				JOIN room_members rm ON rm.room_id = m.room_id AND rm.user_id = $1
+				WHERE m.search_vector @@ q.query
+				AND m.type = 'user'
+				AND m.deleted_at IS NULL
+				AND `+visibleTo("$1")+`
+				AND ($4::uuid IS NULL OR m.room_id = $4)
+				AND ($5::uuid IS NULL OR m.user_id = $5)
+				AND ($6::timestamp IS NULL OR m.sent_at >= $6)
+				AND ($7::timestamp IS NULL OR m.sent_at < $7)
+				AND (NOT $8 OR EXISTS (
+					SELECT 1 FROM message_mentions mm WHERE mm.message_id = m.id AND mm.user_id = $1
+				))
+				AND ($14::boolean IS NULL OR EXISTS (
+					SELECT 1 FROM attachments a WHERE a.message_id = m.id
+				) = $14)
+				AND ($9::real IS NULL OR (ts_rank(m.search_vector, q.query), m.id) < ($9::real, $10))
+				ORDER BY rank DESC, m.id DESC
+				LIMIT $11
+			)
+			SELECT `+messageColumns+`,
+				ts_headline($2::regconfig, translate(m.content, $12, ''), hits.query, $13),
+				hits.rank
+			FROM hits
+			JOIN messages m ON m.id = hits.id
+			ORDER BY hits.rank DESC, m.id DESC
+		`, userID, language, query, roomID, authorID, from, to, filter.MentionsMe,
+			afterRank, afterID, limit+1, highlightStart+highlightStop, headlineOptions, filter.HasAttachment) // Get one extra to determine if there are more pages
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var result db.SearchResult
+			if err := scanMessage(rows, &result.Message, &result.Snippet, &result.Rank); err != nil {
+				return err
+			}
+			result.Snippet = highlight(result.Snippet)
+			results = append(results, result)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		messages := make([]db.Message, len(results))
+		for i := range results {
+			messages[i] = results[i].Message
+		}
+		if err := attachMessageDetails(ctx, tx, messages, userID); err != nil {
+			return err
+		}
+		for i := range results {
+			results[i].Message = messages[i]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if len(results) > limit {
+		results = results[:limit]
+		last := results[limit-1]
+		nextCursor = encodeSearchCursor(last.Rank, last.Message.ID)
+	}
+
+	return results, nextCursor, nil
+}
@@ -0,0 +1,348 @@
+package chat
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/notification"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidThread is returned when a thread reply's root is not a
+// top-level message of the same room, or has been deleted
+var ErrInvalidThread = errors.New("thread root must be a top-level message of the same room")
+
+// checkThreadRoot verifies that a message can start or continue a thread and
+// locks it so reply counts stay consistent
+func checkThreadRoot(ctx context.Context, tx pgx.Tx, roomID, rootID string) error {
+	var id string
+	err := tx.QueryRow(ctx, `
+		SELECT id FROM messages
+		WHERE id = $1 AND room_id = $2 AND thread_root_id IS NULL AND deleted_at IS NULL AND type <> 'system'
+		FOR UPDATE
+	`, rootID, roomID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidThread
+	}
+	return err
+}
+
+// addThreadReply counts a new reply on its root and makes the replier follow
+// the thread, as well as the root's author on the first reply. It returns
+// the updated thread and its followers.
+func addThreadReply(ctx context.Context, tx pgx.Tx, message *db.Message) (*db.ThreadUpdate, []string, error) {
+	update := db.ThreadUpdate{
+		RoomID:       message.RoomID,
+		ThreadRootID: *message.ThreadRootID,
+	}
+	var rootAuthorID string
+	err := tx.QueryRow(ctx, `
+		UPDATE messages SET reply_count = reply_count + 1, last_reply_at = $2
+		WHERE id = $1
+		RETURNING reply_count, last_reply_at, user_id
+	`, update.ThreadRootID, message.SentAt).Scan(&update.ReplyCount, &update.LastReplyAt, &rootAuthorID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if update.ReplyCount == 1 && rootAuthorID != message.UserID {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO thread_follows (thread_root_id, user_id, room_id, tenant_id)
+			SELECT $1, user_id, room_id, tenant_id FROM room_members
+			WHERE room_id = $2 AND user_id = $3
+			ON CONFLICT DO NOTHING
+		`, update.ThreadRootID, message.RoomID, rootAuthorID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Replying means the replier has read the thread up to their reply
+	_, err = tx.Exec(ctx, `
+		INSERT INTO thread_follows (thread_root_id, user_id, room_id, tenant_id, last_read_message_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, thread_root_id) DO UPDATE SET last_read_message_id = EXCLUDED.last_read_message_id
+	`, update.ThreadRootID, message.UserID, message.RoomID, message.TenantID, message.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := tx.Query(ctx, "SELECT user_id FROM thread_follows WHERE thread_root_id = $1", update.ThreadRootID)
+	if err != nil {
+		return nil, nil, err
+	}
+	followerIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &update, followerIDs, nil
+}
+
+// deleteThreadFollows drops a former member's thread follows in a room
+func deleteThreadFollows(ctx context.Context, tx pgx.Tx, roomID, userID string) error {
+	_, err := tx.Exec(ctx, "DELETE FROM thread_follows WHERE room_id = $1 AND user_id = $2", roomID, userID)
+	return err
+}
+
+// sendThreadReply delivers a thread reply to the thread's followers only,
+// with attachment URLs signed for each, and tells the rest of the room that
+// the thread changed, so replies stay out of the main timeline
+func (s *ChatService) sendThreadReply(message *db.Message, update *db.ThreadUpdate, followerIDs []string) {
+	if s.wsService == nil {
+		return
+	}
+	for _, followerID := range followerIDs {
+		s.wsService.SendToUser(followerID, "thread_reply", signedFor(message, followerID))
+	}
+	s.wsService.BroadcastToRoom(message.RoomID, "thread_updated", update, "")
+}
+
+// notifyThreadFollowers sends a thread reply notification to every follower
+// except the replier and those to skip
+func (s *ChatService) notifyThreadFollowers(message *db.Message, followerIDs []string, skip map[string]bool) {
+	recipients := make([]string, 0, len(followerIDs))
+	for _, followerID := range followerIDs {
+		if followerID != message.UserID && !skip[followerID] {
+			recipients = append(recipients, followerID)
+		}
+	}
+
+	s.notificationService.NotifyUsers(recipients, db.Notification{
+		Type:     "thread_reply",
+		RoomID:   message.RoomID,
+		Priority: notification.PriorityNormal,
+		Payload:  message,
+	})
+}
+
+// threadRoot loads the root of a thread in a room as seen by a viewer
+func threadRoot(ctx context.Context, tx pgx.Tx, roomID, rootID, viewerID string) (*db.Message, error) {
+	var root db.Message
+	err := scanMessage(tx.QueryRow(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages m
+		WHERE m.id = $1 AND m.room_id = $2 AND m.thread_root_id IS NULL
+	`, rootID, roomID), &root)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	roots := []db.Message{root}
+	if err := attachMessageDetails(ctx, tx, roots, viewerID); err != nil {
+		return nil, err
+	}
+	return &roots[0], nil
+}
+
+// GetThreadMessages returns the root of a thread and a page of its replies,
+// newest first, with whether the viewer follows the thread. Pass the
+// returned cursor to get older replies; it is empty on the last page.
+func (s *ChatService) GetThreadMessages(ctx context.Context, roomID, rootID, viewerID, cursor string, limit int) (*db.Thread, string, error) {
+	var thread db.Thread
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		root, err := threadRoot(ctx, tx, roomID, rootID, viewerID)
+		if err != nil {
+			return err
+		}
+		thread.Root = *root
+
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM thread_follows WHERE thread_root_id = $1 AND user_id = $2)
+		`, rootID, viewerID).Scan(&thread.Following)
+		if err != nil {
+			return err
+		}
+
+		// Get one extra to determine if there are more pages
+		rows, err := tx.Query(ctx, `
+			SELECT `+messageColumns+`
+			FROM messages m
+			WHERE m.thread_root_id = $1
+			AND ($2 = '' OR m.id < $2)
+			AND `+visibleTo("$4")+`
+			ORDER BY m.id DESC
+			LIMIT $3
+		`, rootID, cursor, limit+1, viewerID)
+		if err != nil {
+			return err
+		}
+		thread.Replies, err = scanMessages(rows)
+		if err != nil {
+			return err
+		}
+		return attachMessageDetails(ctx, tx, thread.Replies, viewerID)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if len(thread.Replies) > limit {
+		nextCursor = thread.Replies[limit-1].ID
+		thread.Replies = thread.Replies[:limit]
+	}
+	if thread.Replies == nil {
+		thread.Replies = []db.Message{}
+	}
+
+	return &thread, nextCursor, nil
+}
+
+// FollowThread makes a member follow a thread from its latest reply on
+func (s *ChatService) FollowThread(ctx context.Context, roomID, rootID, userID string) error {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return db.ErrNoTenantContext
+	}
+
+	return db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		if _, _, err := memberRole(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+		if _, err := threadRoot(ctx, tx, roomID, rootID, userID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `
+			INSERT INTO thread_follows (thread_root_id, user_id, room_id, tenant_id, last_read_message_id)
+			VALUES ($1, $2, $3, $4, (SELECT MAX(id) FROM messages WHERE thread_root_id = $1))
+			ON CONFLICT DO NOTHING
+		`, rootID, userID, roomID, tenantID)
+		return err
+	})
+}
+
+// UnfollowThread stops a member from following a thread. They no longer
+// receive its replies or notifications.
+func (s *ChatService) UnfollowThread(ctx context.Context, roomID, rootID, userID string) error {
+	return db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		if _, _, err := memberRole(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `
+			DELETE FROM thread_follows WHERE thread_root_id = $1 AND user_id = $2 AND room_id = $3
+		`, rootID, userID, roomID)
+		return err
+	})
+}
+
+// MarkThreadRead moves a follower's read marker in a thread forward to a
+// reply, or to the latest reply when messageID is empty, and tells the
+// senders of the replies. Marking a thread the user does not follow is a
+// no-op. It returns the marker after the update.
+func (s *ChatService) MarkThreadRead(ctx context.Context, roomID, rootID, userID, messageID string) (string, error) {
+	var marker *string
+	var hidden bool
+	var status string
+	var changes []statusChange
+	readAt := time.Now().UTC()
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		if _, _, err := memberRole(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+		if err := tx.QueryRow(ctx, "SELECT hide_read_receipts FROM users WHERE id = $1", userID).Scan(&hidden); err != nil {
+			return err
+		}
+
+		if messageID == "" {
+			err := tx.QueryRow(ctx, "SELECT MAX(id) FROM messages WHERE thread_root_id = $1 AND room_id = $2", rootID, roomID).Scan(&marker)
+			if err != nil || marker == nil {
+				return err
+			}
+			messageID = *marker
+		} else {
+			var exists bool
+			err := tx.QueryRow(ctx, `
+				SELECT EXISTS(SELECT 1 FROM messages WHERE id = $1 AND thread_root_id = $2 AND room_id = $3)
+			`, messageID, rootID, roomID).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return ErrMessageNotFound
+			}
+		}
+
+		tag, err := tx.Exec(ctx, `
+			UPDATE thread_follows SET last_read_message_id = $3
+			WHERE thread_root_id = $1 AND user_id = $2
+			AND (last_read_message_id IS NULL OR last_read_message_id < $3)
+		`, rootID, userID, messageID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			// Not following, or already read further than this reply
+			marker = nil
+			err := tx.QueryRow(ctx, `
+				SELECT last_read_message_id FROM thread_follows WHERE thread_root_id = $1 AND user_id = $2
+			`, rootID, userID).Scan(&marker)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+
+		marker = &messageID
+		status, changes, err = markReceiptsRead(ctx, tx, roomID, userID, messageID, &rootID, hidden, readAt)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	s.sendStatusUpdates(userID, status, readAt, changes)
+	if marker == nil {
+		return "", nil
+	}
+	return *marker, nil
+}
+
+// GetFollowedThreads lists the threads a user follows, most recently active
+// first, with the number of replies they have not read
+func (s *ChatService) GetFollowedThreads(ctx context.Context, userID string, limit int) ([]db.ThreadSummary, error) {
+	threads := []db.ThreadSummary{}
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT `+messageColumns+`,
+				(
+					SELECT COUNT(*) FROM messages um
+					WHERE um.thread_root_id = m.id
+					AND um.id > COALESCE(tf.last_read_message_id, '')
+					AND um.user_id <> tf.user_id
+					AND um.deleted_at IS NULL
+					AND NOT EXISTS (SELECT 1 FROM message_hides h WHERE h.message_id = um.id AND h.user_id = tf.user_id)
+				)
+			FROM thread_follows tf
+			JOIN messages m ON m.id = tf.thread_root_id
+			WHERE tf.user_id = $1
+			ORDER BY COALESCE(m.last_reply_at, m.sent_at) DESC, m.id DESC
+			LIMIT $2
+		`, userID, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var thread db.ThreadSummary
+			if err := scanMessage(rows, &thread.Root, &thread.UnreadCount); err != nil {
+				return err
+			}
+			threads = append(threads, thread)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return threads, nil
+}
@@ -0,0 +1,221 @@
+package chat
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/websocket"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidVoiceNote is returned for voice notes that do not carry exactly
+// one audio upload with a valid Ogg/Opus or AAC container, or that have
+// text content
+var ErrInvalidVoiceNote = errors.New("voice notes need exactly one Ogg/Opus or AAC recording and no content")
+
+// ErrNotVoiceNote is returned when a message that is not a voice note is
+// marked as listened
+var ErrNotVoiceNote = errors.New("message is not a voice note")
+
+// handleMarkListened lets a client mark a voice note as played over the
+// WebSocket. The content is the message ID.
+func (s *ChatService) handleMarkListened(client *websocket.Client, message *websocket.Message) {
+	messageID, _ := message.Content.(string)
+	if message.RoomID == "" || messageID == "" {
+		s.wsService.SendErrorToClient(client, "Room ID and message ID are required")
+		return
+	}
+
+	ctx := db.ContextWithTenant(context.Background(), client.TenantID)
+	if _, err := s.MarkListened(ctx, message.RoomID, messageID, client.UserID); err != nil {
+		switch {
+		case errors.Is(err, ErrNotRoomMember):
+			s.wsService.SendErrorToClient(client, "Not a member of this room")
+		case errors.Is(err, ErrMessageNotFound):
+			s.wsService.SendErrorToClient(client, "Message not found")
+		case errors.Is(err, ErrNotVoiceNote):
+			s.wsService.SendErrorToClient(client, "Message is not a voice note")
+		default:
+			log.Printf("Failed to mark message %s listened for user %s: %v", messageID, client.UserID, err)
+			s.wsService.SendErrorToClient(client, "Failed to mark voice note as listened")
+		}
+	}
+}
+
+// MarkListened records that a member played a voice note of the room. Only
+// the first play counts, and the author's own plays are not recorded. It
+// returns when the member first played it, or nil for the author. Members
+// who hide their read receipts only tell their own devices.
+func (s *ChatService) MarkListened(ctx context.Context, roomID, messageID, userID string) (*time.Time, error) {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return nil, db.ErrNoTenantContext
+	}
+
+	var receipt *db.ListenReceipt
+	var listenedAt *time.Time
+	var hidden bool
+	now := time.Now().UTC()
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		if _, _, err := memberRole(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+		if err := tx.QueryRow(ctx, "SELECT hide_read_receipts FROM users WHERE id = $1", userID).Scan(&hidden); err != nil {
+			return err
+		}
+
+		var authorID, messageType string
+		err := tx.QueryRow(ctx, `
+			SELECT m.user_id, m.type FROM messages m
+			WHERE m.id = $1 AND m.room_id = $2 AND m.deleted_at IS NULL AND `+visibleTo("$3")+`
+		`, messageID, roomID, userID).Scan(&authorID, &messageType)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if messageType != MessageTypeVoice {
+			return ErrNotVoiceNote
+		}
+		if authorID == userID {
+			return nil
+		}
+
+		// Members who joined after the voice note was sent have no receipt
+		var at time.Time
+		var first bool
+		err = tx.QueryRow(ctx, `
+			INSERT INTO message_receipts (message_id, user_id, room_id, tenant_id, status, delivered_at, listened_at)
+			VALUES ($1, $2, $3, $4, 'delivered', $5, $5)
+			ON CONFLICT (message_id, user_id) DO UPDATE
+			SET listened_at = COALESCE(message_receipts.listened_at, EXCLUDED.listened_at)
+			RETURNING listened_at, listened_at = $5
+		`, messageID, userID, roomID, tenantID, now).Scan(&at, &first)
+		if err != nil {
+			return err
+		}
+
+		listenedAt = &at
+		if first {
+			receipt = &db.ListenReceipt{
+				RoomID:     roomID,
+				MessageID:  messageID,
+				UserID:     userID,
+				ListenedAt: at,
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if receipt != nil && s.wsService != nil {
+		if hidden {
+			s.wsService.SendToUser(userID, "voice_listened", receipt)
+		} else {
+			s.wsService.BroadcastToRoom(roomID, "voice_listened", receipt, "")
+		}
+	}
+
+	return listenedAt, nil
+}
+
+// GetMessageListeners lists the members who have played a voice note of the
+// room, leaving out members who hide their read receipts
+func (s *ChatService) GetMessageListeners(ctx context.Context, roomID, messageID, userID string) ([]db.MessageListener, error) {
+	listeners := []db.MessageListener{}
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		if _, _, err := memberRole(ctx, tx, roomID, userID); err != nil {
+			return err
+		}
+
+		var hidden bool
+		if err := tx.QueryRow(ctx, "SELECT hide_read_receipts FROM users WHERE id = $1", userID).Scan(&hidden); err != nil {
+			return err
+		}
+		if hidden {
+			return ErrReadReceiptsHidden
+		}
+
+		var messageType string
+		err := tx.QueryRow(ctx, "SELECT type FROM messages WHERE id = $1 AND room_id = $2", messageID, roomID).Scan(&messageType)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if messageType != MessageTypeVoice {
+			return ErrNotVoiceNote
+		}
+
+		rows, err := tx.Query(ctx, `
+			SELECT mr.user_id, u.name, mr.listened_at
+			FROM message_receipts mr
+			JOIN users u ON u.id = mr.user_id
+			WHERE mr.message_id = $1
+			AND mr.listened_at IS NOT NULL
+			AND NOT u.hide_read_receipts
+			ORDER BY mr.listened_at
+		`, messageID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var listener db.MessageListener
+			if err := rows.Scan(&listener.UserID, &listener.Name, &listener.ListenedAt); err != nil {
+				return err
+			}
+			listeners = append(listeners, listener)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return listeners, nil
+}
+
+// attachListened adds when the viewer first played each voice note
+func attachListened(ctx context.Context, tx pgx.Tx, messages []db.Message, viewerID string) error {
+	index := make(map[string]int)
+	var ids []string
+	for i, message := range messages {
+		if message.Type == MessageTypeVoice {
+			index[message.ID] = i
+			ids = append(ids, message.ID)
+		}
+	}
+	if len(ids) == 0 || viewerID == "" {
+		return nil
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT message_id, listened_at FROM message_receipts
+		WHERE user_id = $1 AND message_id = ANY($2) AND listened_at IS NOT NULL
+	`, viewerID, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID string
+		var listenedAt time.Time
+		if err := rows.Scan(&messageID, &listenedAt); err != nil {
+			return err
+		}
+		messages[index[messageID]].ListenedAt = &listenedAt
+	}
+
+	return rows.Err()
+}
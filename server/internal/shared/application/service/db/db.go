@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"log"
 	"os"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -16,7 +17,20 @@ func InitDB() error {
 	}
 	var err error
 	db, err = pgxpool.New(context.Background(), connStr)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Row-level security does not apply to superusers or BYPASSRLS roles
+	var bypassesRLS bool
+	err = db.QueryRow(context.Background(), `
+		SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user
+	`).Scan(&bypassesRLS)
+	if err == nil && bypassesRLS {
+		log.Printf("Warning: database role bypasses row-level security, tenant isolation is not enforced by Postgres")
+	}
+
+	return nil
 }
 
 func GetDB() *pgxpool.Pool {
@@ -5,37 +5,291 @@ import (
 )
 
 type User struct {
-	ID            string    `json:"id" db:"id"`
-	TenantID      string    `json:"tenant_id" db:"tenant_id"`
-	Email         string    `json:"email" db:"email"`
-	Name          string    `json:"name" db:"name"`
-	Role          string    `json:"role" db:"role"`
-	PasswordHash  string    `json:"-" db:"password_hash"`
-	PhoneNumber   *string   `json:"phone_number,omitempty" db:"phone_number"`
-	PhoneVerified bool      `json:"phone_verified" db:"phone_verified"`
-	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	ID            string     `json:"id" db:"id"`
+	TenantID      string     `json:"tenant_id" db:"tenant_id"`
+	Email         string     `json:"email" db:"email"`
+	Name          string     `json:"name" db:"name"`
+	Role          string     `json:"role" db:"role"`
+	PasswordHash  string     `json:"-" db:"password_hash"`
+	PhoneNumber   *string    `json:"phone_number,omitempty" db:"phone_number"`
+	PhoneVerified bool       `json:"phone_verified" db:"phone_verified"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	PurgeAfter    *time.Time `json:"purge_after,omitempty" db:"purge_after"`
+	SuspendedAt   *time.Time `json:"suspended_at,omitempty" db:"suspended_at"`
+	LastSeenAt    *time.Time `json:"last_seen_at,omitempty" db:"last_seen_at"`
+}
+
+// PublicUser is the part of a user's profile any member of their tenant can
+// see. Deleted accounts are shown under a placeholder name.
+type PublicUser struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// UserFilter narrows down admin user listings
+type UserFilter struct {
+	Query  string // matches name, email or phone number
+	Role   string
+	Status string // "active", "suspended" or "deleted"
+	Page   int
+	Limit  int
+}
+
+type SuspendUserRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+type ChangeRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=user admin owner"`
 }
 
 type Room struct {
-	ID        string    `json:"id" db:"id"`
-	TenantID  string    `json:"tenant_id" db:"tenant_id"`
-	Name      string    `json:"name" db:"name"`
-	Type      string    `json:"type" db:"type"` // "direct" or "group"
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID          string    `json:"id" db:"id"`
+	TenantID    string    `json:"tenant_id" db:"tenant_id"`
+	Name        string    `json:"name" db:"name"`
+	Type        string    `json:"type" db:"type"` // "direct" or "group"
+	Description string    `json:"description" db:"description"`
+	AvatarURL   string    `json:"avatar_url" db:"avatar_url"`
+	Topic       string    `json:"topic" db:"topic"`
+	Archived    bool      `json:"archived,omitempty"` // archived by the requesting user
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// RoomSummary is a room as shown in a user's room list
+type RoomSummary struct {
+	Room
+	LastMessage    *Message    `json:"last_message"`
+	LastActivityAt time.Time   `json:"last_activity_at"`
+	UnreadCount    int         `json:"unread_count"`
+	Participant    *PublicUser `json:"participant,omitempty"` // the other member of a direct room
+}
+
+// ReadReceipt tells a room how far a member has read
+type ReadReceipt struct {
+	RoomID            string    `json:"room_id"`
+	UserID            string    `json:"user_id"`
+	LastReadMessageID string    `json:"last_read_message_id"`
+	ReadAt            time.Time `json:"read_at"`
+}
+
+// MessageReader is a member who has read a message
+type MessageReader struct {
+	UserID string    `json:"user_id"`
+	Name   string    `json:"name"`
+	ReadAt time.Time `json:"read_at"` // when the member last moved their read marker
+}
+
+// MessageStatusUpdate tells a sender that messages reached a new delivery
+// status for one recipient
+type MessageStatusUpdate struct {
+	RoomID     string    `json:"room_id"`
+	UserID     string    `json:"user_id"` // the recipient
+	Status     string    `json:"status"`  // "delivered" or "read"
+	MessageIDs []string  `json:"message_ids"`
+	At         time.Time `json:"at"`
+}
+
+// MessageDelivery is the delivery state of a message for one recipient
+type MessageDelivery struct {
+	UserID      string     `json:"user_id"`
+	Name        string     `json:"name"`
+	Status      string     `json:"status"` // "sent", "delivered" or "read"
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	ReadAt      *time.Time `json:"read_at,omitempty"`
+	ListenedAt  *time.Time `json:"listened_at,omitempty"` // voice notes only
+}
+
+// MessageListener is a member who has played a voice note
+type MessageListener struct {
+	UserID     string    `json:"user_id"`
+	Name       string    `json:"name"`
+	ListenedAt time.Time `json:"listened_at"`
+}
+
+// ListenReceipt tells a room that a member played a voice note
+type ListenReceipt struct {
+	RoomID     string    `json:"room_id"`
+	MessageID  string    `json:"message_id"`
+	UserID     string    `json:"user_id"`
+	ListenedAt time.Time `json:"listened_at"`
+}
+
+type AckRequest struct {
+	MessageIDs []string `json:"message_ids" binding:"required,min=1,max=500"`
+}
+
+type MarkReadRequest struct {
+	MessageID string `json:"message_id"`
+}
+
+type ChatSettings struct {
+	HideReadReceipts bool `json:"hide_read_receipts"`
+}
+
+type ChatSettingsRequest struct {
+	HideReadReceipts *bool `json:"hide_read_receipts" binding:"required"`
+}
+
+// UpdateRoomRequest changes the details of a group room. Omitted fields are
+// left unchanged.
+type UpdateRoomRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	AvatarURL   *string `json:"avatar_url"`
+	Topic       *string `json:"topic"`
 }
 
 type RoomMember struct {
 	RoomID string `json:"room_id" db:"room_id"`
 	UserID string `json:"user_id" db:"user_id"`
+	Role   string `json:"role" db:"role"` // "owner", "admin" or "member"
+	Name   string `json:"name,omitempty" db:"name"`
+}
+
+// PinnedMessage is a message pinned to the top of its room
+type PinnedMessage struct {
+	Message  Message   `json:"message"`
+	PinnedBy *string   `json:"pinned_by,omitempty" db:"pinned_by"`
+	PinnedAt time.Time `json:"pinned_at" db:"pinned_at"`
+}
+
+// RoomMembership describes a room from the point of view of one of its members
+type RoomMembership struct {
+	RoomID        string    `json:"room_id" db:"room_id"`
+	RoomName      string    `json:"room_name" db:"name"`
+	RoomType      string    `json:"room_type" db:"type"`
+	RoomCreatedAt time.Time `json:"room_created_at" db:"created_at"`
 }
 
 type Message struct {
-	ID       string    `json:"id" db:"id"`
-	TenantID string    `json:"tenant_id" db:"tenant_id"`
-	RoomID   string    `json:"room_id" db:"room_id"`
-	UserID   string    `json:"user_id" db:"user_id"`
-	Content  string    `json:"content" db:"content"`
-	SentAt   time.Time `json:"sent_at" db:"sent_at"`
+	ID            string          `json:"id" db:"id"`
+	TenantID      string          `json:"tenant_id" db:"tenant_id"`
+	RoomID        string          `json:"room_id" db:"room_id"`
+	UserID        string          `json:"user_id" db:"user_id"`
+	Type          string          `json:"type" db:"type"` // "user", "voice" or "system"
+	Content       string          `json:"content" db:"content"`
+	SentAt        time.Time       `json:"sent_at" db:"sent_at"`
+	EditedAt      *time.Time      `json:"edited_at,omitempty" db:"edited_at"`
+	DeletedAt     *time.Time      `json:"deleted_at,omitempty" db:"deleted_at"` // set on tombstones, whose content is empty
+	DeletedBy     *string         `json:"deleted_by,omitempty" db:"deleted_by"`
+	ReplyToID     *string         `json:"reply_to_id,omitempty" db:"reply_to_id"`
+	ReplyTo       *MessagePreview `json:"reply_to,omitempty"`
+	ThreadRootID  *string         `json:"thread_root_id,omitempty" db:"thread_root_id"`
+	ReplyCount    int             `json:"reply_count,omitempty" db:"reply_count"` // thread replies to a root
+	LastReplyAt   *time.Time      `json:"last_reply_at,omitempty" db:"last_reply_at"`
+	Mentions      []string        `json:"mentions,omitempty" db:"mentions"` // mentioned user IDs, "here" and "room"
+	Reactions     []ReactionCount `json:"reactions,omitempty"`
+	Attachments   []Attachment    `json:"attachments,omitempty"`
+	AttachmentIDs []string        `json:"-"`                     // uploads to attach when the message is saved
+	ListenedAt    *time.Time      `json:"listened_at,omitempty"` // when the viewer first played a voice note
+}
+
+// Attachment is an uploaded file. URL and ThumbnailURL are download links
+// signed for the requesting user; they are left out of WebSocket events,
+// which every member of a room shares. Images and videos are processed in
+// the background, filling in their dimensions, blurhash and thumbnail.
+// Audio that can be sent as a voice note has a duration and a waveform.
+type Attachment struct {
+	ID               string     `json:"id" db:"id"`
+	MessageID        *string    `json:"message_id,omitempty" db:"message_id"`
+	UserID           string     `json:"user_id" db:"user_id"`
+	Filename         string     `json:"filename" db:"filename"`
+	ContentType      string     `json:"content_type" db:"content_type"` // sniffed from the content
+	Size             int64      `json:"size" db:"size"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	ProcessingStatus *string    `json:"processing_status,omitempty" db:"processing_status"` // "pending", "processing", "ready", "failed" or "unsupported"
+	Width            *int       `json:"width,omitempty" db:"width"`
+	Height           *int       `json:"height,omitempty" db:"height"`
+	Blurhash         *string    `json:"blurhash,omitempty" db:"blurhash"`
+	HasThumbnail     bool       `json:"-"`
+	DurationMS       *int       `json:"duration_ms,omitempty" db:"duration_ms"`
+	Waveform         []int      `json:"waveform,omitempty" db:"waveform"` // 64 bars from 0 to 100
+	URL              string     `json:"url,omitempty"`
+	ThumbnailURL     string     `json:"thumbnail_url,omitempty"`
+	URLExpiresAt     *time.Time `json:"url_expires_at,omitempty"`
+}
+
+// UploadSession is a resumable upload in progress. Chunks are appended at
+// Received until it reaches Size.
+type UploadSession struct {
+	ID           string    `json:"id" db:"id"`
+	Filename     string    `json:"filename" db:"filename"`
+	Size         int64     `json:"size" db:"size"`
+	Received     int64     `json:"received" db:"received"`
+	MinChunkSize int64     `json:"min_chunk_size"`
+	MaxChunkSize int64     `json:"max_chunk_size"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type CreateUploadRequest struct {
+	Filename string `json:"filename" binding:"required,max=255"`
+	Size     int64  `json:"size" binding:"required,min=1"`
+}
+
+// MessagePreview is a compact view of a message quoted by a reply
+type MessagePreview struct {
+	ID       string `json:"id"`
+	UserID   string `json:"user_id"`
+	UserName string `json:"user_name"`
+	Snippet  string `json:"snippet"` // start of the content, empty once deleted
+	Deleted  bool   `json:"deleted"`
+}
+
+// ThreadUpdate tells a room that a thread got a new reply
+type ThreadUpdate struct {
+	RoomID       string    `json:"room_id"`
+	ThreadRootID string    `json:"thread_root_id"`
+	ReplyCount   int       `json:"reply_count"`
+	LastReplyAt  time.Time `json:"last_reply_at"`
+}
+
+// Thread is a thread root with a page of its replies
+type Thread struct {
+	Root      Message   `json:"root"`
+	Replies   []Message `json:"replies"`
+	Following bool      `json:"following"`
+}
+
+// ThreadSummary is a followed thread as shown in a user's thread list
+type ThreadSummary struct {
+	Root        Message `json:"root"`
+	UnreadCount int     `json:"unread_count"`
+}
+
+// ReactionCount aggregates the reactions to a message with one emoji
+type ReactionCount struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+// MessageReaction tells a room that a member reacted to a message or took
+// the reaction back
+type MessageReaction struct {
+	RoomID    string `json:"room_id"`
+	MessageID string `json:"message_id"`
+	UserID    string `json:"user_id"`
+	Emoji     string `json:"emoji"`
+}
+
+type ReactionRequest struct {
+	Emoji string `json:"emoji" binding:"required"`
+}
+
+// MessageRevision is a previous version of an edited message
+type MessageRevision struct {
+	ID        int64     `json:"id"`
+	MessageID string    `json:"message_id"`
+	Content   string    `json:"content"`
+	EditedBy  *string   `json:"edited_by,omitempty"`
+	EditedAt  time.Time `json:"edited_at"` // when this version was replaced
+}
+
+type EditMessageRequest struct {
+	Content string `json:"content" binding:"required"`
 }
 
 type CreateRoomRequest struct {
@@ -45,12 +299,36 @@ type CreateRoomRequest struct {
 }
 
 type SendMessageRequest struct {
-	Content string `json:"content" binding:"required"`
+	Type          string   `json:"type" binding:"omitempty,oneof=user voice"` // "voice" sends the only attachment as a voice note
+	Content       string   `json:"content" binding:"required_without=AttachmentIDs"`
+	ReplyToID     *string  `json:"reply_to_id"`
+	ThreadRootID  *string  `json:"thread_root_id"`
+	Mentions      []string `json:"mentions" binding:"max=50"` // user IDs, "here" or "room"
+	AttachmentIDs []string `json:"attachment_ids" binding:"max=10,dive=uuid"`
 }
 
 type DirectMessageRequest struct {
-	RecipientID string `json:"recipient_id" binding:"required"`
-	Content     string `json:"content" binding:"required"`
+	RecipientID   string   `json:"recipient_id" binding:"required"`
+	Type          string   `json:"type" binding:"omitempty,oneof=user voice"`
+	Content       string   `json:"content" binding:"required_without=AttachmentIDs"`
+	ReplyToID     *string  `json:"reply_to_id"`
+	Mentions      []string `json:"mentions" binding:"max=50"`
+	AttachmentIDs []string `json:"attachment_ids" binding:"max=10,dive=uuid"`
+}
+
+// Mention is a message that mentions the requesting user
+type Mention struct {
+	Message Message `json:"message"`
+	Kind    string  `json:"kind"` // "user", "here" or "room"
+	Read    bool    `json:"read"`
+}
+
+// SearchResult is a message matching a search, with an HTML-escaped excerpt
+// of its content in which the matched words are wrapped in <mark> tags
+type SearchResult struct {
+	Message Message `json:"message"`
+	Snippet string  `json:"snippet"`
+	Rank    float32 `json:"rank"`
 }
 
 type PhoneVerificationCode struct {
@@ -64,6 +342,8 @@ type PhoneVerificationCode struct {
 
 type PhoneAuthRequest struct {
 	PhoneNumber string `json:"phone_number" binding:"required"`
+	InviteCode  string `json:"invite_code"` // picks the SMS sender for new users
+	Tenant      string `json:"tenant"`
 }
 
 type PhoneVerifyRequest struct {
@@ -75,9 +355,215 @@ type PhoneSignupRequest struct {
 	PhoneNumber string `json:"phone_number" binding:"required"`
 	Name        string `json:"name" binding:"required"`
 	Code        string `json:"code" binding:"required"`
+	InviteCode  string `json:"invite_code"`
+	Tenant      string `json:"tenant"` // tenant slug
 }
 
 type PhoneSigninRequest struct {
 	PhoneNumber string `json:"phone_number" binding:"required"`
 	Code        string `json:"code" binding:"required"`
 }
+
+type UserPresence struct {
+	UserID       string      `json:"user_id"`
+	Status       string      `json:"status"` // "online", "away" or "offline"
+	LastSeenAt   *time.Time  `json:"last_seen_at,omitempty"`
+	CustomStatus *UserStatus `json:"custom_status,omitempty"`
+}
+
+type UserStatus struct {
+	Text      string     `json:"text"`
+	Emoji     string     `json:"emoji"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// DNDSchedule is a daily do-not-disturb window plus an optional snooze
+type DNDSchedule struct {
+	Start    string     `json:"start,omitempty"` // "HH:MM" in Timezone
+	End      string     `json:"end,omitempty"`   // "HH:MM" in Timezone
+	Timezone string     `json:"timezone"`
+	Until    *time.Time `json:"until,omitempty"` // notifications suppressed until this time
+}
+
+// Notification is pushed to a user's clients unless they are in do-not-disturb
+type Notification struct {
+	Type      string      `json:"type"` // e.g. "new_message"
+	RoomID    string      `json:"room_id,omitempty"`
+	Priority  string      `json:"priority"` // "normal" or "high"
+	Payload   interface{} `json:"payload"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type PresenceQueryRequest struct {
+	UserIDs []string `json:"user_ids" binding:"required,max=100"`
+}
+
+type PresenceSettingsRequest struct {
+	HideLastSeen *bool `json:"hide_last_seen" binding:"required"`
+}
+
+type UpdateStatusRequest struct {
+	Text      string     `json:"text" binding:"max=100"`
+	Emoji     string     `json:"emoji" binding:"max=32"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type UpdateDNDRequest struct {
+	Start    string     `json:"start"`
+	End      string     `json:"end"`
+	Timezone string     `json:"timezone"`
+	Until    *time.Time `json:"until"`
+}
+
+type SystemStats struct {
+	UsersPerTenant []TenantUserCount `json:"users_per_tenant"`
+	ActiveUsers    ActiveUserCounts  `json:"active_users"`
+	RoomsByType    map[string]int    `json:"rooms_by_type"`
+	MessagesPerDay []DailyCount      `json:"messages_per_day"`
+	OTP            OTPStats          `json:"otp"`
+	WebSocket      WebSocketStats    `json:"websocket"`
+	GeneratedAt    time.Time         `json:"generated_at"`
+}
+
+type TenantUserCount struct {
+	TenantID   string `json:"tenant_id"`
+	TenantName string `json:"tenant_name"`
+	UserCount  int    `json:"user_count"`
+}
+
+type ActiveUserCounts struct {
+	Last1Day   int `json:"last_1d"`
+	Last7Days  int `json:"last_7d"`
+	Last30Days int `json:"last_30d"`
+}
+
+type DailyCount struct {
+	Day   string `json:"day"` // YYYY-MM-DD
+	Count int64  `json:"count"`
+}
+
+type OTPStats struct {
+	Sent24h         int `json:"sent_24h"`
+	SendFailed24h   int `json:"send_failed_24h"`
+	VerifyFailed24h int `json:"verify_failed_24h"`
+	Sent30d         int `json:"sent_30d"`
+	SendFailed30d   int `json:"send_failed_30d"`
+	VerifyFailed30d int `json:"verify_failed_30d"`
+}
+
+type WebSocketStats struct {
+	ConnectedClients int            `json:"connected_clients"`
+	RoomSubscribers  map[string]int `json:"room_subscribers"`
+}
+
+type Tenant struct {
+	ID          string    `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Slug        *string   `json:"slug,omitempty" db:"slug"`
+	EmailDomain *string   `json:"email_domain,omitempty" db:"email_domain"`
+	Status      string    `json:"status" db:"status"` // "active" or "suspended"
+	IsDefault   bool      `json:"is_default" db:"is_default"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// TenantInvite is either an invitation addressed to one email address or
+// phone number, or a join link anyone can use up to MaxUses times
+type TenantInvite struct {
+	ID          string     `json:"id" db:"id"`
+	TenantID    string     `json:"tenant_id" db:"tenant_id"`
+	Code        string     `json:"code" db:"code"`
+	Role        string     `json:"role" db:"role"`
+	Email       *string    `json:"email,omitempty" db:"email"`
+	PhoneNumber *string    `json:"phone_number,omitempty" db:"phone_number"`
+	MaxUses     int        `json:"max_uses" db:"max_uses"`
+	UseCount    int        `json:"use_count" db:"use_count"`
+	Status      string     `json:"status" db:"-"` // "active", "used", "expired" or "revoked"
+	ExpiresAt   time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedBy   *string    `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	JoinURL     string     `json:"join_url,omitempty" db:"-"`
+}
+
+type CreateInviteRequest struct {
+	Email          string `json:"email" binding:"omitempty,email"`
+	PhoneNumber    string `json:"phone_number" binding:"omitempty,min=10"`
+	Role           string `json:"role" binding:"omitempty,oneof=user admin owner"`
+	MaxUses        int    `json:"max_uses" binding:"omitempty,min=1,max=10000"` // join links only
+	ExpiresInHours int    `json:"expires_in_hours" binding:"omitempty,min=1,max=8760"`
+}
+
+// InvitePreview is what an invitation reveals before signing up
+type InvitePreview struct {
+	TenantName string    `json:"tenant_name"`
+	Role       string    `json:"role"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// TenantHint carries everything a signup request offers for picking a tenant
+type TenantHint struct {
+	InviteCode    string
+	Slug          string // explicit tenant slug or the request's subdomain
+	Email         string
+	EmailVerified bool // whether the user proved they own Email
+	PhoneNumber   string
+}
+
+type CreateTenantRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Slug        string `json:"slug"`
+	EmailDomain string `json:"email_domain"`
+}
+
+type UpdateTenantRequest struct {
+	Name        *string `json:"name"`
+	Slug        *string `json:"slug"`
+	EmailDomain *string `json:"email_domain"`
+	Status      *string `json:"status" binding:"omitempty,oneof=active suspended"`
+}
+
+// TenantSettings are the policies a tenant can configure
+type TenantSettings struct {
+	MessageRetentionDays int      `json:"message_retention_days"` // 0 keeps messages forever
+	EditWindowMinutes    int      `json:"edit_window_minutes"`    // 0 allows edits at any time
+	SearchLanguage       string   `json:"search_language"`        // Postgres text search configuration
+	MaxUploadSizeMB      int      `json:"max_upload_size_mb"`
+	AllowNonContactDMs   bool     `json:"allow_non_contact_dms"` // DMs between users who share no room
+	Require2FA           bool     `json:"require_2fa"`
+	SignupMethods        []string `json:"signup_methods"` // "email", "phone"
+	OpenSignup           bool     `json:"open_signup"`    // signups without an invitation
+	SMSSenderID          string   `json:"sms_sender_id,omitempty"`
+}
+
+type UpdateTenantSettingsRequest struct {
+	MessageRetentionDays *int     `json:"message_retention_days" binding:"omitempty,min=0,max=3650"`
+	EditWindowMinutes    *int     `json:"edit_window_minutes" binding:"omitempty,min=0,max=10080"`
+	SearchLanguage       *string  `json:"search_language" binding:"omitempty,oneof=simple arabic danish dutch english finnish french german hungarian indonesian irish italian lithuanian nepali norwegian portuguese romanian russian spanish swedish tamil turkish"`
+	MaxUploadSizeMB      *int     `json:"max_upload_size_mb" binding:"omitempty,min=1,max=2048"`
+	AllowNonContactDMs   *bool    `json:"allow_non_contact_dms"`
+	Require2FA           *bool    `json:"require_2fa"`
+	SignupMethods        []string `json:"signup_methods" binding:"omitempty,min=1,dive,oneof=email phone"`
+	OpenSignup           *bool    `json:"open_signup"`
+	SMSSenderID          *string  `json:"sms_sender_id" binding:"omitempty,max=11,alphanum"`
+}
+
+// TenantQuotas are the plan limits of a tenant. Nil limits are unlimited.
+type TenantQuotas struct {
+	MaxMessagesPerMonth *int64 `json:"max_messages_per_month" binding:"omitempty,min=0"`
+	MaxSMSPerMonth      *int64 `json:"max_sms_per_month" binding:"omitempty,min=0"`
+	MaxStorageBytes     *int64 `json:"max_storage_bytes" binding:"omitempty,min=0"`
+	MaxActiveUsers      *int64 `json:"max_active_users" binding:"omitempty,min=0"`
+	WarningPercent      int    `json:"warning_percent" binding:"omitempty,min=1,max=100"` // soft warning threshold
+}
+
+// TenantUsage is the metered usage of a tenant in one month
+type TenantUsage struct {
+	TenantID     string       `json:"tenant_id"`
+	TenantName   string       `json:"tenant_name"`
+	Period       string       `json:"period"` // "2006-01"
+	MessagesSent int64        `json:"messages_sent"`
+	SMSSent      int64        `json:"sms_sent"`
+	ActiveUsers  int64        `json:"active_users"`
+	StorageBytes int64        `json:"storage_bytes"` // current total, not monthly
+	Quotas       TenantQuotas `json:"quotas"`
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrNoTenantContext is returned when tenant-scoped data is accessed without
+// a tenant or system context
+var ErrNoTenantContext = errors.New("no tenant in context")
+
+type contextKey int
+
+const (
+	tenantIDKey contextKey = iota
+	systemKey
+)
+
+// ContextWithTenant returns a context scoped to a single tenant
+func ContextWithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantIDKey, tenantID)
+}
+
+// SystemContext returns a context that may see every tenant. It is meant for
+// background jobs and platform operations only, never for user requests.
+func SystemContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, systemKey, true)
+}
+
+// TenantFromContext returns the tenant a context is scoped to
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantIDKey).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+// WithTenant runs fn in a transaction whose row-level security settings
+// match the context, so Postgres only exposes rows of the context's tenant.
+// The settings are transaction-local and never leak to other pool users.
+func WithTenant(ctx context.Context, pool *pgxpool.Pool, fn func(tx pgx.Tx) error) error {
+	tenantID, scoped := TenantFromContext(ctx)
+	system, _ := ctx.Value(systemKey).(bool)
+	if !scoped && !system {
+		return ErrNoTenantContext
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if scoped {
+		_, err = tx.Exec(ctx, "SELECT set_config('app.tenant_id', $1, true)", tenantID)
+	} else {
+		_, err = tx.Exec(ctx, "SELECT set_config('app.bypass_rls', 'on', true)")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,191 @@
+package notification
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/websocket"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// NotificationService delivers notifications to users while honoring their
+// do-not-disturb schedules
+type NotificationService struct {
+	db        *pgxpool.Pool
+	wsService *websocket.WebSocketService
+}
+
+func NewNotificationService(database *pgxpool.Pool, wsService *websocket.WebSocketService) *NotificationService {
+	return &NotificationService{
+		db:        database,
+		wsService: wsService,
+	}
+}
+
+// dndState is the stored do-not-disturb configuration of a user
+type dndState struct {
+	startMinute *int16
+	endMinute   *int16
+	timezone    string
+	until       *time.Time
+}
+
+// active reports whether notifications should be suppressed at the given time
+func (d dndState) active(now time.Time) bool {
+	if d.until != nil && now.Before(*d.until) {
+		return true
+	}
+
+	if d.startMinute == nil || d.endMinute == nil {
+		return false
+	}
+
+	location, err := time.LoadLocation(d.timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	local := now.In(location)
+	minute := int16(local.Hour()*60 + local.Minute())
+	start, end := *d.startMinute, *d.endMinute
+
+	switch {
+	case start < end:
+		return minute >= start && minute < end
+	case start > end:
+		// Window wraps past midnight, e.g. 22:00-07:00
+		return minute >= start || minute < end
+	default:
+		return false
+	}
+}
+
+// NotifyUsers sends a notification to each user who is not in do-not-disturb
+// and returns the IDs of the users it was delivered to. High priority
+// notifications, such as mentions, break through do-not-disturb.
+func (s *NotificationService) NotifyUsers(userIDs []string, notification db.Notification) []string {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	if notification.Priority == "" {
+		notification.Priority = PriorityNormal
+	}
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now()
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT id, dnd_start_minute, dnd_end_minute, dnd_timezone, dnd_until
+		FROM users
+		WHERE id = ANY($1::uuid[])
+	`, userIDs)
+	if err != nil {
+		log.Printf("Failed to load do-not-disturb settings: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var delivered []string
+	for rows.Next() {
+		var userID string
+		var dnd dndState
+		if err := rows.Scan(&userID, &dnd.startMinute, &dnd.endMinute, &dnd.timezone, &dnd.until); err != nil {
+			log.Printf("Failed to scan do-not-disturb settings: %v", err)
+			return delivered
+		}
+
+		if notification.Priority != PriorityHigh && dnd.active(now) {
+			continue
+		}
+
+		s.wsService.SendToUser(userID, "notification", notification)
+		delivered = append(delivered, userID)
+	}
+
+	return delivered
+}
+
+// GetDNDSchedule retrieves a user's do-not-disturb schedule
+func (s *NotificationService) GetDNDSchedule(userID string) (*db.DNDSchedule, error) {
+	ctx := context.Background()
+
+	var dnd dndState
+	err := s.db.QueryRow(ctx, `
+		SELECT dnd_start_minute, dnd_end_minute, dnd_timezone, dnd_until
+		FROM users WHERE id = $1
+	`, userID).Scan(&dnd.startMinute, &dnd.endMinute, &dnd.timezone, &dnd.until)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	schedule := &db.DNDSchedule{
+		Timezone: dnd.timezone,
+		Until:    dnd.until,
+	}
+	if dnd.startMinute != nil && dnd.endMinute != nil {
+		schedule.Start = formatMinute(*dnd.startMinute)
+		schedule.End = formatMinute(*dnd.endMinute)
+	}
+
+	return schedule, nil
+}
+
+// UpdateDNDSchedule replaces a user's do-not-disturb schedule. An empty start
+// and end clears the daily window.
+func (s *NotificationService) UpdateDNDSchedule(userID string, schedule *db.DNDSchedule) error {
+	ctx := context.Background()
+
+	var startMinute, endMinute *int16
+	if schedule.Start != "" || schedule.End != "" {
+		start, err := parseMinute(schedule.Start)
+		if err != nil {
+			return err
+		}
+		end, err := parseMinute(schedule.End)
+		if err != nil {
+			return err
+		}
+		startMinute, endMinute = &start, &end
+	}
+
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", schedule.Timezone)
+	}
+
+	_, err := s.db.Exec(ctx, `
+		UPDATE users
+		SET dnd_start_minute = $1, dnd_end_minute = $2, dnd_timezone = $3, dnd_until = $4
+		WHERE id = $5
+	`, startMinute, endMinute, schedule.Timezone, schedule.Until, userID)
+
+	return err
+}
+
+// parseMinute converts "HH:MM" into minutes after midnight
+func parseMinute(value string) (int16, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return int16(t.Hour()*60 + t.Minute()), nil
+}
+
+// formatMinute converts minutes after midnight into "HH:MM"
+func formatMinute(minute int16) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
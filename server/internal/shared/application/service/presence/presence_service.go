@@ -0,0 +1,353 @@
+package presence
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/websocket"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	StatusOnline  = "online"
+	StatusAway    = "away"
+	StatusOffline = "offline"
+)
+
+// statusChangedEvent is pushed to contacts when a user's custom status changes
+type statusChangedEvent struct {
+	UserID       string         `json:"user_id"`
+	CustomStatus *db.UserStatus `json:"custom_status"`
+}
+
+// PresenceService tracks which users are online and pushes presence changes
+// to everyone who shares a room with them
+type PresenceService struct {
+	db        *pgxpool.Pool
+	wsService *websocket.WebSocketService
+	away      map[string]bool // userID -> marked away by the client
+	mu        sync.RWMutex
+}
+
+func NewPresenceService(database *pgxpool.Pool, wsService *websocket.WebSocketService) *PresenceService {
+	s := &PresenceService{
+		db:        database,
+		wsService: wsService,
+		away:      make(map[string]bool),
+	}
+
+	wsService.AddConnectionListener(s)
+	wsService.RegisterHandler("set_presence", s.handleSetPresence)
+
+	return s
+}
+
+// UserConnected marks a user online when their first client connects
+func (s *PresenceService) UserConnected(userID string) {
+	s.mu.Lock()
+	delete(s.away, userID)
+	s.mu.Unlock()
+
+	s.broadcastPresence(db.UserPresence{UserID: userID, Status: StatusOnline})
+}
+
+// UserDisconnected persists last_seen_at when a user's last client disconnects
+func (s *PresenceService) UserDisconnected(userID string) {
+	ctx := context.Background()
+
+	s.mu.Lock()
+	delete(s.away, userID)
+	s.mu.Unlock()
+
+	var lastSeenAt time.Time
+	var hideLastSeen bool
+	err := s.db.QueryRow(ctx, `
+		UPDATE users SET last_seen_at = NOW()
+		WHERE id = $1
+		RETURNING last_seen_at, hide_last_seen
+	`, userID).Scan(&lastSeenAt, &hideLastSeen)
+	if err != nil {
+		log.Printf("Failed to record last seen for user %s: %v", userID, err)
+		return
+	}
+
+	presence := db.UserPresence{UserID: userID, Status: StatusOffline}
+	if !hideLastSeen {
+		presence.LastSeenAt = &lastSeenAt
+	}
+	s.broadcastPresence(presence)
+}
+
+// handleSetPresence lets a client switch its user between online and away
+func (s *PresenceService) handleSetPresence(client *websocket.Client, message *websocket.Message) {
+	status, ok := message.Content.(string)
+	if !ok || (status != StatusOnline && status != StatusAway) {
+		s.wsService.SendErrorToClient(client, "Presence must be \"online\" or \"away\"")
+		return
+	}
+
+	s.mu.Lock()
+	changed := s.away[client.UserID] != (status == StatusAway)
+	if status == StatusAway {
+		s.away[client.UserID] = true
+	} else {
+		delete(s.away, client.UserID)
+	}
+	s.mu.Unlock()
+
+	if changed {
+		s.broadcastPresence(db.UserPresence{UserID: client.UserID, Status: status})
+	}
+}
+
+// currentStatus returns the live status of a user
+func (s *PresenceService) currentStatus(userID string) string {
+	if !s.wsService.IsUserOnline(userID) {
+		return StatusOffline
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.away[userID] {
+		return StatusAway
+	}
+	return StatusOnline
+}
+
+// GetPresence returns the presence of each of the given users in the context's
+// tenant. Users of other tenants are left out.
+func (s *PresenceService) GetPresence(ctx context.Context, userIDs []string) ([]db.UserPresence, error) {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return nil, db.ErrNoTenantContext
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT id, last_seen_at, hide_last_seen, status_text, status_emoji, status_expires_at
+		FROM users
+		WHERE id = ANY($1::uuid[]) AND tenant_id = $2
+	`, userIDs, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	presences := []db.UserPresence{}
+	for rows.Next() {
+		var presence db.UserPresence
+		var hideLastSeen bool
+		var statusText, statusEmoji *string
+		var statusExpiresAt *time.Time
+		if err := rows.Scan(&presence.UserID, &presence.LastSeenAt, &hideLastSeen, &statusText, &statusEmoji, &statusExpiresAt); err != nil {
+			return nil, err
+		}
+		presence.CustomStatus = buildStatus(statusText, statusEmoji, statusExpiresAt)
+
+		presence.Status = s.currentStatus(presence.UserID)
+		if hideLastSeen || presence.Status != StatusOffline {
+			presence.LastSeenAt = nil
+		}
+		presences = append(presences, presence)
+	}
+
+	return presences, rows.Err()
+}
+
+// UpdateSettings changes a user's presence privacy settings
+func (s *PresenceService) UpdateSettings(userID string, hideLastSeen bool) error {
+	ctx := context.Background()
+
+	_, err := s.db.Exec(ctx, `
+		UPDATE users SET hide_last_seen = $1 WHERE id = $2
+	`, hideLastSeen, userID)
+
+	return err
+}
+
+// SetStatus sets a user's custom status and broadcasts it to their contacts
+func (s *PresenceService) SetStatus(userID string, status db.UserStatus) error {
+	ctx := context.Background()
+
+	if status.Text == "" && status.Emoji == "" {
+		return s.ClearStatus(userID)
+	}
+	if status.ExpiresAt != nil && !status.ExpiresAt.After(time.Now()) {
+		return errors.New("status expiry must be in the future")
+	}
+
+	_, err := s.db.Exec(ctx, `
+		UPDATE users
+		SET status_text = $1, status_emoji = $2, status_expires_at = $3
+		WHERE id = $4
+	`, status.Text, status.Emoji, status.ExpiresAt, userID)
+	if err != nil {
+		return err
+	}
+
+	s.broadcastStatus(userID, &status)
+	return nil
+}
+
+// ClearStatus removes a user's custom status and broadcasts the change
+func (s *PresenceService) ClearStatus(userID string) error {
+	ctx := context.Background()
+
+	_, err := s.db.Exec(ctx, `
+		UPDATE users
+		SET status_text = NULL, status_emoji = NULL, status_expires_at = NULL
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return err
+	}
+
+	s.broadcastStatus(userID, nil)
+	return nil
+}
+
+// ClearExpiredStatuses removes statuses whose expiry has passed and tells contacts
+func (s *PresenceService) ClearExpiredStatuses() (int, error) {
+	ctx := context.Background()
+
+	rows, err := s.db.Query(ctx, `
+		UPDATE users
+		SET status_text = NULL, status_emoji = NULL, status_expires_at = NULL
+		WHERE status_expires_at <= NOW()
+		RETURNING id
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, userID := range userIDs {
+		s.broadcastStatus(userID, nil)
+	}
+
+	return len(userIDs), nil
+}
+
+// StartStatusExpiryJob periodically clears expired custom statuses
+func (s *PresenceService) StartStatusExpiryJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := s.ClearExpiredStatuses(); err != nil {
+				log.Printf("Status expiry job failed: %v", err)
+			}
+		}
+	}()
+}
+
+// buildStatus returns a user's custom status, or nil when unset or expired
+func buildStatus(text, emoji *string, expiresAt *time.Time) *db.UserStatus {
+	if text == nil && emoji == nil {
+		return nil
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil
+	}
+
+	status := &db.UserStatus{ExpiresAt: expiresAt}
+	if text != nil {
+		status.Text = *text
+	}
+	if emoji != nil {
+		status.Emoji = *emoji
+	}
+	return status
+}
+
+// GetContacts returns every user who shares a room or direct message with the user
+func (s *PresenceService) GetContacts(userID string) ([]string, error) {
+	ctx := context.Background()
+
+	// Presence events carry no request, so scope the lookup to the user's tenant
+	var tenantID string
+	err := s.db.QueryRow(ctx, "SELECT tenant_id FROM users WHERE id = $1", userID).Scan(&tenantID)
+	if err != nil {
+		return nil, err
+	}
+	ctx = db.ContextWithTenant(ctx, tenantID)
+
+	var contacts []string
+	err = db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT DISTINCT rm2.user_id
+			FROM room_members rm1
+			JOIN room_members rm2 ON rm1.room_id = rm2.room_id
+			WHERE rm1.user_id = $1 AND rm2.user_id <> $1
+		`, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var contactID string
+			if err := rows.Scan(&contactID); err != nil {
+				return err
+			}
+			contacts = append(contacts, contactID)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return contacts, nil
+}
+
+// broadcastStatus pushes a custom status change to all of the user's online contacts
+func (s *PresenceService) broadcastStatus(userID string, status *db.UserStatus) {
+	contacts, err := s.GetContacts(userID)
+	if err != nil {
+		log.Printf("Failed to load contacts for user %s: %v", userID, err)
+		return
+	}
+
+	event := statusChangedEvent{
+		UserID:       userID,
+		CustomStatus: status,
+	}
+	for _, contactID := range contacts {
+		s.wsService.SendToUser(contactID, "status_changed", event)
+	}
+	// Keep the user's other devices in sync too
+	s.wsService.SendToUser(userID, "status_changed", event)
+}
+
+// broadcastPresence pushes a presence change to all of the user's online contacts
+func (s *PresenceService) broadcastPresence(presence db.UserPresence) {
+	contacts, err := s.GetContacts(presence.UserID)
+	if err != nil {
+		log.Printf("Failed to load contacts for user %s: %v", presence.UserID, err)
+		return
+	}
+
+	for _, contactID := range contacts {
+		s.wsService.SendToUser(contactID, "presence_changed", presence)
+	}
+}
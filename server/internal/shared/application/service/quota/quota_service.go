@@ -0,0 +1,364 @@
+package quota
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/notification"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	MetricMessages    = "messages"
+	MetricSMS         = "sms"
+	MetricStorage     = "storage"
+	MetricActiveUsers = "active_users"
+)
+
+// DefaultWarningPercent is the usage share that triggers a soft warning
+const DefaultWarningPercent = 80
+
+// cacheTTL bounds how long quota changes take to reach other server instances
+const cacheTTL = time.Minute
+
+// ErrQuotaExceeded is returned when consuming would go over a hard limit
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Querier is satisfied by both the pool and transactions, so usage can be
+// recorded atomically with the operation being metered
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// usageColumns maps the monthly metrics to their tenant_usage column
+var usageColumns = map[string]string{
+	MetricMessages:    "messages_sent",
+	MetricSMS:         "sms_sent",
+	MetricActiveUsers: "active_users",
+}
+
+type cachedQuotas struct {
+	quotas   db.TenantQuotas
+	loadedAt time.Time
+}
+
+// QuotaService meters tenant usage and enforces plan limits. Usage beyond the
+// warning threshold notifies the tenant's admins once per month, usage beyond
+// a limit is rejected.
+type QuotaService struct {
+	db                  *pgxpool.Pool
+	notificationService *notification.NotificationService
+	cache               map[string]cachedQuotas // tenantID -> quotas
+	mu                  sync.RWMutex
+}
+
+func NewQuotaService(database *pgxpool.Pool, notificationService *notification.NotificationService) *QuotaService {
+	return &QuotaService{
+		db:                  database,
+		notificationService: notificationService,
+		cache:               make(map[string]cachedQuotas),
+	}
+}
+
+// currentPeriod returns the first day of the current month
+func currentPeriod() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// GetQuotas returns the limits of a tenant
+func (s *QuotaService) GetQuotas(tenantID string) (*db.TenantQuotas, error) {
+	s.mu.RLock()
+	cached, ok := s.cache[tenantID]
+	s.mu.RUnlock()
+	if ok && time.Since(cached.loadedAt) < cacheTTL {
+		quotas := cached.quotas
+		return &quotas, nil
+	}
+
+	ctx := context.Background()
+
+	quotas := db.TenantQuotas{WarningPercent: DefaultWarningPercent}
+	err := s.db.QueryRow(ctx, `
+		SELECT max_messages_per_month, max_sms_per_month, max_storage_bytes, max_active_users, warning_percent
+		FROM tenant_quotas WHERE tenant_id = $1
+	`, tenantID).Scan(&quotas.MaxMessagesPerMonth, &quotas.MaxSMSPerMonth, &quotas.MaxStorageBytes, &quotas.MaxActiveUsers, &quotas.WarningPercent)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cache[tenantID] = cachedQuotas{quotas: quotas, loadedAt: time.Now()}
+	s.mu.Unlock()
+
+	return &quotas, nil
+}
+
+// SetQuotas replaces the limits of a tenant. Limits left out are unlimited.
+func (s *QuotaService) SetQuotas(tenantID string, quotas db.TenantQuotas) (*db.TenantQuotas, error) {
+	ctx := context.Background()
+
+	if quotas.WarningPercent == 0 {
+		quotas.WarningPercent = DefaultWarningPercent
+	}
+
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO tenant_quotas (tenant_id, max_messages_per_month, max_sms_per_month, max_storage_bytes, max_active_users, warning_percent)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant_id) DO UPDATE
+		SET max_messages_per_month = EXCLUDED.max_messages_per_month,
+			max_sms_per_month = EXCLUDED.max_sms_per_month,
+			max_storage_bytes = EXCLUDED.max_storage_bytes,
+			max_active_users = EXCLUDED.max_active_users,
+			warning_percent = EXCLUDED.warning_percent,
+			updated_at = NOW()
+	`, tenantID, quotas.MaxMessagesPerMonth, quotas.MaxSMSPerMonth, quotas.MaxStorageBytes, quotas.MaxActiveUsers, quotas.WarningPercent)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	delete(s.cache, tenantID)
+	s.mu.Unlock()
+
+	return s.GetQuotas(tenantID)
+}
+
+// limit returns the hard limit of a metric, or nil when it is unlimited
+func limit(quotas *db.TenantQuotas, metric string) *int64 {
+	switch metric {
+	case MetricMessages:
+		return quotas.MaxMessagesPerMonth
+	case MetricSMS:
+		return quotas.MaxSMSPerMonth
+	case MetricStorage:
+		return quotas.MaxStorageBytes
+	case MetricActiveUsers:
+		return quotas.MaxActiveUsers
+	}
+	return nil
+}
+
+// Consume adds amount to a tenant's usage of a metric unless that would go
+// over its limit, in which case ErrQuotaExceeded is returned and nothing is
+// recorded. A negative amount gives usage back, e.g. after a failed send.
+func (s *QuotaService) Consume(ctx context.Context, q Querier, tenantID, metric string, amount int64) error {
+	quotas, err := s.GetQuotas(tenantID)
+	if err != nil {
+		return err
+	}
+	quotaLimit := limit(quotas, metric)
+	if quotaLimit != nil && amount > *quotaLimit {
+		return fmt.Errorf("%w: %s", ErrQuotaExceeded, metric)
+	}
+
+	var used int64
+	if metric == MetricStorage {
+		err = q.QueryRow(ctx, `
+			INSERT INTO tenant_storage AS ts (tenant_id, bytes)
+			VALUES ($1, GREATEST($2, 0))
+			ON CONFLICT (tenant_id) DO UPDATE
+			SET bytes = GREATEST(ts.bytes + $2, 0), updated_at = NOW()
+			WHERE $3::bigint IS NULL OR $2 <= 0 OR ts.bytes + $2 <= $3
+			RETURNING bytes
+		`, tenantID, amount, quotaLimit).Scan(&used)
+	} else {
+		column, ok := usageColumns[metric]
+		if !ok {
+			return fmt.Errorf("unknown metric %q", metric)
+		}
+		err = q.QueryRow(ctx, `
+			INSERT INTO tenant_usage AS u (tenant_id, period, `+column+`)
+			VALUES ($1, $2, GREATEST($3, 0))
+			ON CONFLICT (tenant_id, period) DO UPDATE
+			SET `+column+` = GREATEST(u.`+column+` + $3, 0)
+			WHERE $4::bigint IS NULL OR $3 <= 0 OR u.`+column+` + $3 <= $4
+			RETURNING `+column,
+			tenantID, currentPeriod(), amount, quotaLimit).Scan(&used)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The conditional update skipped the row because of the limit
+		return fmt.Errorf("%w: %s", ErrQuotaExceeded, metric)
+	}
+	if err != nil {
+		return err
+	}
+
+	if quotaLimit != nil && amount > 0 && used*100 >= *quotaLimit*int64(quotas.WarningPercent) {
+		s.warn(tenantID, metric, used, *quotaLimit)
+	}
+
+	return nil
+}
+
+// RecordActiveUser counts a user towards the tenant's monthly active users
+// the first time they are active in a month. Call it inside the transaction
+// of the activity so a rejected user is not recorded.
+func (s *QuotaService) RecordActiveUser(ctx context.Context, q Querier, tenantID, userID string) error {
+	tag, err := q.Exec(ctx, `
+		INSERT INTO tenant_active_users (tenant_id, period, user_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, tenantID, currentPeriod(), userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	return s.Consume(ctx, q, tenantID, MetricActiveUsers, 1)
+}
+
+// warn notifies a tenant's owners and admins the first time a metric passes
+// the warning threshold in a month
+func (s *QuotaService) warn(tenantID, metric string, used, quotaLimit int64) {
+	ctx := context.Background()
+
+	tag, err := s.db.Exec(ctx, `
+		INSERT INTO tenant_quota_warnings (tenant_id, period, metric)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, tenantID, currentPeriod(), metric)
+	if err != nil || tag.RowsAffected() == 0 {
+		return
+	}
+
+	log.Printf("Tenant %s reached %d of %d %s quota", tenantID, used, quotaLimit, metric)
+
+	if s.notificationService == nil {
+		return
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT id FROM users
+		WHERE tenant_id = $1 AND role IN ('owner', 'admin') AND deleted_at IS NULL
+	`, tenantID)
+	if err != nil {
+		log.Printf("Failed to load admins for quota warning: %v", err)
+		return
+	}
+	adminIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		log.Printf("Failed to load admins for quota warning: %v", err)
+		return
+	}
+
+	s.notificationService.NotifyUsers(adminIDs, db.Notification{
+		Type:     "quota_warning",
+		Priority: notification.PriorityHigh,
+		Payload: map[string]interface{}{
+			"metric": metric,
+			"used":   used,
+			"limit":  quotaLimit,
+		},
+	})
+}
+
+// GetUsage returns a tenant's usage in the month starting at period
+func (s *QuotaService) GetUsage(tenantID string, period time.Time) (*db.TenantUsage, error) {
+	usage, err := s.usageReport(period, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if len(usage) == 0 {
+		return nil, errors.New("tenant not found")
+	}
+	return &usage[0], nil
+}
+
+// UsageReport returns the usage of every tenant in the month starting at
+// period, for billing
+func (s *QuotaService) UsageReport(period time.Time) ([]db.TenantUsage, error) {
+	return s.usageReport(period, "")
+}
+
+// usageReport loads monthly usage for one tenant, or all when tenantID is empty
+func (s *QuotaService) usageReport(period time.Time, tenantID string) ([]db.TenantUsage, error) {
+	ctx := context.Background()
+
+	rows, err := s.db.Query(ctx, `
+		SELECT t.id, t.name,
+			COALESCE(u.messages_sent, 0), COALESCE(u.sms_sent, 0), COALESCE(u.active_users, 0),
+			COALESCE(ts.bytes, 0),
+			q.max_messages_per_month, q.max_sms_per_month, q.max_storage_bytes, q.max_active_users,
+			COALESCE(q.warning_percent, $3)
+		FROM tenants t
+		LEFT JOIN tenant_usage u ON u.tenant_id = t.id AND u.period = $1
+		LEFT JOIN tenant_storage ts ON ts.tenant_id = t.id
+		LEFT JOIN tenant_quotas q ON q.tenant_id = t.id
+		WHERE $2 = '' OR t.id::text = $2
+		ORDER BY t.name
+	`, period, tenantID, DefaultWarningPercent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []db.TenantUsage{}
+	for rows.Next() {
+		usage := db.TenantUsage{Period: period.Format("2006-01")}
+		err := rows.Scan(&usage.TenantID, &usage.TenantName,
+			&usage.MessagesSent, &usage.SMSSent, &usage.ActiveUsers, &usage.StorageBytes,
+			&usage.Quotas.MaxMessagesPerMonth, &usage.Quotas.MaxSMSPerMonth, &usage.Quotas.MaxStorageBytes, &usage.Quotas.MaxActiveUsers,
+			&usage.Quotas.WarningPercent)
+		if err != nil {
+			return nil, err
+		}
+		report = append(report, usage)
+	}
+
+	return report, rows.Err()
+}
+
+// RecalculateStorage corrects every tenant's storage total from the data
+// actually stored, undoing drift from deletions
+func (s *QuotaService) RecalculateStorage() error {
+	ctx := db.SystemContext(context.Background())
+
+	return db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			WITH totals AS (
+				SELECT t.id AS tenant_id,
+					COALESCE((
+						SELECT SUM(octet_length(m.content)) FROM messages m
+						WHERE m.tenant_id = t.id AND m.type = 'user'
+					), 0) + COALESCE((
+						SELECT SUM(octet_length(mr.content)) FROM message_revisions mr
+						WHERE mr.tenant_id = t.id
+					), 0) + COALESCE((
+						SELECT SUM(a.size + COALESCE(a.thumbnail_size, 0)) FROM attachments a
+						WHERE a.tenant_id = t.id
+					), 0) AS bytes
+				FROM tenants t
+			)
+			INSERT INTO tenant_storage (tenant_id, bytes)
+			SELECT tenant_id, bytes FROM totals
+			ON CONFLICT (tenant_id) DO UPDATE
+			SET bytes = EXCLUDED.bytes, updated_at = NOW()
+		`)
+		return err
+	})
+}
+
+// StartStorageJob periodically recalculates tenant storage totals
+func (s *QuotaService) StartStorageJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := s.RecalculateStorage(); err != nil {
+				log.Printf("Storage recalculation job failed: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,255 @@
+package settings
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/quota"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	SignupEmail = "email"
+	SignupPhone = "phone"
+)
+
+// cacheTTL bounds how stale settings can be on other server instances
+const cacheTTL = 5 * time.Minute
+
+// Defaults returns the settings of a tenant that has not overridden anything
+func Defaults() db.TenantSettings {
+	return db.TenantSettings{
+		MessageRetentionDays: 0,
+		EditWindowMinutes:    15,
+		SearchLanguage:       "english",
+		MaxUploadSizeMB:      25,
+		AllowNonContactDMs:   true,
+		Require2FA:           false,
+		SignupMethods:        []string{SignupEmail, SignupPhone},
+		OpenSignup:           false,
+	}
+}
+
+// AllowsSignup reports whether the settings allow a signup method
+func AllowsSignup(settings *db.TenantSettings, method string) bool {
+	for _, allowed := range settings.SignupMethods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+type cachedSettings struct {
+	settings db.TenantSettings
+	loadedAt time.Time
+}
+
+// SettingsService stores per-tenant policies. Only overridden keys are kept in
+// the database and merged over typed defaults when loaded.
+type SettingsService struct {
+	db           *pgxpool.Pool
+	quotaService *quota.QuotaService
+	cache        map[string]cachedSettings // tenantID -> settings
+	mu           sync.RWMutex
+}
+
+func NewSettingsService(database *pgxpool.Pool, quotaService *quota.QuotaService) *SettingsService {
+	return &SettingsService{
+		db:           database,
+		quotaService: quotaService,
+		cache:        make(map[string]cachedSettings),
+	}
+}
+
+// GetSettings returns the effective settings of a tenant
+func (s *SettingsService) GetSettings(tenantID string) (*db.TenantSettings, error) {
+	s.mu.RLock()
+	cached, ok := s.cache[tenantID]
+	s.mu.RUnlock()
+	if ok && time.Since(cached.loadedAt) < cacheTTL {
+		settings := cached.settings
+		return &settings, nil
+	}
+
+	settings, err := s.load(context.Background(), tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cache[tenantID] = cachedSettings{settings: *settings, loadedAt: time.Now()}
+	s.mu.Unlock()
+
+	return settings, nil
+}
+
+// load reads a tenant's overrides and applies them over the defaults
+func (s *SettingsService) load(ctx context.Context, tenantID string) (*db.TenantSettings, error) {
+	settings := Defaults()
+
+	var raw []byte
+	err := s.db.QueryRow(ctx, "SELECT settings FROM tenant_settings WHERE tenant_id = $1", tenantID).Scan(&raw)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+// UpdateSettings changes the settings that are set in the request and
+// returns the effective settings
+func (s *SettingsService) UpdateSettings(tenantID string, req db.UpdateTenantSettingsRequest) (*db.TenantSettings, error) {
+	ctx := context.Background()
+
+	// Only the keys present in the request are stored, so tenants keep
+	// following the defaults for everything they never changed
+	overrides := map[string]interface{}{}
+	if req.MessageRetentionDays != nil {
+		overrides["message_retention_days"] = *req.MessageRetentionDays
+	}
+	if req.EditWindowMinutes != nil {
+		overrides["edit_window_minutes"] = *req.EditWindowMinutes
+	}
+	if req.SearchLanguage != nil {
+		overrides["search_language"] = *req.SearchLanguage
+	}
+	if req.MaxUploadSizeMB != nil {
+		overrides["max_upload_size_mb"] = *req.MaxUploadSizeMB
+	}
+	if req.AllowNonContactDMs != nil {
+		overrides["allow_non_contact_dms"] = *req.AllowNonContactDMs
+	}
+	if req.Require2FA != nil {
+		overrides["require_2fa"] = *req.Require2FA
+	}
+	if req.SignupMethods != nil {
+		overrides["signup_methods"] = req.SignupMethods
+	}
+	if req.OpenSignup != nil {
+		overrides["open_signup"] = *req.OpenSignup
+	}
+	if req.SMSSenderID != nil {
+		overrides["sms_sender_id"] = *req.SMSSenderID
+	}
+
+	patch, err := json.Marshal(overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO tenant_settings (tenant_id, settings)
+		VALUES ($1, $2::jsonb)
+		ON CONFLICT (tenant_id) DO UPDATE
+		SET settings = tenant_settings.settings || EXCLUDED.settings, updated_at = NOW()
+	`, tenantID, string(patch))
+	if err != nil {
+		return nil, errors.New("tenant not found")
+	}
+
+	s.mu.Lock()
+	delete(s.cache, tenantID)
+	s.mu.Unlock()
+
+	return s.GetSettings(tenantID)
+}
+
+// ApplyMessageRetention deletes messages older than their tenant's retention
+// period, gives back the storage of their content and revisions, and returns
+// how many were removed. Thread roots are kept while replies within the
+// retention period depend on them; they expire with their last reply.
+func (s *SettingsService) ApplyMessageRetention() (int64, error) {
+	ctx := db.SystemContext(context.Background())
+
+	var deleted int64
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		// System messages are not metered, so only count the content of
+		// others
+		rows, err := tx.Query(ctx, `
+			WITH retention AS (
+				SELECT tenant_id, NOW() - make_interval(days => (settings->>'message_retention_days')::int) AS cutoff
+				FROM tenant_settings
+				WHERE COALESCE((settings->>'message_retention_days')::int, 0) > 0
+			),
+			expired AS (
+				SELECT m.id, m.tenant_id,
+					CASE WHEN m.type = 'system' THEN 0 ELSE octet_length(m.content) END + COALESCE((
+						SELECT SUM(octet_length(mr.content)) FROM message_revisions mr WHERE mr.message_id = m.id
+					), 0) AS bytes
+				FROM messages m
+				JOIN retention r ON r.tenant_id = m.tenant_id
+				WHERE m.sent_at < r.cutoff
+				AND NOT EXISTS (
+					SELECT 1 FROM messages reply
+					WHERE reply.thread_root_id = m.id AND reply.sent_at >= r.cutoff
+				)
+			),
+			removed AS (
+				DELETE FROM messages m USING expired e WHERE m.id = e.id
+			)
+			SELECT tenant_id, COUNT(*), SUM(bytes)::bigint FROM expired GROUP BY tenant_id
+		`)
+		if err != nil {
+			return err
+		}
+		freed := make(map[string]int64)
+		for rows.Next() {
+			var tenantID string
+			var count, bytes int64
+			if err := rows.Scan(&tenantID, &count, &bytes); err != nil {
+				rows.Close()
+				return err
+			}
+			deleted += count
+			freed[tenantID] = bytes
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if s.quotaService != nil {
+			for tenantID, bytes := range freed {
+				if err := s.quotaService.Consume(ctx, tx, tenantID, quota.MetricStorage, -bytes); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+
+	return deleted, err
+}
+
+// StartRetentionJob periodically deletes messages past their retention period
+func (s *SettingsService) StartRetentionJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			deleted, err := s.ApplyMessageRetention()
+			if err != nil {
+				log.Printf("Message retention job failed: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("Message retention job deleted %d messages", deleted)
+			}
+		}
+	}()
+}
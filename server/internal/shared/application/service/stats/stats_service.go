@@ -0,0 +1,271 @@
+package stats
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/websocket"
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// cacheTTL is how long the database-backed part of the stats is reused
+const cacheTTL = time.Minute
+
+// messageHistoryDays is how many days of message volume the stats include
+const messageHistoryDays = 30
+
+// StatsService serves system statistics. Counts over the messages table are
+// pre-aggregated by a periodic rollup job and the result is cached so the
+// endpoint stays fast on large tables.
+type StatsService struct {
+	db        *pgxpool.Pool
+	wsService *websocket.WebSocketService
+	cached    *db.SystemStats
+	cachedAt  time.Time
+	mu        sync.Mutex
+}
+
+func NewStatsService(database *pgxpool.Pool, wsService *websocket.WebSocketService) *StatsService {
+	return &StatsService{
+		db:        database,
+		wsService: wsService,
+	}
+}
+
+// GetSystemStats returns the current system statistics
+func (s *StatsService) GetSystemStats() (*db.SystemStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cached == nil || time.Since(s.cachedAt) > cacheTTL {
+		// Platform stats span all tenants, so they are read in system context
+		ctx := db.SystemContext(context.Background())
+		var stats *db.SystemStats
+		err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+			var err error
+			stats, err = collect(ctx, tx)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.cached = stats
+		s.cachedAt = time.Now()
+	}
+
+	// Live WebSocket numbers are cheap, so they are never cached
+	stats := *s.cached
+	stats.WebSocket = db.WebSocketStats{
+		ConnectedClients: s.wsService.GetConnectedClients(),
+		RoomSubscribers:  s.wsService.GetRoomSubscriberCounts(),
+	}
+
+	return &stats, nil
+}
+
+// collect gathers the database-backed statistics
+func collect(ctx context.Context, tx pgx.Tx) (*db.SystemStats, error) {
+	stats := &db.SystemStats{
+		UsersPerTenant: []db.TenantUserCount{},
+		RoomsByType:    map[string]int{},
+		MessagesPerDay: []db.DailyCount{},
+		GeneratedAt:    time.Now(),
+	}
+
+	// Users per tenant, not counting purged accounts
+	rows, err := tx.Query(ctx, `
+		SELECT t.id, t.name, COUNT(u.id)
+		FROM tenants t
+		LEFT JOIN users u ON u.tenant_id = t.id AND u.purged_at IS NULL
+		GROUP BY t.id, t.name
+		ORDER BY t.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var count db.TenantUserCount
+		if err := rows.Scan(&count.TenantID, &count.TenantName, &count.UserCount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.UsersPerTenant = append(stats.UsersPerTenant, count)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Active users from the rollup table
+	err = tx.QueryRow(ctx, `
+		SELECT
+			COUNT(DISTINCT user_id) FILTER (WHERE day >= CURRENT_DATE),
+			COUNT(DISTINCT user_id) FILTER (WHERE day > CURRENT_DATE - 7),
+			COUNT(DISTINCT user_id)
+		FROM daily_active_users
+		WHERE day > CURRENT_DATE - 30
+	`).Scan(&stats.ActiveUsers.Last1Day, &stats.ActiveUsers.Last7Days, &stats.ActiveUsers.Last30Days)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rooms by type
+	rows, err = tx.Query(ctx, "SELECT type, COUNT(*) FROM rooms GROUP BY type")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var roomType string
+		var count int
+		if err := rows.Scan(&roomType, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.RoomsByType[roomType] = count
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Message volume per day from the rollup table
+	rows, err = tx.Query(ctx, `
+		SELECT to_char(day, 'YYYY-MM-DD'), SUM(message_count)
+		FROM daily_message_stats
+		WHERE day > CURRENT_DATE - $1::int
+		GROUP BY day
+		ORDER BY day
+	`, messageHistoryDays)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var count db.DailyCount
+		if err := rows.Scan(&count.Day, &count.Count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.MessagesPerDay = append(stats.MessagesPerDay, count)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// OTP sends and failures
+	err = tx.QueryRow(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE event = 'sent' AND created_at > NOW() - INTERVAL '1 day'),
+			COUNT(*) FILTER (WHERE event = 'send_failed' AND created_at > NOW() - INTERVAL '1 day'),
+			COUNT(*) FILTER (WHERE event = 'verify_failed' AND created_at > NOW() - INTERVAL '1 day'),
+			COUNT(*) FILTER (WHERE event = 'sent'),
+			COUNT(*) FILTER (WHERE event = 'send_failed'),
+			COUNT(*) FILTER (WHERE event = 'verify_failed')
+		FROM otp_events
+		WHERE created_at > NOW() - INTERVAL '30 days'
+	`).Scan(&stats.OTP.Sent24h, &stats.OTP.SendFailed24h, &stats.OTP.VerifyFailed24h,
+		&stats.OTP.Sent30d, &stats.OTP.SendFailed30d, &stats.OTP.VerifyFailed30d)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// RunRollup refreshes the pre-aggregated message and activity tables. Only
+// the last two days are recomputed once the tables have been backfilled.
+func (s *StatsService) RunRollup() error {
+	ctx := db.SystemContext(context.Background())
+
+	var since time.Time
+	var lastDay *time.Time
+	err := s.db.QueryRow(ctx, "SELECT MAX(day) FROM daily_message_stats").Scan(&lastDay)
+	if err != nil {
+		return err
+	}
+	if lastDay != nil {
+		since = lastDay.AddDate(0, 0, -1)
+	}
+
+	return db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		return rollupSince(ctx, tx, since)
+	})
+}
+
+// rollupSince recomputes the rollup tables from the given day onwards
+func rollupSince(ctx context.Context, tx pgx.Tx, since time.Time) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO daily_message_stats (day, tenant_id, message_count)
+		SELECT sent_at::date, tenant_id, COUNT(*)
+		FROM messages
+		WHERE sent_at >= $1 AND type <> 'system'
+		GROUP BY sent_at::date, tenant_id
+		ON CONFLICT (day, tenant_id) DO UPDATE SET message_count = EXCLUDED.message_count
+	`, since)
+	if err != nil {
+		return err
+	}
+
+	// A user counts as active on a day if they sent a message or were online
+	_, err = tx.Exec(ctx, `
+		INSERT INTO daily_active_users (day, tenant_id, user_id)
+		SELECT DISTINCT sent_at::date, tenant_id, user_id
+		FROM messages
+		WHERE sent_at >= $1 AND type <> 'system'
+		ON CONFLICT (day, user_id) DO NOTHING
+	`, since)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO daily_active_users (day, tenant_id, user_id)
+		SELECT last_seen_at::date, tenant_id, id
+		FROM users
+		WHERE last_seen_at >= $1 AND purged_at IS NULL
+		ON CONFLICT (day, user_id) DO NOTHING
+	`, since)
+	return err
+}
+
+// RecordActivity marks users with live connections as active today, since
+// last_seen_at is only written when they disconnect
+func (s *StatsService) RecordActivity(userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO daily_active_users (day, tenant_id, user_id)
+		SELECT CURRENT_DATE, tenant_id, id
+		FROM users
+		WHERE id = ANY($1::uuid[])
+		ON CONFLICT (day, user_id) DO NOTHING
+	`, userIDs)
+
+	return err
+}
+
+// StartRollupJob runs the rollup immediately and then on every interval
+func (s *StatsService) StartRollupJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.RunRollup(); err != nil {
+				log.Printf("Stats rollup job failed: %v", err)
+			}
+			if err := s.RecordActivity(s.wsService.GetOnlineUsers()); err != nil {
+				log.Printf("Failed to record active users: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrBlobNotFound is returned when a key does not exist in the store
+var ErrBlobNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for keys that are empty or could escape the
+// store, such as keys with ".." segments
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore keeps file contents outside the database. Keys are
+// slash-separated paths chosen by the caller.
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing any previous
+	// content
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the content stored under key. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// validKey rejects keys that are not plain relative paths
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// NewBlobStoreFromEnv configures the blob store from the environment.
+// BLOB_STORE selects "local" (the default), which keeps files under
+// BLOB_LOCAL_DIR, or "s3" for Amazon S3 and S3-compatible servers such as
+// MinIO, configured with S3_BUCKET, S3_REGION, S3_ENDPOINT,
+// S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY and S3_FORCE_PATH_STYLE.
+func NewBlobStoreFromEnv() (BlobStore, error) {
+	switch backend := os.Getenv("BLOB_STORE"); backend {
+	case "", "local":
+		dir := os.Getenv("BLOB_LOCAL_DIR")
+		if dir == "" {
+			dir = "data/blobs"
+		}
+		return NewLocalStore(dir)
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			ForcePathStyle:  os.Getenv("S3_FORCE_PATH_STYLE") == "true",
+		})
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q", backend)
+	}
+}
@@ -0,0 +1,610 @@
+package tenant
+
+import (
+	"ChitChat/internal/shared/application/service/auth"
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/settings"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+)
+
+// InviteTTL is how long a tenant invitation can be redeemed by default
+const InviteTTL = 7 * 24 * time.Hour
+
+var (
+	ErrTenantNotFound  = errors.New("tenant not found")
+	ErrTenantSuspended = errors.New("tenant suspended")
+	ErrInvalidInvite   = errors.New("invitation is invalid, used or expired")
+	ErrInviteNotFound  = errors.New("invitation not found")
+	// ErrInviteRequired is returned for signups without an invitation to a
+	// tenant that does not take them, or that claim a tenant's email domain
+	// with an address nobody verified
+	ErrInviteRequired = errors.New("an invitation is required to join this tenant")
+)
+
+// inviteColumns are the columns scanned by scanInvite
+const inviteColumns = `
+	i.id, i.tenant_id, i.code, i.role, i.email, i.phone_number, i.max_uses, i.use_count,
+	i.expires_at, i.revoked_at, i.created_by, i.created_at,
+	CASE
+		WHEN i.revoked_at IS NOT NULL THEN 'revoked'
+		WHEN i.use_count >= i.max_uses THEN 'used'
+		WHEN i.expires_at <= NOW() THEN 'expired'
+		ELSE 'active'
+	END`
+
+// redeemableInvite matches invitations that can still place a new user
+const redeemableInvite = `i.revoked_at IS NULL AND i.use_count < i.max_uses AND i.expires_at > NOW()`
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+// Placement is where a new user lands: their tenant, their role and the
+// invitation that put them there, if any
+type Placement struct {
+	TenantID string
+	Role     string
+	InviteID string
+}
+
+// TenantService provisions tenants and decides which tenant a signup joins
+type TenantService struct {
+	db              *pgxpool.Pool
+	settingsService *settings.SettingsService
+	smsService      auth.SMSService
+	emailService    auth.EmailService
+	baseDomain      string
+	appBaseURL      string
+}
+
+func NewTenantService(database *pgxpool.Pool, settingsService *settings.SettingsService) *TenantService {
+	return &TenantService{
+		db:              database,
+		settingsService: settingsService,
+		smsService:      auth.GetSMSService(),
+		emailService:    auth.GetEmailService(),
+		baseDomain:      strings.ToLower(os.Getenv("TENANT_BASE_DOMAIN")),
+		appBaseURL:      strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/"),
+	}
+}
+
+// SlugFromHost returns the tenant slug encoded as a subdomain of the
+// configured base domain, e.g. "acme" for "acme.chitchat.app"
+func (s *TenantService) SlugFromHost(host string) string {
+	if s.baseDomain == "" {
+		return ""
+	}
+
+	host = strings.ToLower(host)
+	if i := strings.LastIndex(host, ":"); i != -1 {
+		host = host[:i]
+	}
+
+	slug, ok := strings.CutSuffix(host, "."+s.baseDomain)
+	if !ok || strings.Contains(slug, ".") {
+		return ""
+	}
+	return slug
+}
+
+// ResolveSignupTenant picks the tenant for a new user. An invitation code
+// wins, then an explicit slug or subdomain, then the verified email domain,
+// and finally the default tenant. Without an invitation, the tenant must
+// have open signup. A redeemed invitation is claimed immediately;
+// call CompleteInvite once the user exists or ReleaseInvite if signup fails.
+// Invitations addressed to an email address or phone number only place the
+// user signing up with it.
+func (s *TenantService) ResolveSignupTenant(hint db.TenantHint) (*Placement, error) {
+	ctx := context.Background()
+
+	if hint.InviteCode != "" {
+		placement := Placement{}
+		err := s.db.QueryRow(ctx, `
+			UPDATE tenant_invites i
+			SET use_count = i.use_count + 1
+			FROM tenants t
+			WHERE i.tenant_id = t.id AND i.code = $1 AND `+redeemableInvite+` AND t.status = 'active'
+				AND (i.email IS NULL OR LOWER(i.email) = LOWER($2))
+				AND (i.phone_number IS NULL OR i.phone_number = $3)
+			RETURNING i.id, i.tenant_id, i.role
+		`, strings.ToUpper(hint.InviteCode), hint.Email, hint.PhoneNumber).Scan(&placement.InviteID, &placement.TenantID, &placement.Role)
+		if err != nil {
+			return nil, ErrInvalidInvite
+		}
+		return &placement, nil
+	}
+
+	tenantID, err := s.lookupTenant(ctx, hint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Placement{TenantID: tenantID, Role: "user"}, nil
+}
+
+// LookupTenant returns the tenant a signup with the given hint would join,
+// without redeeming its invitation
+func (s *TenantService) LookupTenant(hint db.TenantHint) (string, error) {
+	ctx := context.Background()
+
+	if hint.InviteCode != "" {
+		var tenantID string
+		err := s.db.QueryRow(ctx, `
+			SELECT i.tenant_id FROM tenant_invites i
+			WHERE i.code = $1 AND `+redeemableInvite+`
+		`, strings.ToUpper(hint.InviteCode)).Scan(&tenantID)
+		if err != nil {
+			return "", ErrInvalidInvite
+		}
+		return tenantID, nil
+	}
+
+	return s.lookupTenant(ctx, hint)
+}
+
+// lookupTenant resolves a tenant from the slug, then the email domain, and
+// finally falls back to the default tenant. The tenant must have open
+// signup, and the email address must be verified to join by its domain.
+func (s *TenantService) lookupTenant(ctx context.Context, hint db.TenantHint) (string, error) {
+	var query string
+	var arg interface{}
+	switch {
+	case hint.Slug != "":
+		query, arg = "SELECT id, status FROM tenants WHERE slug = $1", strings.ToLower(hint.Slug)
+	case strings.Contains(hint.Email, "@"):
+		domain := strings.ToLower(hint.Email[strings.LastIndex(hint.Email, "@")+1:])
+		query, arg = "SELECT id, status FROM tenants WHERE email_domain = $1", domain
+	}
+
+	var tenantID, status string
+	var err error
+	if query != "" {
+		err = s.db.QueryRow(ctx, query, arg).Scan(&tenantID, &status)
+		if errors.Is(err, pgx.ErrNoRows) && hint.Slug != "" {
+			// An unknown slug is a client mistake, not a reason to fall back
+			return "", ErrTenantNotFound
+		}
+		if err == nil && hint.Slug == "" && !hint.EmailVerified {
+			// Anyone can type an address of the domain
+			return "", ErrInviteRequired
+		}
+	}
+	if query == "" || errors.Is(err, pgx.ErrNoRows) {
+		err = s.db.QueryRow(ctx, "SELECT id, status FROM tenants WHERE is_default").Scan(&tenantID, &status)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrTenantNotFound
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if status != StatusActive {
+		return "", ErrTenantSuspended
+	}
+
+	tenantSettings, err := s.settingsService.GetSettings(tenantID)
+	if err != nil {
+		return "", err
+	}
+	if !tenantSettings.OpenSignup {
+		return "", ErrInviteRequired
+	}
+
+	return tenantID, nil
+}
+
+// CompleteInvite records which user redeemed a claimed invitation
+func (s *TenantService) CompleteInvite(inviteID, userID string) error {
+	ctx := context.Background()
+
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO tenant_invite_redemptions (invite_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, inviteID, userID)
+	return err
+}
+
+// ReleaseInvite gives back the use a failed signup claimed
+func (s *TenantService) ReleaseInvite(inviteID string) error {
+	ctx := context.Background()
+
+	_, err := s.db.Exec(ctx, "UPDATE tenant_invites SET use_count = use_count - 1 WHERE id = $1 AND use_count > 0", inviteID)
+	return err
+}
+
+// PreviewInvite describes a redeemable invitation for its join page
+func (s *TenantService) PreviewInvite(code string) (*db.InvitePreview, error) {
+	ctx := context.Background()
+
+	var preview db.InvitePreview
+	err := s.db.QueryRow(ctx, `
+		SELECT t.name, i.role, i.expires_at
+		FROM tenant_invites i
+		JOIN tenants t ON t.id = i.tenant_id
+		WHERE i.code = $1 AND `+redeemableInvite+` AND t.status = 'active'
+	`, strings.ToUpper(code)).Scan(&preview.TenantName, &preview.Role, &preview.ExpiresAt)
+	if err != nil {
+		return nil, ErrInvalidInvite
+	}
+
+	return &preview, nil
+}
+
+// CreateInvite issues an invitation for a tenant. Invitations for an email
+// address or phone number are single-use and sent to their recipient; without
+// either, the invitation is a join link usable MaxUses times. Delivery
+// failures are logged and reported, the invitation stays valid either way.
+func (s *TenantService) CreateInvite(tenantID, createdBy string, req db.CreateInviteRequest) (*db.TenantInvite, bool, error) {
+	ctx := context.Background()
+
+	if req.Email != "" && req.PhoneNumber != "" {
+		return nil, false, errors.New("an invitation is for an email address or a phone number, not both")
+	}
+	if req.Role == "" {
+		req.Role = "user"
+	}
+	maxUses := req.MaxUses
+	if req.Email != "" || req.PhoneNumber != "" || maxUses == 0 {
+		maxUses = 1
+	}
+	ttl := InviteTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	tenant, err := s.GetTenant(tenantID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	invite, err := insertInvite(ctx, tx, inviteParams{
+		tenantID:    tenantID,
+		role:        req.Role,
+		email:       req.Email,
+		phoneNumber: req.PhoneNumber,
+		maxUses:     maxUses,
+		ttl:         ttl,
+		createdBy:   createdBy,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, err
+	}
+
+	invite.JoinURL = s.joinURL(invite.Code)
+	return invite, s.deliverInvite(tenant, invite), nil
+}
+
+// deliverInvite sends an addressed invitation to its recipient and reports
+// whether it was sent. Join links are shared by the admin and never sent.
+func (s *TenantService) deliverInvite(tenant *db.Tenant, invite *db.TenantInvite) bool {
+	var err error
+	switch {
+	case invite.Email != nil:
+		body := fmt.Sprintf("You have been invited to join %s on ChitChat.\n\nSign up with this email address and the invitation code %s", tenant.Name, invite.Code)
+		if invite.JoinURL != "" {
+			body += " or open " + invite.JoinURL
+		}
+		body += fmt.Sprintf(".\n\nThe invitation expires on %s.\n", invite.ExpiresAt.Format("2006-01-02"))
+		err = s.emailService.SendEmail(*invite.Email, "Your invitation to "+tenant.Name, body)
+	case invite.PhoneNumber != nil:
+		senderID := ""
+		if tenantSettings, err := s.settingsService.GetSettings(tenant.ID); err == nil {
+			senderID = tenantSettings.SMSSenderID
+		}
+		message := fmt.Sprintf("You have been invited to join %s on ChitChat. Your invitation code is: %s", tenant.Name, invite.Code)
+		err = s.smsService.SendSMS(*invite.PhoneNumber, message, senderID)
+	default:
+		return false
+	}
+
+	if err != nil {
+		log.Printf("Failed to deliver invitation %s: %v", invite.ID, err)
+		return false
+	}
+	return true
+}
+
+// ListInvites retrieves every invitation of a tenant, newest first
+func (s *TenantService) ListInvites(tenantID string) ([]db.TenantInvite, error) {
+	ctx := context.Background()
+
+	rows, err := s.db.Query(ctx, `
+		SELECT `+inviteColumns+`
+		FROM tenant_invites i
+		WHERE i.tenant_id = $1
+		ORDER BY i.created_at DESC
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []db.TenantInvite{}
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invite.JoinURL = s.joinURL(invite.Code)
+		invites = append(invites, *invite)
+	}
+
+	return invites, rows.Err()
+}
+
+// RevokeInvite stops an invitation of a tenant from being redeemed
+func (s *TenantService) RevokeInvite(tenantID, inviteID string) error {
+	ctx := context.Background()
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE tenant_invites SET revoked_at = NOW()
+		WHERE id = $1 AND tenant_id = $2 AND revoked_at IS NULL
+	`, inviteID, tenantID)
+	if err != nil {
+		return ErrInviteNotFound
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInviteNotFound
+	}
+
+	return nil
+}
+
+// joinURL returns the link that opens the signup page with the invitation
+// code filled in, or empty when APP_BASE_URL is not configured
+func (s *TenantService) joinURL(code string) string {
+	if s.appBaseURL == "" {
+		return ""
+	}
+	return s.appBaseURL + "/join/" + code
+}
+
+// CreateTenant provisions a tenant along with an invitation for its first owner
+func (s *TenantService) CreateTenant(req db.CreateTenantRequest) (*db.Tenant, *db.TenantInvite, error) {
+	ctx := context.Background()
+
+	slug, emailDomain, err := normalizeTenantFields(req.Slug, req.EmailDomain)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var tenant db.Tenant
+	err = tx.QueryRow(ctx, `
+		INSERT INTO tenants (name, slug, email_domain)
+		VALUES ($1, $2, $3)
+		RETURNING id, name, slug, email_domain, status, is_default, created_at
+	`, req.Name, slug, emailDomain).Scan(&tenant.ID, &tenant.Name, &tenant.Slug, &tenant.EmailDomain, &tenant.Status, &tenant.IsDefault, &tenant.CreatedAt)
+	if err != nil {
+		return nil, nil, errors.New("slug or email domain is already in use")
+	}
+
+	invite, err := insertInvite(ctx, tx, inviteParams{tenantID: tenant.ID, role: "owner", maxUses: 1, ttl: InviteTTL})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	invite.JoinURL = s.joinURL(invite.Code)
+	return &tenant, invite, nil
+}
+
+// CreateOwnerInvite issues a new owner invitation for an existing tenant
+func (s *TenantService) CreateOwnerInvite(tenantID string) (*db.TenantInvite, error) {
+	ctx := context.Background()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	invite, err := insertInvite(ctx, tx, inviteParams{tenantID: tenantID, role: "owner", maxUses: 1, ttl: InviteTTL})
+	if err != nil {
+		return nil, ErrTenantNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	invite.JoinURL = s.joinURL(invite.Code)
+	return invite, nil
+}
+
+// GetTenant retrieves a tenant by ID
+func (s *TenantService) GetTenant(tenantID string) (*db.Tenant, error) {
+	ctx := context.Background()
+
+	var tenant db.Tenant
+	err := s.db.QueryRow(ctx, `
+		SELECT id, name, slug, email_domain, status, is_default, created_at
+		FROM tenants WHERE id = $1
+	`, tenantID).Scan(&tenant.ID, &tenant.Name, &tenant.Slug, &tenant.EmailDomain, &tenant.Status, &tenant.IsDefault, &tenant.CreatedAt)
+	if err != nil {
+		return nil, ErrTenantNotFound
+	}
+
+	return &tenant, nil
+}
+
+// ListTenants retrieves all tenants
+func (s *TenantService) ListTenants() ([]db.Tenant, error) {
+	ctx := context.Background()
+
+	rows, err := s.db.Query(ctx, `
+		SELECT id, name, slug, email_domain, status, is_default, created_at
+		FROM tenants
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenants := []db.Tenant{}
+	for rows.Next() {
+		var tenant db.Tenant
+		if err := rows.Scan(&tenant.ID, &tenant.Name, &tenant.Slug, &tenant.EmailDomain, &tenant.Status, &tenant.IsDefault, &tenant.CreatedAt); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	return tenants, rows.Err()
+}
+
+// UpdateTenant changes the fields of a tenant that are set in the request.
+// An empty slug or email domain removes it.
+func (s *TenantService) UpdateTenant(tenantID string, req db.UpdateTenantRequest) (*db.Tenant, error) {
+	ctx := context.Background()
+
+	tenant, err := s.GetTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			return nil, errors.New("name cannot be empty")
+		}
+		tenant.Name = *req.Name
+	}
+	if req.Slug != nil || req.EmailDomain != nil {
+		slug, emailDomain := "", ""
+		if req.Slug != nil {
+			slug = *req.Slug
+		} else if tenant.Slug != nil {
+			slug = *tenant.Slug
+		}
+		if req.EmailDomain != nil {
+			emailDomain = *req.EmailDomain
+		} else if tenant.EmailDomain != nil {
+			emailDomain = *tenant.EmailDomain
+		}
+		tenant.Slug, tenant.EmailDomain, err = normalizeTenantFields(slug, emailDomain)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if req.Status != nil {
+		if tenant.IsDefault && *req.Status != StatusActive {
+			return nil, errors.New("the default tenant cannot be suspended")
+		}
+		tenant.Status = *req.Status
+	}
+
+	_, err = s.db.Exec(ctx, `
+		UPDATE tenants SET name = $1, slug = $2, email_domain = $3, status = $4
+		WHERE id = $5
+	`, tenant.Name, tenant.Slug, tenant.EmailDomain, tenant.Status, tenantID)
+	if err != nil {
+		return nil, errors.New("slug or email domain is already in use")
+	}
+
+	return tenant, nil
+}
+
+// normalizeTenantFields validates a slug and email domain, returning nil for
+// empty values so they are stored as NULL
+func normalizeTenantFields(slug, emailDomain string) (*string, *string, error) {
+	var slugValue, domainValue *string
+
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if slug != "" {
+		if !slugPattern.MatchString(slug) {
+			return nil, nil, errors.New("slug must be 2-63 lowercase letters, digits or hyphens")
+		}
+		slugValue = &slug
+	}
+
+	emailDomain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(emailDomain), "@"))
+	if emailDomain != "" {
+		if !strings.Contains(emailDomain, ".") || strings.ContainsAny(emailDomain, "@ /") {
+			return nil, nil, errors.New("invalid email domain")
+		}
+		domainValue = &emailDomain
+	}
+
+	return slugValue, domainValue, nil
+}
+
+// inviteParams describes an invitation to store
+type inviteParams struct {
+	tenantID    string
+	role        string
+	email       string // empty for join links
+	phoneNumber string
+	maxUses     int
+	ttl         time.Duration
+	createdBy   string // empty for platform-issued invitations
+}
+
+// insertInvite stores a new invitation with a random code
+func insertInvite(ctx context.Context, tx pgx.Tx, params inviteParams) (*db.TenantInvite, error) {
+	code, err := generateInviteCode()
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(ctx, `
+		INSERT INTO tenant_invites AS i (tenant_id, code, role, email, phone_number, max_uses, expires_at, created_by)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, NOW() + make_interval(secs => $7), NULLIF($8, '')::uuid)
+		RETURNING `+inviteColumns,
+		params.tenantID, code, params.role, params.email, params.phoneNumber, params.maxUses, params.ttl.Seconds(), params.createdBy)
+	return scanInvite(row)
+}
+
+// scanInvite reads an invitation selected with inviteColumns
+func scanInvite(row pgx.Row) (*db.TenantInvite, error) {
+	var invite db.TenantInvite
+	err := row.Scan(&invite.ID, &invite.TenantID, &invite.Code, &invite.Role, &invite.Email, &invite.PhoneNumber,
+		&invite.MaxUses, &invite.UseCount, &invite.ExpiresAt, &invite.RevokedAt, &invite.CreatedBy, &invite.CreatedAt, &invite.Status)
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// generateInviteCode returns a random code that is easy to type
+func generateInviteCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf), nil
+}
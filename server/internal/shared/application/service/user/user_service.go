@@ -0,0 +1,373 @@
+package user
+
+import (
+	"ChitChat/internal/shared/application/service/db"
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AccountDeletionGracePeriod is how long a deleted account can still be restored
+// before the purge job anonymizes it for good
+const AccountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// DeletedUserName is shown in place of the name of a deleted account
+const DeletedUserName = "Deleted user"
+
+type UserService struct {
+	db *pgxpool.Pool
+}
+
+func NewUserService(database *pgxpool.Pool) *UserService {
+	return &UserService{
+		db: database,
+	}
+}
+
+// GetUser retrieves the profile of a user of the context's tenant,
+// anonymizing accounts that have been deleted
+func (s *UserService) GetUser(ctx context.Context, userID string) (*db.User, error) {
+	tenantID, ok := db.TenantFromContext(ctx)
+	if !ok {
+		return nil, db.ErrNoTenantContext
+	}
+
+	// users has no row level security, so the tenant is checked here
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TenantID != tenantID {
+		return nil, errors.New("user not found")
+	}
+
+	if user.DeletedAt != nil {
+		user.Name = DeletedUserName
+		user.Email = ""
+		user.PhoneNumber = nil
+	}
+
+	return user, nil
+}
+
+// PublicProfile returns the part of a profile other members may see
+func PublicProfile(user *db.User) *db.PublicUser {
+	return &db.PublicUser{
+		ID:      user.ID,
+		Name:    user.Name,
+		Deleted: user.DeletedAt != nil,
+	}
+}
+
+// loadUser retrieves a user's profile exactly as stored
+func (s *UserService) loadUser(ctx context.Context, userID string) (*db.User, error) {
+	var user db.User
+	var email *string
+	err := s.db.QueryRow(ctx, `
+		SELECT id, tenant_id, email, name, role, phone_number, COALESCE(phone_verified, false), created_at, deleted_at, purge_after
+		FROM users WHERE id = $1
+	`, userID).Scan(&user.ID, &user.TenantID, &email, &user.Name, &user.Role, &user.PhoneNumber, &user.PhoneVerified, &user.CreatedAt, &user.DeletedAt, &user.PurgeAfter)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if email != nil {
+		user.Email = *email
+	}
+
+	return &user, nil
+}
+
+// ErrDeletedByAdmin is returned when a user tries to restore an account an
+// admin deleted
+var ErrDeletedByAdmin = errors.New("account was deleted by an admin")
+
+// ScheduleDeletion soft-deletes an account on behalf of deletedBy, the user
+// themself or an admin, and returns the time it will be purged
+func (s *UserService) ScheduleDeletion(userID, deletedBy string) (time.Time, error) {
+	ctx := context.Background()
+
+	var purgeAfter time.Time
+	err := s.db.QueryRow(ctx, `
+		UPDATE users
+		SET deleted_at = NOW(), purge_after = NOW() + make_interval(secs => $2), deleted_by = $3
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING purge_after
+	`, userID, AccountDeletionGracePeriod.Seconds(), deletedBy).Scan(&purgeAfter)
+	if err != nil {
+		return time.Time{}, errors.New("account not found or already scheduled for deletion")
+	}
+
+	return purgeAfter, nil
+}
+
+// RestoreAccount cancels a scheduled deletion while the grace period is still
+// running. Users cannot restore accounts an admin deleted.
+func (s *UserService) RestoreAccount(userID string) error {
+	ctx := context.Background()
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE users
+		SET deleted_at = NULL, purge_after = NULL, deleted_by = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL AND purged_at IS NULL AND deleted_by = id
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	var pending bool
+	err = s.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NOT NULL AND purged_at IS NULL)
+	`, userID).Scan(&pending)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return ErrDeletedByAdmin
+	}
+	return errors.New("account is not pending deletion")
+}
+
+// PurgeDueAccounts anonymizes every account whose grace period has ended.
+// It runs in system context since due accounts span all tenants.
+func (s *UserService) PurgeDueAccounts() (int, error) {
+	ctx := db.SystemContext(context.Background())
+
+	rows, err := s.db.Query(ctx, `
+		SELECT id FROM users
+		WHERE deleted_at IS NOT NULL AND purged_at IS NULL AND purge_after <= NOW()
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, userID := range userIDs {
+		if err := s.purgeAccount(ctx, userID); err != nil {
+			log.Printf("Failed to purge account %s: %v", userID, err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// purgeAccount strips all personal data from an account. The user row itself is
+// kept as an anonymous tombstone so authored messages stay in other people's
+// room histories attributed to "Deleted user".
+func (s *UserService) purgeAccount(ctx context.Context, userID string) error {
+	return db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		return purgeAccountTx(ctx, tx, userID)
+	})
+}
+
+// purgeAccountTx performs the purge inside a tenant-scoped transaction
+func purgeAccountTx(ctx context.Context, tx pgx.Tx, userID string) error {
+	var phoneNumber *string
+	err := tx.QueryRow(ctx, `
+		UPDATE users u
+		SET email = 'deleted-' || u.id || '@deleted.invalid',
+			name = $2,
+			password_hash = '',
+			phone_number = NULL,
+			phone_verified = false,
+			purged_at = NOW()
+		FROM (SELECT id, phone_number FROM users WHERE id = $1 FOR UPDATE) old
+		WHERE u.id = old.id
+		RETURNING old.phone_number
+	`, userID, DeletedUserName).Scan(&phoneNumber)
+	if err != nil {
+		return err
+	}
+
+	if phoneNumber != nil {
+		_, err = tx.Exec(ctx, "DELETE FROM phone_verification_codes WHERE phone_number = $1", *phoneNumber)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM room_members WHERE user_id = $1", userID)
+	return err
+}
+
+// StartPurgeJob periodically purges accounts whose deletion grace period has ended
+func (s *UserService) StartPurgeJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			purged, err := s.PurgeDueAccounts()
+			if err != nil {
+				log.Printf("Account purge job failed: %v", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("Account purge job anonymized %d accounts", purged)
+			}
+		}
+	}()
+}
+
+// GetUserMemberships retrieves all rooms a user belongs to within the context's tenant
+func (s *UserService) GetUserMemberships(ctx context.Context, userID string) ([]db.RoomMembership, error) {
+	var memberships []db.RoomMembership
+	err := db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		memberships, err = listMemberships(ctx, tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+// listMemberships reads a user's rooms inside a tenant-scoped transaction
+func listMemberships(ctx context.Context, tx pgx.Tx, userID string) ([]db.RoomMembership, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT r.id, r.name, r.type, r.created_at
+		FROM rooms r
+		JOIN room_members rm ON r.id = rm.room_id
+		WHERE rm.user_id = $1
+		ORDER BY r.created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := []db.RoomMembership{}
+	for rows.Next() {
+		var membership db.RoomMembership
+		err := rows.Scan(&membership.RoomID, &membership.RoomName, &membership.RoomType, &membership.RoomCreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, membership)
+	}
+
+	return memberships, rows.Err()
+}
+
+// ExportUserData writes a zip archive with the user's profile, memberships and
+// authored messages to w
+func (s *UserService) ExportUserData(ctx context.Context, userID string, w io.Writer) error {
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return db.WithTenant(ctx, s.db, func(tx pgx.Tx) error {
+		return exportUserDataTx(ctx, tx, user, w)
+	})
+}
+
+// exportUserDataTx writes the export archive inside a tenant-scoped
+// transaction so messages are streamed from a consistent snapshot
+func exportUserDataTx(ctx context.Context, tx pgx.Tx, user *db.User, w io.Writer) error {
+	userID := user.ID
+
+	memberships, err := listMemberships(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+
+	if err := writeJSONEntry(archive, "profile.json", user); err != nil {
+		return err
+	}
+	if err := writeJSONEntry(archive, "memberships.json", memberships); err != nil {
+		return err
+	}
+
+	// Messages can be numerous, so stream them into the archive as a JSON array
+	entry, err := archive.Create("messages.json")
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, tenant_id, room_id, user_id, type, content, sent_at, edited_at, deleted_at, reply_to_id, thread_root_id
+		FROM messages
+		WHERE user_id = $1
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if _, err := io.WriteString(entry, "[\n"); err != nil {
+		return err
+	}
+	first := true
+	for rows.Next() {
+		var msg db.Message
+		if err := rows.Scan(&msg.ID, &msg.TenantID, &msg.RoomID, &msg.UserID, &msg.Type, &msg.Content, &msg.SentAt, &msg.EditedAt, &msg.DeletedAt, &msg.ReplyToID, &msg.ThreadRootID); err != nil {
+			return err
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := io.WriteString(entry, ",\n"); err != nil {
+				return err
+			}
+		}
+		first = false
+		if _, err := entry.Write(data); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(entry, "\n]\n"); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// writeJSONEntry adds a pretty-printed JSON file to a zip archive
+func writeJSONEntry(archive *zip.Writer, name string, v interface{}) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = entry.Write(data)
+	return err
+}
@@ -22,27 +22,53 @@ type Message struct {
 
 // Client represents a WebSocket client connection
 type Client struct {
-	ID     string
-	UserID string
-	Conn   *websocket.Conn
-	Send   chan []byte
-	Rooms  map[string]bool // rooms the client is subscribed to
-	mu     sync.RWMutex
+	ID       string
+	UserID   string
+	TenantID string
+	Conn     *websocket.Conn
+	Send     chan []byte
+	Rooms    map[string]bool // rooms the client is subscribed to
+	mu       sync.RWMutex
+}
+
+// defaultReadLimit is the largest client message accepted until a handler
+// asks for more
+const defaultReadLimit = 512
+
+// MessageHandler processes an incoming client message of a registered type
+type MessageHandler func(client *Client, message *Message)
+
+// SubscribeAuthorizer decides whether a client may subscribe to a room
+type SubscribeAuthorizer func(client *Client, roomID string) bool
+
+// ConnectionListener is notified when a user's first client connects and when
+// their last client disconnects
+type ConnectionListener interface {
+	UserConnected(userID string)
+	UserDisconnected(userID string)
 }
 
 // WebSocketService manages WebSocket connections and message broadcasting
 type WebSocketService struct {
-	clients  map[string]*Client            // clientID -> client
-	rooms    map[string]map[string]*Client // roomID -> clients
-	mu       sync.RWMutex
-	upgrader websocket.Upgrader
+	clients   map[string]*Client            // clientID -> client
+	rooms     map[string]map[string]*Client // roomID -> clients
+	users     map[string]map[string]*Client // userID -> clients
+	handlers  map[string]MessageHandler     // message type -> handler
+	listeners []ConnectionListener
+	authorize SubscribeAuthorizer
+	readLimit int64 // largest client message in bytes
+	mu        sync.RWMutex
+	upgrader  websocket.Upgrader
 }
 
 // NewWebSocketService creates a new WebSocket service
 func NewWebSocketService() *WebSocketService {
 	return &WebSocketService{
-		clients: make(map[string]*Client),
-		rooms:   make(map[string]map[string]*Client),
+		clients:   make(map[string]*Client),
+		rooms:     make(map[string]map[string]*Client),
+		users:     make(map[string]map[string]*Client),
+		handlers:  make(map[string]MessageHandler),
+		readLimit: defaultReadLimit,
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Allow all origins for development
@@ -69,11 +95,12 @@ func (ws *WebSocketService) HandleWebSocket(w http.ResponseWriter, r *http.Reque
 
 	// Create new client
 	client := &Client{
-		ID:     fmt.Sprintf("client_%s_%d", userID, time.Now().UnixNano()),
-		UserID: userID,
-		Conn:   conn,
-		Send:   make(chan []byte, 256),
-		Rooms:  make(map[string]bool),
+		ID:       fmt.Sprintf("client_%s_%d", userID, time.Now().UnixNano()),
+		UserID:   userID,
+		TenantID: r.URL.Query().Get("tenant_id"),
+		Conn:     conn,
+		Send:     make(chan []byte, 256),
+		Rooms:    make(map[string]bool),
 	}
 
 	// Register client
@@ -84,22 +111,73 @@ func (ws *WebSocketService) HandleWebSocket(w http.ResponseWriter, r *http.Reque
 	go ws.writePump(client)
 }
 
+// RegisterHandler registers a handler for an incoming client message type
+func (ws *WebSocketService) RegisterHandler(messageType string, handler MessageHandler) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.handlers[messageType] = handler
+}
+
+// RequireReadLimit raises the largest client message accepted to at least
+// limit bytes, for handlers whose messages can be long. Connections that
+// send more are closed.
+func (ws *WebSocketService) RequireReadLimit(limit int64) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.readLimit = max(ws.readLimit, limit)
+}
+
+// SetSubscribeAuthorizer sets the check that room subscriptions must pass
+func (ws *WebSocketService) SetSubscribeAuthorizer(authorize SubscribeAuthorizer) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.authorize = authorize
+}
+
+// AddConnectionListener registers a listener for user connect and disconnect events
+func (ws *WebSocketService) AddConnectionListener(listener ConnectionListener) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.listeners = append(ws.listeners, listener)
+}
+
 // registerClient adds a client to the service
 func (ws *WebSocketService) registerClient(client *Client) {
 	ws.mu.Lock()
-	defer ws.mu.Unlock()
 
 	ws.clients[client.ID] = client
+
+	// Track the client under its user
+	firstClient := len(ws.users[client.UserID]) == 0
+	if firstClient {
+		ws.users[client.UserID] = make(map[string]*Client)
+	}
+	ws.users[client.UserID][client.ID] = client
+	listeners := ws.listeners
+
+	ws.mu.Unlock()
+
 	log.Printf("Client %s connected (User: %s)", client.ID, client.UserID)
+
+	// Notify listeners outside the lock so they can use the service
+	if firstClient {
+		for _, listener := range listeners {
+			listener.UserConnected(client.UserID)
+		}
+	}
 }
 
 // unregisterClient removes a client from the service
 func (ws *WebSocketService) unregisterClient(client *Client) {
 	ws.mu.Lock()
-	defer ws.mu.Unlock()
 
 	// Check if client is already unregistered
 	if _, exists := ws.clients[client.ID]; !exists {
+		ws.mu.Unlock()
 		return
 	}
 
@@ -111,6 +189,17 @@ func (ws *WebSocketService) unregisterClient(client *Client) {
 	// Remove from clients map
 	delete(ws.clients, client.ID)
 
+	// Remove from the user's clients
+	lastClient := false
+	if userClients, exists := ws.users[client.UserID]; exists {
+		delete(userClients, client.ID)
+		if len(userClients) == 0 {
+			delete(ws.users, client.UserID)
+			lastClient = true
+		}
+	}
+	listeners := ws.listeners
+
 	// Close connection and channel safely
 	client.Conn.Close()
 
@@ -122,7 +211,16 @@ func (ws *WebSocketService) unregisterClient(client *Client) {
 		close(client.Send)
 	}
 
+	ws.mu.Unlock()
+
 	log.Printf("Client %s disconnected (User: %s)", client.ID, client.UserID)
+
+	// Notify listeners outside the lock so they can use the service
+	if lastClient {
+		for _, listener := range listeners {
+			listener.UserDisconnected(client.UserID)
+		}
+	}
 }
 
 // SubscribeToRoom adds a client to a room
@@ -164,6 +262,33 @@ func (ws *WebSocketService) UnsubscribeFromRoom(clientID, roomID string) error {
 	return nil
 }
 
+// UnsubscribeUser removes every client of a user from a room, e.g. after the
+// user left or was removed from it
+func (ws *WebSocketService) UnsubscribeUser(userID, roomID string) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for _, client := range ws.users[userID] {
+		client.mu.RLock()
+		subscribed := client.Rooms[roomID]
+		client.mu.RUnlock()
+
+		if subscribed {
+			ws.leaveRoom(client, roomID)
+		}
+	}
+}
+
+// CloseRoom removes every subscription to a room that no longer exists
+func (ws *WebSocketService) CloseRoom(roomID string) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for _, client := range ws.rooms[roomID] {
+		ws.leaveRoom(client, roomID)
+	}
+}
+
 // leaveRoom removes a client from a specific room
 func (ws *WebSocketService) leaveRoom(client *Client, roomID string) {
 	// Remove from client's rooms
@@ -206,19 +331,61 @@ func (ws *WebSocketService) BroadcastToRoom(roomID string, messageType string, c
 		return
 	}
 
-	for clientID, client := range roomClients {
+	for _, client := range roomClients {
 		// Skip if user should be excluded
 		if excludeUserID != "" && client.UserID == excludeUserID {
 			continue
 		}
 
-		select {
-		case client.Send <- messageBytes:
-		default:
-			// Channel is full, remove client
-			log.Printf("Client %s channel full, removing", clientID)
-			go ws.unregisterClient(client)
+		ws.queue(client, messageBytes)
+	}
+}
+
+// BroadcastToRoomPerUser sends a message to all clients in a room with
+// content built for each recipient, such as download URLs signed for them
+func (ws *WebSocketService) BroadcastToRoomPerUser(roomID string, messageType string, content func(userID string) interface{}, excludeUserID string) {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	roomClients, exists := ws.rooms[roomID]
+	if !exists {
+		return
+	}
+
+	encoded := make(map[string][]byte) // userID -> message
+	for _, client := range roomClients {
+		if excludeUserID != "" && client.UserID == excludeUserID {
+			continue
+		}
+
+		messageBytes, ok := encoded[client.UserID]
+		if !ok {
+			var err error
+			messageBytes, err = json.Marshal(Message{
+				Type:    messageType,
+				RoomID:  roomID,
+				Content: content(client.UserID),
+			})
+			if err != nil {
+				log.Printf("Error marshaling message: %v", err)
+				return
+			}
+			encoded[client.UserID] = messageBytes
 		}
+
+		ws.queue(client, messageBytes)
+	}
+}
+
+// queue hands an encoded message to a client's writer, dropping clients
+// that fall behind. The caller holds the read lock.
+func (ws *WebSocketService) queue(client *Client, messageBytes []byte) {
+	select {
+	case client.Send <- messageBytes:
+	default:
+		// Channel is full, remove client
+		log.Printf("Client %s channel full, removing", client.ID)
+		go ws.unregisterClient(client)
 	}
 }
 
@@ -245,7 +412,11 @@ func (ws *WebSocketService) readPump(client *Client) {
 		ws.unregisterClient(client)
 	}()
 
-	client.Conn.SetReadLimit(512) // 512 bytes max message size
+	ws.mu.RLock()
+	readLimit := ws.readLimit
+	ws.mu.RUnlock()
+
+	client.Conn.SetReadLimit(readLimit)
 	client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	client.Conn.SetPongHandler(func(string) error {
 		client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -321,6 +492,15 @@ func (ws *WebSocketService) handleMessage(client *Client, message *Message) {
 	case "subscribe":
 		// Subscribe to a room
 		if roomID, ok := message.Content.(string); ok {
+			ws.mu.RLock()
+			authorize := ws.authorize
+			ws.mu.RUnlock()
+
+			if authorize != nil && !authorize(client, roomID) {
+				ws.sendError(client, "Not a member of this room")
+				return
+			}
+
 			err := ws.SubscribeToRoom(client.ID, roomID)
 			if err != nil {
 				ws.sendError(client, "Failed to subscribe to room")
@@ -353,7 +533,15 @@ func (ws *WebSocketService) handleMessage(client *Client, message *Message) {
 		})
 
 	default:
-		log.Printf("Unknown message type: %s", message.Type)
+		ws.mu.RLock()
+		handler, exists := ws.handlers[message.Type]
+		ws.mu.RUnlock()
+
+		if exists {
+			handler(client, message)
+		} else {
+			log.Printf("Unknown message type: %s", message.Type)
+		}
 	}
 }
 
@@ -385,6 +573,60 @@ func (ws *WebSocketService) sendError(client *Client, errorMessage string) {
 	})
 }
 
+// SendToClient sends a message to a specific client
+func (ws *WebSocketService) SendToClient(client *Client, messageType string, content interface{}) {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	// Skip clients that have already disconnected
+	if _, exists := ws.clients[client.ID]; !exists {
+		return
+	}
+	ws.sendMessage(client, messageType, content)
+}
+
+// SendErrorToClient sends an error message to a specific client
+func (ws *WebSocketService) SendErrorToClient(client *Client, errorMessage string) {
+	ws.SendToClient(client, "error", map[string]string{
+		"message": errorMessage,
+	})
+}
+
+// SendToUser sends a message to every connected client of a user
+func (ws *WebSocketService) SendToUser(userID string, messageType string, content interface{}) {
+	// Hold the read lock while sending so clients can't be closed mid-send
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	for _, client := range ws.users[userID] {
+		ws.sendMessage(client, messageType, content)
+	}
+}
+
+// DisconnectUser closes every connection of a user with the given reason
+func (ws *WebSocketService) DisconnectUser(userID string, reason string) {
+	ws.mu.RLock()
+	clients := make([]*Client, 0, len(ws.users[userID]))
+	for _, client := range ws.users[userID] {
+		clients = append(clients, client)
+	}
+	ws.mu.RUnlock()
+
+	closeMessage := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+	for _, client := range clients {
+		// WriteControl is safe to call concurrently with the write pump
+		client.Conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+		ws.unregisterClient(client)
+	}
+}
+
+// IsUserOnline reports whether a user has at least one connected client
+func (ws *WebSocketService) IsUserOnline(userID string) bool {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+	return len(ws.users[userID]) > 0
+}
+
 // GetConnectedClients returns the number of connected clients
 func (ws *WebSocketService) GetConnectedClients() int {
 	ws.mu.RLock()
@@ -402,3 +644,27 @@ func (ws *WebSocketService) GetRoomClients(roomID string) int {
 	}
 	return 0
 }
+
+// GetOnlineUsers returns the IDs of all users with at least one connected client
+func (ws *WebSocketService) GetOnlineUsers() []string {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	userIDs := make([]string, 0, len(ws.users))
+	for userID := range ws.users {
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs
+}
+
+// GetRoomSubscriberCounts returns the number of subscribed clients per room
+func (ws *WebSocketService) GetRoomSubscriberCounts() map[string]int {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	counts := make(map[string]int, len(ws.rooms))
+	for roomID, roomClients := range ws.rooms {
+		counts[roomID] = len(roomClients)
+	}
+	return counts
+}
@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"ChitChat/internal/shared/application/service/auth"
+	"ChitChat/internal/shared/application/service/db"
+	"ChitChat/internal/shared/application/service/quota"
+	"ChitChat/internal/shared/application/service/settings"
+	"ChitChat/internal/shared/application/service/tenant"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TenantHandlers struct {
+	tenantService   *tenant.TenantService
+	settingsService *settings.SettingsService
+	quotaService    *quota.QuotaService
+}
+
+func NewTenantHandlers(tenantService *tenant.TenantService, settingsService *settings.SettingsService, quotaService *quota.QuotaService) *TenantHandlers {
+	return &TenantHandlers{
+		tenantService:   tenantService,
+		settingsService: settingsService,
+		quotaService:    quotaService,
+	}
+}
+
+// tenantError maps tenant service errors to responses
+func tenantError(c *gin.Context, err error) {
+	if errors.Is(err, tenant.ErrTenantNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tenant not found"})
+		return
+	}
+	if errors.Is(err, tenant.ErrInviteNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// CreateTenant provisions a tenant and returns the invitation for its first owner
+func (h *TenantHandlers) CreateTenant(c *gin.Context) {
+	var req db.CreateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	createdTenant, invite, err := h.tenantService.CreateTenant(req)
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "Tenant created",
+		"tenant":       createdTenant,
+		"owner_invite": invite,
+	})
+}
+
+// ListTenants lists every tenant on the platform
+func (h *TenantHandlers) ListTenants(c *gin.Context) {
+	tenants, err := h.tenantService.ListTenants()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tenants"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tenants retrieved",
+		"tenants": tenants,
+	})
+}
+
+// GetTenant returns a tenant by ID
+func (h *TenantHandlers) GetTenant(c *gin.Context) {
+	foundTenant, err := h.tenantService.GetTenant(c.Param("id"))
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tenant retrieved",
+		"tenant":  foundTenant,
+	})
+}
+
+// UpdateTenant changes a tenant's name, slug, email domain or status
+func (h *TenantHandlers) UpdateTenant(c *gin.Context) {
+	var req db.UpdateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updatedTenant, err := h.tenantService.UpdateTenant(c.Param("id"), req)
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tenant updated",
+		"tenant":  updatedTenant,
+	})
+}
+
+// CreateOwnerInvite issues a fresh invitation for a tenant owner
+func (h *TenantHandlers) CreateOwnerInvite(c *gin.Context) {
+	invite, err := h.tenantService.CreateOwnerInvite(c.Param("id"))
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "Owner invitation created",
+		"owner_invite": invite,
+	})
+}
+
+// GetOwnTenant returns the tenant of the signed-in admin
+func (h *TenantHandlers) GetOwnTenant(c *gin.Context) {
+	foundTenant, err := h.tenantService.GetTenant(c.GetString("tenant_id"))
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tenant retrieved",
+		"tenant":  foundTenant,
+	})
+}
+
+// UpdateOwnTenant lets tenant admins rename their tenant. Slug, email domain
+// and status decide who can join and are managed by the platform.
+func (h *TenantHandlers) UpdateOwnTenant(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updatedTenant, err := h.tenantService.UpdateTenant(c.GetString("tenant_id"), db.UpdateTenantRequest{Name: &req.Name})
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tenant updated",
+		"tenant":  updatedTenant,
+	})
+}
+
+// getSettings responds with the effective settings of a tenant
+func (h *TenantHandlers) getSettings(c *gin.Context, tenantID string) {
+	if _, err := h.tenantService.GetTenant(tenantID); err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	tenantSettings, err := h.settingsService.GetSettings(tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tenant settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Tenant settings retrieved",
+		"settings": tenantSettings,
+	})
+}
+
+// updateSettings applies the settings present in the request to a tenant
+func (h *TenantHandlers) updateSettings(c *gin.Context, tenantID string) {
+	var req db.UpdateTenantSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.tenantService.GetTenant(tenantID); err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	tenantSettings, err := h.settingsService.UpdateSettings(tenantID, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tenant settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Tenant settings updated",
+		"settings": tenantSettings,
+	})
+}
+
+// GetTenantSettings returns the settings of any tenant
+func (h *TenantHandlers) GetTenantSettings(c *gin.Context) {
+	h.getSettings(c, c.Param("id"))
+}
+
+// UpdateTenantSettings changes the settings of any tenant
+func (h *TenantHandlers) UpdateTenantSettings(c *gin.Context) {
+	h.updateSettings(c, c.Param("id"))
+}
+
+// GetOwnTenantSettings returns the settings of the signed-in admin's tenant
+func (h *TenantHandlers) GetOwnTenantSettings(c *gin.Context) {
+	h.getSettings(c, c.GetString("tenant_id"))
+}
+
+// UpdateOwnTenantSettings changes the settings of the signed-in admin's tenant
+func (h *TenantHandlers) UpdateOwnTenantSettings(c *gin.Context) {
+	h.updateSettings(c, c.GetString("tenant_id"))
+}
+
+// CreateInvite invites a user to the admin's tenant by email or phone number,
+// or creates a reusable join link when neither is given
+func (h *TenantHandlers) CreateInvite(c *gin.Context) {
+	var req db.CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Only owners may bring in other owners, matching role changes
+	if req.Role == auth.RoleOwner && c.GetString("role") == auth.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can invite owners"})
+		return
+	}
+
+	invite, delivered, err := h.tenantService.CreateInvite(c.GetString("tenant_id"), c.GetString("user_id"), req)
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Invitation created",
+		"invite":    invite,
+		"delivered": delivered,
+	})
+}
+
+// ListInvites lists the invitations and join links of the admin's tenant
+func (h *TenantHandlers) ListInvites(c *gin.Context) {
+	invites, err := h.tenantService.ListInvites(c.GetString("tenant_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Invitations retrieved",
+		"invites": invites,
+	})
+}
+
+// RevokeInvite stops an invitation of the admin's tenant from being redeemed
+func (h *TenantHandlers) RevokeInvite(c *gin.Context) {
+	if err := h.tenantService.RevokeInvite(c.GetString("tenant_id"), c.Param("id")); err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Invitation revoked",
+		"id":      c.Param("id"),
+	})
+}
+
+// usagePeriod parses the month query parameter ("2006-01"), defaulting to
+// the current month
+func usagePeriod(c *gin.Context) (time.Time, bool) {
+	month := c.Query("month")
+	if month == "" {
+		now := time.Now().UTC()
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), true
+	}
+
+	period, err := time.Parse("2006-01", month)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "month must be formatted as YYYY-MM"})
+		return time.Time{}, false
+	}
+	return period, true
+}
+
+// GetTenantQuotas returns the plan limits of a tenant
+func (h *TenantHandlers) GetTenantQuotas(c *gin.Context) {
+	if _, err := h.tenantService.GetTenant(c.Param("id")); err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	quotas, err := h.quotaService.GetQuotas(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve quotas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tenant quotas retrieved",
+		"quotas":  quotas,
+	})
+}
+
+// SetTenantQuotas replaces the plan limits of a tenant
+func (h *TenantHandlers) SetTenantQuotas(c *gin.Context) {
+	var req db.TenantQuotas
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.tenantService.GetTenant(c.Param("id")); err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	quotas, err := h.quotaService.SetQuotas(c.Param("id"), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update quotas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tenant quotas updated",
+		"quotas":  quotas,
+	})
+}
+
+// GetUsageReport exports the monthly usage of every tenant for billing, as
+// JSON or, with format=csv, as a CSV download
+func (h *TenantHandlers) GetUsageReport(c *gin.Context) {
+	period, ok := usagePeriod(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.quotaService.UsageReport(period)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve usage report"})
+		return
+	}
+
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Usage report retrieved",
+			"period":  period.Format("2006-01"),
+			"usage":   report,
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", "attachment; filename=usage-"+period.Format("2006-01")+".csv")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"tenant_id", "tenant_name", "period", "messages_sent", "sms_sent", "active_users", "storage_bytes"})
+	for _, usage := range report {
+		w.Write([]string{
+			usage.TenantID,
+			usage.TenantName,
+			usage.Period,
+			strconv.FormatInt(usage.MessagesSent, 10),
+			strconv.FormatInt(usage.SMSSent, 10),
+			strconv.FormatInt(usage.ActiveUsers, 10),
+			strconv.FormatInt(usage.StorageBytes, 10),
+		})
+	}
+	w.Flush()
+}
+
+// GetOwnUsage returns the monthly usage and limits of the admin's tenant
+func (h *TenantHandlers) GetOwnUsage(c *gin.Context) {
+	period, ok := usagePeriod(c)
+	if !ok {
+		return
+	}
+
+	usage, err := h.quotaService.GetUsage(c.GetString("tenant_id"), period)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tenant usage retrieved",
+		"usage":   usage,
+	})
+}
@@ -0,0 +1,43 @@
+package routes
+
+import (
+	"ChitChat/internal/shared/application/middleware"
+	"ChitChat/internal/tenant/handlers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupTenantRoutes(r *gin.Engine, tenantHandlers *handlers.TenantHandlers) {
+	// Platform operators provision and manage all tenants
+	platformAuthRoute := r.Group("/platform/tenants")
+	platformAuthRoute.Use(middleware.JWTAuth())
+	platformAuthRoute.Use(middleware.SuperAdminAuthMiddleware())
+	platformAuthRoute.GET("", tenantHandlers.ListTenants)
+	platformAuthRoute.POST("", tenantHandlers.CreateTenant)
+	platformAuthRoute.GET("/:id", tenantHandlers.GetTenant)
+	platformAuthRoute.PATCH("/:id", tenantHandlers.UpdateTenant)
+	platformAuthRoute.POST("/:id/owner-invite", tenantHandlers.CreateOwnerInvite)
+	platformAuthRoute.GET("/:id/settings", tenantHandlers.GetTenantSettings)
+	platformAuthRoute.PATCH("/:id/settings", tenantHandlers.UpdateTenantSettings)
+	platformAuthRoute.GET("/:id/quotas", tenantHandlers.GetTenantQuotas)
+	platformAuthRoute.PUT("/:id/quotas", tenantHandlers.SetTenantQuotas)
+
+	// Monthly usage of every tenant for billing
+	platformUsageRoute := r.Group("/platform/usage")
+	platformUsageRoute.Use(middleware.JWTAuth())
+	platformUsageRoute.Use(middleware.SuperAdminAuthMiddleware())
+	platformUsageRoute.GET("", tenantHandlers.GetUsageReport)
+
+	// Tenant admins manage their own tenant
+	tenantAuthRoute := r.Group("/admin/tenant")
+	tenantAuthRoute.Use(middleware.JWTAuth())
+	tenantAuthRoute.Use(middleware.AdminAuthMiddleware())
+	tenantAuthRoute.GET("", tenantHandlers.GetOwnTenant)
+	tenantAuthRoute.PATCH("", tenantHandlers.UpdateOwnTenant)
+	tenantAuthRoute.GET("/settings", tenantHandlers.GetOwnTenantSettings)
+	tenantAuthRoute.PATCH("/settings", tenantHandlers.UpdateOwnTenantSettings)
+	tenantAuthRoute.GET("/invites", tenantHandlers.ListInvites)
+	tenantAuthRoute.POST("/invites", tenantHandlers.CreateInvite)
+	tenantAuthRoute.DELETE("/invites/:id", tenantHandlers.RevokeInvite)
+	tenantAuthRoute.GET("/usage", tenantHandlers.GetOwnUsage)
+}
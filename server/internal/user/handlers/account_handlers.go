@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"ChitChat/internal/shared/application/service/auth"
+	"ChitChat/internal/shared/application/service/user"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AccountHandlers struct {
+	userService *user.UserService
+}
+
+func NewAccountHandlers(userService *user.UserService) *AccountHandlers {
+	return &AccountHandlers{
+		userService: userService,
+	}
+}
+
+// authorizeSelf ensures the authenticated user is acting on their own account
+func authorizeSelf(c *gin.Context) (string, bool) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return "", false
+	}
+
+	if c.Param("id") != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage your own account"})
+		return "", false
+	}
+
+	return userID, true
+}
+
+// GetUserByID retrieves a user of the caller's tenant. Users see their own
+// full profile and tenant admins everyone's; other callers only get the
+// public profile.
+func (h *AccountHandlers) GetUserByID(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	id := c.Param("id")
+	profile, err := h.userService.GetUser(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	switch role := c.GetString("role"); {
+	case id == userID, role == auth.RoleAdmin, role == auth.RoleOwner, role == auth.RoleSuperAdmin:
+		c.JSON(http.StatusOK, gin.H{"message": "User found", "user": profile})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "User found", "user": user.PublicProfile(profile)})
+	}
+}
+
+// DeleteUser schedules the authenticated user's account for deletion
+func (h *AccountHandlers) DeleteUser(c *gin.Context) {
+	userID, ok := authorizeSelf(c)
+	if !ok {
+		return
+	}
+
+	purgeAfter, err := h.userService.ScheduleDeletion(userID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Account scheduled for deletion",
+		"id":          userID,
+		"purge_after": purgeAfter,
+	})
+}
+
+// RestoreUser cancels a pending account deletion
+func (h *AccountHandlers) RestoreUser(c *gin.Context) {
+	userID, ok := authorizeSelf(c)
+	if !ok {
+		return
+	}
+
+	err := h.userService.RestoreAccount(userID)
+	if errors.Is(err, user.ErrDeletedByAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account was deleted by an admin"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account restored", "id": userID})
+}
+
+// ExportUserData streams a zip archive with all of the user's personal data
+func (h *AccountHandlers) ExportUserData(c *gin.Context) {
+	userID, ok := authorizeSelf(c)
+	if !ok {
+		return
+	}
+
+	filename := fmt.Sprintf("chitchat-export-%s.zip", time.Now().UTC().Format("20060102"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	if err := h.userService.ExportUserData(c.Request.Context(), userID, c.Writer); err != nil {
+		log.Printf("Failed to export data for user %s: %v", userID, err)
+		// Once the archive has started streaming the error can only be logged
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export user data"})
+		}
+	}
+}
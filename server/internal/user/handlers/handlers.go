@@ -14,17 +14,7 @@ func GetUserByEmail(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "User found by email"})
 }
 
-func GetUserByID(c *gin.Context) {
-	id := c.Param("id")
-	c.JSON(http.StatusOK, gin.H{"message": "User found", "id": id})
-}
-
 func UpdateUser(c *gin.Context) {
 	id := c.Param("id")
 	c.JSON(http.StatusOK, gin.H{"message": "User updated", "id": id})
 }
-
-func DeleteUser(c *gin.Context) {
-	id := c.Param("id")
-	c.JSON(http.StatusOK, gin.H{"message": "User deleted", "id": id})
-}
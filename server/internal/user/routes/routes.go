@@ -7,13 +7,17 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func SetupUserRoutes(r *gin.Engine) {
+func SetupUserRoutes(r *gin.Engine, accountHandlers *handlers.AccountHandlers) {
 	r.POST("/user", handlers.CreateUser)
 	r.POST("/get-by-email", handlers.GetUserByEmail)
 
 	userAuthRoute := r.Group("/user")
 	userAuthRoute.Use(middleware.JWTAuth())
-	userAuthRoute.GET(":id", handlers.GetUserByID)
+	userAuthRoute.GET(":id", accountHandlers.GetUserByID)
 	userAuthRoute.PATCH(":id", handlers.UpdateUser)
-	userAuthRoute.DELETE(":id", handlers.DeleteUser)
+	userAuthRoute.DELETE(":id", accountHandlers.DeleteUser)
+
+	// Account lifecycle. Accounts pending deletion can only restore themselves.
+	r.POST("/user/:id/restore", middleware.JWTAuthPendingDeletion(), accountHandlers.RestoreUser)
+	userAuthRoute.GET(":id/export", accountHandlers.ExportUserData)
 }
@@ -0,0 +1,10 @@
+-- Restore the original cascading foreign key on messages
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_user_id_fkey;
+ALTER TABLE messages ADD CONSTRAINT messages_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+-- Remove account lifecycle fields from users table
+DROP INDEX IF EXISTS idx_users_purge_after;
+ALTER TABLE users DROP COLUMN IF EXISTS purged_at;
+ALTER TABLE users DROP COLUMN IF EXISTS purge_after;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,14 @@
+-- Track account lifecycle for soft deletion and the scheduled hard purge
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN purge_after TIMESTAMP;
+ALTER TABLE users ADD COLUMN purged_at TIMESTAMP;
+
+-- Index for the purge job to find accounts whose grace period has ended
+CREATE INDEX idx_users_purge_after ON users (purge_after)
+    WHERE deleted_at IS NOT NULL AND purged_at IS NULL;
+
+-- Deleting a user row must never wipe their messages out of other people's
+-- room histories. Accounts are anonymized instead, so block hard deletes.
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_user_id_fkey;
+ALTER TABLE messages ADD CONSTRAINT messages_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
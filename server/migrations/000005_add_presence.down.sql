@@ -0,0 +1,3 @@
+-- Remove presence tracking fields from users table
+ALTER TABLE users DROP COLUMN IF EXISTS hide_last_seen;
+ALTER TABLE users DROP COLUMN IF EXISTS last_seen_at;
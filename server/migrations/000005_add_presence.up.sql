@@ -0,0 +1,3 @@
+-- Add presence tracking fields to users table
+ALTER TABLE users ADD COLUMN last_seen_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN hide_last_seen BOOLEAN NOT NULL DEFAULT FALSE;
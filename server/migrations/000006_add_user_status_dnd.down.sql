@@ -0,0 +1,9 @@
+-- Remove custom status and do-not-disturb fields from users table
+DROP INDEX IF EXISTS idx_users_status_expires_at;
+ALTER TABLE users DROP COLUMN IF EXISTS dnd_until;
+ALTER TABLE users DROP COLUMN IF EXISTS dnd_timezone;
+ALTER TABLE users DROP COLUMN IF EXISTS dnd_end_minute;
+ALTER TABLE users DROP COLUMN IF EXISTS dnd_start_minute;
+ALTER TABLE users DROP COLUMN IF EXISTS status_expires_at;
+ALTER TABLE users DROP COLUMN IF EXISTS status_emoji;
+ALTER TABLE users DROP COLUMN IF EXISTS status_text;
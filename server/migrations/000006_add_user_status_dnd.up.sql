@@ -0,0 +1,15 @@
+-- Add custom status fields to users table
+ALTER TABLE users ADD COLUMN status_text TEXT;
+ALTER TABLE users ADD COLUMN status_emoji TEXT;
+ALTER TABLE users ADD COLUMN status_expires_at TIMESTAMP;
+
+-- Add do-not-disturb fields to users table
+-- The daily window is stored as minutes after midnight in the user's timezone
+ALTER TABLE users ADD COLUMN dnd_start_minute SMALLINT CHECK (dnd_start_minute BETWEEN 0 AND 1439);
+ALTER TABLE users ADD COLUMN dnd_end_minute SMALLINT CHECK (dnd_end_minute BETWEEN 0 AND 1439);
+ALTER TABLE users ADD COLUMN dnd_timezone TEXT NOT NULL DEFAULT 'UTC';
+ALTER TABLE users ADD COLUMN dnd_until TIMESTAMP;
+
+-- Index for the job that clears expired statuses
+CREATE INDEX idx_users_status_expires_at ON users (status_expires_at)
+    WHERE status_expires_at IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Remove suspension and session revocation fields from users table
+DROP INDEX IF EXISTS idx_users_tenant_id_created_at;
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_valid_after;
+ALTER TABLE users DROP COLUMN IF EXISTS suspension_reason;
+ALTER TABLE users DROP COLUMN IF EXISTS suspended_at;
@@ -0,0 +1,7 @@
+-- Add suspension and session revocation fields to users table
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN suspension_reason TEXT;
+ALTER TABLE users ADD COLUMN tokens_valid_after TIMESTAMP;
+
+-- Index for tenant-scoped admin user listings
+CREATE INDEX idx_users_tenant_id_created_at ON users (tenant_id, created_at DESC);
@@ -0,0 +1,4 @@
+-- Drop statistics tables
+DROP TABLE IF EXISTS daily_active_users;
+DROP TABLE IF EXISTS daily_message_stats;
+DROP TABLE IF EXISTS otp_events;
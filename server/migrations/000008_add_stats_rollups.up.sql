@@ -0,0 +1,27 @@
+-- Record OTP sends and failures for system statistics
+CREATE TABLE otp_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    phone_number TEXT NOT NULL,
+    event TEXT NOT NULL CHECK (event IN ('sent', 'send_failed', 'verify_failed')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_otp_events_created_at ON otp_events (created_at DESC);
+
+-- Message volume per tenant per day, maintained by the stats rollup job
+CREATE TABLE daily_message_stats (
+    day DATE NOT NULL,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    message_count BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, tenant_id)
+);
+
+-- Users active on a given day, maintained by the stats rollup job
+CREATE TABLE daily_active_users (
+    day DATE NOT NULL,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (day, user_id)
+);
+
+CREATE INDEX idx_daily_active_users_tenant_day ON daily_active_users (tenant_id, day);
@@ -0,0 +1,10 @@
+-- Drop tenant invitations
+DROP TABLE IF EXISTS tenant_invites;
+
+-- Remove tenant resolution and lifecycle fields from tenants table
+DROP INDEX IF EXISTS idx_tenants_is_default;
+ALTER TABLE tenants ALTER COLUMN id DROP DEFAULT;
+ALTER TABLE tenants DROP COLUMN IF EXISTS is_default;
+ALTER TABLE tenants DROP COLUMN IF EXISTS status;
+ALTER TABLE tenants DROP COLUMN IF EXISTS email_domain;
+ALTER TABLE tenants DROP COLUMN IF EXISTS slug;
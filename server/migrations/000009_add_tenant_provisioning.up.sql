@@ -0,0 +1,27 @@
+-- Add tenant resolution and lifecycle fields to tenants table
+ALTER TABLE tenants ADD COLUMN slug TEXT UNIQUE CHECK (slug ~ '^[a-z0-9][a-z0-9-]{1,62}$');
+ALTER TABLE tenants ADD COLUMN email_domain TEXT UNIQUE;
+ALTER TABLE tenants ADD COLUMN status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'suspended'));
+ALTER TABLE tenants ADD COLUMN is_default BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE tenants ALTER COLUMN id SET DEFAULT gen_random_uuid();
+
+-- Only one tenant can receive signups that match no other tenant
+CREATE UNIQUE INDEX idx_tenants_is_default ON tenants (is_default) WHERE is_default;
+
+-- The tenant created by the initial migration becomes the default tenant
+UPDATE tenants SET is_default = TRUE, slug = 'default'
+WHERE id = (SELECT id FROM tenants ORDER BY created_at LIMIT 1);
+
+-- Single-use invitations that place a new user in a tenant with a role
+CREATE TABLE tenant_invites (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    code TEXT UNIQUE NOT NULL,
+    role TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    used_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_tenant_invites_tenant_id ON tenant_invites (tenant_id);
@@ -0,0 +1,25 @@
+-- Remove row-level security policies
+DROP POLICY IF EXISTS tenant_isolation ON messages;
+ALTER TABLE messages NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE messages DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON room_members;
+ALTER TABLE room_members NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE room_members DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON rooms;
+ALTER TABLE rooms NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE rooms DISABLE ROW LEVEL SECURITY;
+
+DROP FUNCTION IF EXISTS app_tenant_visible(UUID);
+
+-- Remove composite tenant keys
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_user_tenant_fkey;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_room_tenant_fkey;
+ALTER TABLE room_members DROP CONSTRAINT IF EXISTS room_members_user_tenant_fkey;
+ALTER TABLE room_members DROP CONSTRAINT IF EXISTS room_members_room_tenant_fkey;
+ALTER TABLE rooms DROP CONSTRAINT IF EXISTS rooms_id_tenant_id_key;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_id_tenant_id_key;
+
+DROP INDEX IF EXISTS idx_room_members_tenant_id;
+ALTER TABLE room_members DROP COLUMN IF EXISTS tenant_id;
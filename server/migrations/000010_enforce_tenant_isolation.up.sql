@@ -0,0 +1,46 @@
+-- Room memberships carry their tenant so policies never need a join
+ALTER TABLE room_members ADD COLUMN tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE;
+UPDATE room_members rm SET tenant_id = r.tenant_id FROM rooms r WHERE r.id = rm.room_id;
+ALTER TABLE room_members ALTER COLUMN tenant_id SET NOT NULL;
+CREATE INDEX idx_room_members_tenant_id ON room_members (tenant_id);
+
+-- Composite keys make it impossible to link rows of different tenants, even
+-- for connections that bypass row-level security
+ALTER TABLE users ADD CONSTRAINT users_id_tenant_id_key UNIQUE (id, tenant_id);
+ALTER TABLE rooms ADD CONSTRAINT rooms_id_tenant_id_key UNIQUE (id, tenant_id);
+
+ALTER TABLE room_members ADD CONSTRAINT room_members_room_tenant_fkey
+    FOREIGN KEY (room_id, tenant_id) REFERENCES rooms (id, tenant_id) ON DELETE CASCADE;
+ALTER TABLE room_members ADD CONSTRAINT room_members_user_tenant_fkey
+    FOREIGN KEY (user_id, tenant_id) REFERENCES users (id, tenant_id) ON DELETE CASCADE;
+ALTER TABLE messages ADD CONSTRAINT messages_room_tenant_fkey
+    FOREIGN KEY (room_id, tenant_id) REFERENCES rooms (id, tenant_id) ON DELETE CASCADE;
+ALTER TABLE messages ADD CONSTRAINT messages_user_tenant_fkey
+    FOREIGN KEY (user_id, tenant_id) REFERENCES users (id, tenant_id) ON DELETE RESTRICT;
+
+-- A row is visible when it belongs to the transaction's tenant, or when the
+-- transaction runs in system context for background jobs
+CREATE FUNCTION app_tenant_visible(row_tenant_id UUID) RETURNS BOOLEAN AS $$
+    SELECT COALESCE(current_setting('app.bypass_rls', true), '') = 'on'
+        OR row_tenant_id = NULLIF(current_setting('app.tenant_id', true), '')::uuid
+$$ LANGUAGE sql STABLE;
+
+-- FORCE applies the policies to the table owner too. Superusers and roles
+-- with BYPASSRLS still skip them, so the server must not connect as one.
+ALTER TABLE rooms ENABLE ROW LEVEL SECURITY;
+ALTER TABLE rooms FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON rooms
+    USING (app_tenant_visible(tenant_id))
+    WITH CHECK (app_tenant_visible(tenant_id));
+
+ALTER TABLE room_members ENABLE ROW LEVEL SECURITY;
+ALTER TABLE room_members FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON room_members
+    USING (app_tenant_visible(tenant_id))
+    WITH CHECK (app_tenant_visible(tenant_id));
+
+ALTER TABLE messages ENABLE ROW LEVEL SECURITY;
+ALTER TABLE messages FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON messages
+    USING (app_tenant_visible(tenant_id))
+    WITH CHECK (app_tenant_visible(tenant_id));
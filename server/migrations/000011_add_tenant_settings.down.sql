@@ -0,0 +1,2 @@
+-- Drop per-tenant configuration
+DROP TABLE IF EXISTS tenant_settings;
@@ -0,0 +1,7 @@
+-- Per-tenant configuration. Only overridden keys are stored; the server
+-- fills in typed defaults for everything else.
+CREATE TABLE tenant_settings (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    settings JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,26 @@
+-- Restore single-use tenant invitations
+ALTER TABLE tenant_invites ADD COLUMN used_at TIMESTAMP;
+ALTER TABLE tenant_invites ADD COLUMN used_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+UPDATE tenant_invites i
+SET used_at = r.redeemed_at, used_by = r.user_id
+FROM (
+    SELECT DISTINCT ON (invite_id) invite_id, user_id, redeemed_at
+    FROM tenant_invite_redemptions
+    ORDER BY invite_id, redeemed_at
+) r
+WHERE i.id = r.invite_id;
+
+-- Invitations used up or revoked without a recorded redemption stay unusable
+UPDATE tenant_invites SET used_at = COALESCE(revoked_at, NOW())
+WHERE used_at IS NULL AND (revoked_at IS NOT NULL OR use_count >= max_uses);
+
+DROP TABLE IF EXISTS tenant_invite_redemptions;
+
+ALTER TABLE tenant_invites DROP CONSTRAINT IF EXISTS tenant_invites_use_count_check;
+ALTER TABLE tenant_invites DROP COLUMN IF EXISTS created_by;
+ALTER TABLE tenant_invites DROP COLUMN IF EXISTS revoked_at;
+ALTER TABLE tenant_invites DROP COLUMN IF EXISTS use_count;
+ALTER TABLE tenant_invites DROP COLUMN IF EXISTS max_uses;
+ALTER TABLE tenant_invites DROP COLUMN IF EXISTS phone_number;
+ALTER TABLE tenant_invites DROP COLUMN IF EXISTS email;
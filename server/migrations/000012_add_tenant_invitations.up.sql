@@ -0,0 +1,28 @@
+-- Turn single-use tenant invitations into targeted invitations and reusable
+-- join links with a use limit
+ALTER TABLE tenant_invites ADD COLUMN email TEXT;
+ALTER TABLE tenant_invites ADD COLUMN phone_number TEXT;
+ALTER TABLE tenant_invites ADD COLUMN max_uses INTEGER NOT NULL DEFAULT 1 CHECK (max_uses > 0);
+ALTER TABLE tenant_invites ADD COLUMN use_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tenant_invites ADD COLUMN revoked_at TIMESTAMP;
+ALTER TABLE tenant_invites ADD COLUMN created_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- Users who joined through an invitation
+CREATE TABLE tenant_invite_redemptions (
+    invite_id UUID NOT NULL REFERENCES tenant_invites(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redeemed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (invite_id, user_id)
+);
+
+CREATE INDEX idx_tenant_invite_redemptions_user_id ON tenant_invite_redemptions (user_id);
+
+-- Carry over redemptions of the single-use invitations
+UPDATE tenant_invites SET use_count = 1 WHERE used_at IS NOT NULL;
+
+INSERT INTO tenant_invite_redemptions (invite_id, user_id, redeemed_at)
+SELECT id, used_by, used_at FROM tenant_invites WHERE used_by IS NOT NULL;
+
+ALTER TABLE tenant_invites ADD CONSTRAINT tenant_invites_use_count_check CHECK (use_count BETWEEN 0 AND max_uses);
+ALTER TABLE tenant_invites DROP COLUMN used_at;
+ALTER TABLE tenant_invites DROP COLUMN used_by;
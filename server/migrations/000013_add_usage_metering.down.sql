@@ -0,0 +1,6 @@
+-- Drop usage metering and quotas
+DROP TABLE IF EXISTS tenant_quota_warnings;
+DROP TABLE IF EXISTS tenant_storage;
+DROP TABLE IF EXISTS tenant_active_users;
+DROP TABLE IF EXISTS tenant_usage;
+DROP TABLE IF EXISTS tenant_quotas;
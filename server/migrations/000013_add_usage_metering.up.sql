@@ -0,0 +1,51 @@
+-- Per-tenant limits for paid plans. NULL means unlimited.
+CREATE TABLE tenant_quotas (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    max_messages_per_month BIGINT CHECK (max_messages_per_month >= 0),
+    max_sms_per_month BIGINT CHECK (max_sms_per_month >= 0),
+    max_storage_bytes BIGINT CHECK (max_storage_bytes >= 0),
+    max_active_users INTEGER CHECK (max_active_users >= 0),
+    warning_percent INTEGER NOT NULL DEFAULT 80 CHECK (warning_percent BETWEEN 1 AND 100),
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Monthly counters, period is the first day of the month
+CREATE TABLE tenant_usage (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    period DATE NOT NULL,
+    messages_sent BIGINT NOT NULL DEFAULT 0,
+    sms_sent BIGINT NOT NULL DEFAULT 0,
+    active_users INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, period)
+);
+
+-- Users who sent a message in a month, counted once each
+CREATE TABLE tenant_active_users (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    period DATE NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (tenant_id, period, user_id)
+);
+
+-- Storage is a running total, corrected periodically from the stored data
+CREATE TABLE tenant_storage (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Soft quota warnings already sent, so each is sent once per month
+CREATE TABLE tenant_quota_warnings (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    period DATE NOT NULL,
+    metric TEXT NOT NULL,
+    warned_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, period, metric)
+);
+
+-- Seed storage from existing messages, which row-level security hides
+-- unless bypassed for this session
+SELECT set_config('app.bypass_rls', 'on', false);
+INSERT INTO tenant_storage (tenant_id, bytes)
+SELECT tenant_id, SUM(octet_length(content)) FROM messages GROUP BY tenant_id;
+SELECT set_config('app.bypass_rls', '', false);
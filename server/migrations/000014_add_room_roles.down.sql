@@ -0,0 +1,5 @@
+-- Drop pinned messages and room roles
+DROP TABLE IF EXISTS pinned_messages;
+
+DROP INDEX IF EXISTS idx_room_members_owner;
+ALTER TABLE room_members DROP COLUMN IF EXISTS role;
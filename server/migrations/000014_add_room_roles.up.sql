@@ -0,0 +1,45 @@
+-- Room members have a role that decides what they may do in the room
+ALTER TABLE room_members ADD COLUMN role TEXT NOT NULL DEFAULT 'member'
+    CHECK (role IN ('owner', 'admin', 'member'));
+
+-- A room has at most one owner
+CREATE UNIQUE INDEX idx_room_members_owner ON room_members (room_id) WHERE role = 'owner';
+
+-- Existing group rooms are owned by whoever posted first, or by any member
+-- when nobody has posted yet. Row-level security hides all rooms unless
+-- bypassed for this session.
+SELECT set_config('app.bypass_rls', 'on', false);
+UPDATE room_members rm SET role = 'owner'
+FROM (
+    SELECT DISTINCT ON (r.id) r.id AS room_id, rm.user_id
+    FROM rooms r
+    JOIN room_members rm ON rm.room_id = r.id
+    LEFT JOIN LATERAL (
+        SELECT MIN(m.id) AS first_message_id
+        FROM messages m
+        WHERE m.room_id = r.id AND m.user_id = rm.user_id
+    ) first ON TRUE
+    WHERE r.type = 'group'
+    ORDER BY r.id, first.first_message_id NULLS LAST, rm.user_id
+) owners
+WHERE rm.room_id = owners.room_id AND rm.user_id = owners.user_id;
+SELECT set_config('app.bypass_rls', '', false);
+
+-- Messages pinned to the top of a room
+CREATE TABLE pinned_messages (
+    room_id UUID NOT NULL,
+    message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    pinned_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    pinned_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (room_id, message_id),
+    FOREIGN KEY (room_id, tenant_id) REFERENCES rooms (id, tenant_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_pinned_messages_tenant_id ON pinned_messages (tenant_id);
+
+ALTER TABLE pinned_messages ENABLE ROW LEVEL SECURITY;
+ALTER TABLE pinned_messages FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON pinned_messages
+    USING (app_tenant_visible(tenant_id))
+    WITH CHECK (app_tenant_visible(tenant_id));
@@ -0,0 +1,12 @@
+-- Remove room details, archiving and system messages
+SELECT set_config('app.bypass_rls', 'on', false);
+DELETE FROM messages WHERE type = 'system';
+SELECT set_config('app.bypass_rls', '', false);
+ALTER TABLE messages DROP COLUMN IF EXISTS type;
+
+ALTER TABLE room_members DROP COLUMN IF EXISTS joined_at;
+ALTER TABLE room_members DROP COLUMN IF EXISTS archived_at;
+
+ALTER TABLE rooms DROP COLUMN IF EXISTS topic;
+ALTER TABLE rooms DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE rooms DROP COLUMN IF EXISTS description;
@@ -0,0 +1,14 @@
+-- Room details shown in the room header
+ALTER TABLE rooms ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE rooms ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE rooms ADD COLUMN topic TEXT NOT NULL DEFAULT '';
+
+-- Members can archive a room for themselves. joined_at decides who inherits
+-- a room when its owner leaves.
+ALTER TABLE room_members ADD COLUMN archived_at TIMESTAMP;
+ALTER TABLE room_members ADD COLUMN joined_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- System messages record room changes in the timeline. Their user_id is the
+-- member who made the change.
+ALTER TABLE messages ADD COLUMN type TEXT NOT NULL DEFAULT 'user'
+    CHECK (type IN ('user', 'system'));
@@ -0,0 +1,8 @@
+-- Drop room activity tracking and read markers
+DROP INDEX IF EXISTS idx_room_members_user_id;
+DROP INDEX IF EXISTS idx_rooms_last_activity;
+
+ALTER TABLE room_members DROP COLUMN IF EXISTS last_read_message_id;
+
+ALTER TABLE rooms DROP COLUMN IF EXISTS last_activity_at;
+ALTER TABLE rooms DROP COLUMN IF EXISTS last_message_id;
@@ -0,0 +1,29 @@
+-- The room list is ordered by last activity and previews the last message.
+-- Both are kept on the room so the list does not scan messages.
+ALTER TABLE rooms ADD COLUMN last_message_id TEXT;
+ALTER TABLE rooms ADD COLUMN last_activity_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- Messages up to and including last_read_message_id have been read by the
+-- member. ULIDs sort by time, so everything after it is unread.
+ALTER TABLE room_members ADD COLUMN last_read_message_id TEXT;
+
+CREATE INDEX idx_rooms_last_activity ON rooms (last_activity_at DESC, id DESC);
+CREATE INDEX idx_room_members_user_id ON room_members (user_id);
+
+-- Existing rooms take their activity from their latest message, and existing
+-- members start with everything read
+SELECT set_config('app.bypass_rls', 'on', false);
+UPDATE rooms r SET last_message_id = latest.id, last_activity_at = GREATEST(r.created_at, latest.sent_at)
+FROM (
+    SELECT DISTINCT ON (room_id) room_id, id, sent_at
+    FROM messages
+    ORDER BY room_id, id DESC
+) latest
+WHERE latest.room_id = r.id;
+
+UPDATE rooms SET last_activity_at = created_at WHERE last_message_id IS NULL;
+
+UPDATE room_members rm SET last_read_message_id = r.last_message_id
+FROM rooms r
+WHERE r.id = rm.room_id;
+SELECT set_config('app.bypass_rls', '', false);
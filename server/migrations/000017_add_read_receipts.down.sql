@@ -0,0 +1,3 @@
+-- Drop read receipt timestamps and settings
+ALTER TABLE users DROP COLUMN IF EXISTS hide_read_receipts;
+ALTER TABLE room_members DROP COLUMN IF EXISTS last_read_at;
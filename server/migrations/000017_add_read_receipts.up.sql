@@ -0,0 +1,6 @@
+-- When each member last moved their read marker, shown in read receipts
+ALTER TABLE room_members ADD COLUMN last_read_at TIMESTAMP;
+
+-- Users who hide read receipts are left out of receipts and cannot see
+-- other members' receipts either
+ALTER TABLE users ADD COLUMN hide_read_receipts BOOLEAN NOT NULL DEFAULT FALSE;
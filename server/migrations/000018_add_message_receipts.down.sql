@@ -0,0 +1,2 @@
+-- Drop per-recipient delivery state
+DROP TABLE IF EXISTS message_receipts;
@@ -0,0 +1,26 @@
+-- Delivery state of each message for each recipient. Rows start as 'sent',
+-- become 'delivered' when a client of the recipient acknowledges the message
+-- and 'read' when the recipient's read marker passes it.
+CREATE TABLE message_receipts (
+    message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    room_id UUID NOT NULL,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'sent' CHECK (status IN ('sent', 'delivered', 'read')),
+    delivered_at TIMESTAMP,
+    read_at TIMESTAMP,
+    PRIMARY KEY (message_id, user_id),
+    FOREIGN KEY (user_id, tenant_id) REFERENCES users (id, tenant_id) ON DELETE CASCADE,
+    FOREIGN KEY (room_id, tenant_id) REFERENCES rooms (id, tenant_id) ON DELETE CASCADE
+);
+
+-- Redelivery looks up a user's undelivered messages
+CREATE INDEX idx_message_receipts_undelivered ON message_receipts (user_id, message_id) WHERE status = 'sent';
+CREATE INDEX idx_message_receipts_room_user ON message_receipts (room_id, user_id, message_id);
+CREATE INDEX idx_message_receipts_tenant_id ON message_receipts (tenant_id);
+
+ALTER TABLE message_receipts ENABLE ROW LEVEL SECURITY;
+ALTER TABLE message_receipts FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON message_receipts
+    USING (app_tenant_visible(tenant_id))
+    WITH CHECK (app_tenant_visible(tenant_id));
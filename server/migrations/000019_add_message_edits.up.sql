@@ -0,0 +1,21 @@
+-- Messages can be edited by their author. Each edit keeps the replaced
+-- content as a revision.
+ALTER TABLE messages ADD COLUMN edited_at TIMESTAMP;
+
+CREATE TABLE message_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    edited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    edited_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_message_revisions_message_id ON message_revisions (message_id, id);
+CREATE INDEX idx_message_revisions_tenant_id ON message_revisions (tenant_id);
+
+ALTER TABLE message_revisions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE message_revisions FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON message_revisions
+    USING (app_tenant_visible(tenant_id))
+    WITH CHECK (app_tenant_visible(tenant_id));
@@ -0,0 +1,4 @@
+-- Drop message deletion
+DROP TABLE IF EXISTS message_hides;
+ALTER TABLE messages DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE messages DROP COLUMN IF EXISTS deleted_at;
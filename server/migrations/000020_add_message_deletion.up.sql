@@ -0,0 +1,23 @@
+-- Messages deleted for everyone stay in place as tombstones, so cursors
+-- into a room's timeline stay valid, but lose their content and history.
+ALTER TABLE messages ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE messages ADD COLUMN deleted_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- Messages a user deleted for themselves only
+CREATE TABLE message_hides (
+    message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    hidden_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, message_id),
+    FOREIGN KEY (user_id, tenant_id) REFERENCES users (id, tenant_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_message_hides_message_id ON message_hides (message_id);
+CREATE INDEX idx_message_hides_tenant_id ON message_hides (tenant_id);
+
+ALTER TABLE message_hides ENABLE ROW LEVEL SECURITY;
+ALTER TABLE message_hides FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON message_hides
+    USING (app_tenant_visible(tenant_id))
+    WITH CHECK (app_tenant_visible(tenant_id));
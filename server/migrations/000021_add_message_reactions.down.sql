@@ -0,0 +1,2 @@
+-- Drop message reactions
+DROP TABLE IF EXISTS message_reactions;
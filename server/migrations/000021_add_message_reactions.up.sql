@@ -0,0 +1,19 @@
+-- Emoji reactions of members to messages. A member can react to a message
+-- with any number of different emoji, each once.
+CREATE TABLE message_reactions (
+    message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    emoji TEXT NOT NULL,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id, emoji),
+    FOREIGN KEY (user_id, tenant_id) REFERENCES users (id, tenant_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_message_reactions_tenant_id ON message_reactions (tenant_id);
+
+ALTER TABLE message_reactions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE message_reactions FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON message_reactions
+    USING (app_tenant_visible(tenant_id))
+    WITH CHECK (app_tenant_visible(tenant_id));
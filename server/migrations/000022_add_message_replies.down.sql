@@ -0,0 +1,2 @@
+-- Drop message replies
+ALTER TABLE messages DROP COLUMN IF EXISTS reply_to_id;
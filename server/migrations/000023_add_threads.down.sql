@@ -0,0 +1,5 @@
+-- Drop threads
+DROP TABLE IF EXISTS thread_follows;
+ALTER TABLE messages DROP COLUMN IF EXISTS last_reply_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS reply_count;
+ALTER TABLE messages DROP COLUMN IF EXISTS thread_root_id;
@@ -0,0 +1,30 @@
+-- Thread replies point at the top-level message that started the thread.
+-- Roots keep a count of their replies and the time of the latest one.
+ALTER TABLE messages ADD COLUMN thread_root_id TEXT REFERENCES messages(id) ON DELETE CASCADE;
+ALTER TABLE messages ADD COLUMN reply_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN last_reply_at TIMESTAMP;
+
+CREATE INDEX idx_messages_thread_root_id ON messages (thread_root_id, id) WHERE thread_root_id IS NOT NULL;
+
+-- Members following a thread, with how far they have read it
+CREATE TABLE thread_follows (
+    thread_root_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    room_id UUID NOT NULL,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    last_read_message_id TEXT,
+    followed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, thread_root_id),
+    FOREIGN KEY (user_id, tenant_id) REFERENCES users (id, tenant_id) ON DELETE CASCADE,
+    FOREIGN KEY (room_id, tenant_id) REFERENCES rooms (id, tenant_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_thread_follows_thread_root_id ON thread_follows (thread_root_id);
+CREATE INDEX idx_thread_follows_room_user ON thread_follows (room_id, user_id);
+CREATE INDEX idx_thread_follows_tenant_id ON thread_follows (tenant_id);
+
+ALTER TABLE thread_follows ENABLE ROW LEVEL SECURITY;
+ALTER TABLE thread_follows FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON thread_follows
+    USING (app_tenant_visible(tenant_id))
+    WITH CHECK (app_tenant_visible(tenant_id));
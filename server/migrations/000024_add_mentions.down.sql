@@ -0,0 +1,3 @@
+-- Drop mentions
+DROP TABLE IF EXISTS message_mentions;
+ALTER TABLE messages DROP COLUMN IF EXISTS mentions;
@@ -0,0 +1,24 @@
+-- Mentions of a message as sent: user IDs, 'here' and 'room'
+ALTER TABLE messages ADD COLUMN mentions TEXT[] NOT NULL DEFAULT '{}';
+
+-- One row per member a message mentions, directly or through @here or @room,
+-- for each user's mentions inbox
+CREATE TABLE message_mentions (
+    message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    room_id UUID NOT NULL,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('user', 'here', 'room')),
+    PRIMARY KEY (message_id, user_id),
+    FOREIGN KEY (user_id, tenant_id) REFERENCES users (id, tenant_id) ON DELETE CASCADE,
+    FOREIGN KEY (room_id, tenant_id) REFERENCES rooms (id, tenant_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_message_mentions_user_message ON message_mentions (user_id, message_id DESC);
+CREATE INDEX idx_message_mentions_tenant_id ON message_mentions (tenant_id);
+
+ALTER TABLE message_mentions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE message_mentions FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON message_mentions
+    USING (app_tenant_visible(tenant_id))
+    WITH CHECK (app_tenant_visible(tenant_id));
@@ -0,0 +1,4 @@
+-- Drop message search
+DROP INDEX IF EXISTS idx_messages_search_vector;
+ALTER TABLE messages DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE messages DROP COLUMN IF EXISTS search_language;
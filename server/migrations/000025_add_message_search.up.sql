@@ -0,0 +1,7 @@
+-- Full-text search over message content. Each message is indexed with the
+-- text search configuration of its tenant's language when it was sent.
+ALTER TABLE messages ADD COLUMN search_language REGCONFIG NOT NULL DEFAULT 'english';
+ALTER TABLE messages ADD COLUMN search_vector TSVECTOR
+    GENERATED ALWAYS AS (to_tsvector(search_language, content)) STORED;
+
+CREATE INDEX idx_messages_search_vector ON messages USING GIN (search_vector);
@@ -0,0 +1,8 @@
+-- Drop attachments
+DROP TRIGGER IF EXISTS upload_sessions_queue_chunk_deletion ON upload_sessions;
+DROP TRIGGER IF EXISTS attachments_queue_blob_deletion ON attachments;
+DROP FUNCTION IF EXISTS queue_upload_chunk_deletion();
+DROP FUNCTION IF EXISTS queue_attachment_blob_deletion();
+DROP TABLE IF EXISTS blob_deletions;
+DROP TABLE IF EXISTS upload_sessions;
+DROP TABLE IF EXISTS attachments;
@@ -0,0 +1,95 @@
+-- Files uploaded by users. Contents live in the blob store under
+-- storage_key; a row without a message is an upload that was not sent yet,
+-- or, once attached_at is set, one whose message was deleted.
+CREATE TABLE attachments (
+    id UUID PRIMARY KEY,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    message_id TEXT REFERENCES messages(id) ON DELETE SET NULL,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    attached_at TIMESTAMP,
+    FOREIGN KEY (user_id, tenant_id) REFERENCES users (id, tenant_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_attachments_message_id ON attachments (message_id);
+CREATE INDEX idx_attachments_unattached ON attachments (created_at) WHERE message_id IS NULL;
+CREATE INDEX idx_attachments_tenant_id ON attachments (tenant_id);
+
+ALTER TABLE attachments ENABLE ROW LEVEL SECURITY;
+ALTER TABLE attachments FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON attachments
+    USING (app_tenant_visible(tenant_id))
+    WITH CHECK (app_tenant_visible(tenant_id));
+
+-- Resumable uploads in progress. Chunks are stored in the blob store as
+-- storage_prefix followed by their zero-padded index until the upload is
+-- completed.
+CREATE TABLE upload_sessions (
+    id UUID PRIMARY KEY,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    filename TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    received BIGINT NOT NULL DEFAULT 0,
+    chunks INTEGER NOT NULL DEFAULT 0,
+    storage_prefix TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id, tenant_id) REFERENCES users (id, tenant_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_upload_sessions_updated_at ON upload_sessions (updated_at);
+CREATE INDEX idx_upload_sessions_tenant_id ON upload_sessions (tenant_id);
+
+ALTER TABLE upload_sessions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE upload_sessions FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON upload_sessions
+    USING (app_tenant_visible(tenant_id))
+    WITH CHECK (app_tenant_visible(tenant_id));
+
+-- Blobs waiting to be removed from the blob store. Rows are queued by
+-- triggers, so blobs are also cleaned up when their rows go away through
+-- cascades from users or tenants. No foreign key to tenants, the queue has
+-- to outlive them.
+CREATE TABLE blob_deletions (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id UUID NOT NULL,
+    storage_key TEXT NOT NULL,
+    queued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_blob_deletions_tenant_id ON blob_deletions (tenant_id);
+
+ALTER TABLE blob_deletions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE blob_deletions FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON blob_deletions
+    USING (app_tenant_visible(tenant_id))
+    WITH CHECK (app_tenant_visible(tenant_id));
+
+CREATE FUNCTION queue_attachment_blob_deletion() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO blob_deletions (tenant_id, storage_key) VALUES (OLD.tenant_id, OLD.storage_key);
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER attachments_queue_blob_deletion
+    AFTER DELETE ON attachments
+    FOR EACH ROW EXECUTE FUNCTION queue_attachment_blob_deletion();
+
+CREATE FUNCTION queue_upload_chunk_deletion() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO blob_deletions (tenant_id, storage_key)
+    SELECT OLD.tenant_id, OLD.storage_prefix || lpad(i::text, 6, '0')
+    FROM generate_series(0, OLD.chunks - 1) AS i;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER upload_sessions_queue_chunk_deletion
+    AFTER DELETE ON upload_sessions
+    FOR EACH ROW EXECUTE FUNCTION queue_upload_chunk_deletion();
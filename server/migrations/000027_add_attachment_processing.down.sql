@@ -0,0 +1,17 @@
+-- Drop attachment processing
+CREATE OR REPLACE FUNCTION queue_attachment_blob_deletion() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO blob_deletions (tenant_id, storage_key) VALUES (OLD.tenant_id, OLD.storage_key);
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS idx_attachments_processing;
+ALTER TABLE attachments DROP COLUMN IF EXISTS thumbnail_size;
+ALTER TABLE attachments DROP COLUMN IF EXISTS thumbnail_key;
+ALTER TABLE attachments DROP COLUMN IF EXISTS blurhash;
+ALTER TABLE attachments DROP COLUMN IF EXISTS height;
+ALTER TABLE attachments DROP COLUMN IF EXISTS width;
+ALTER TABLE attachments DROP COLUMN IF EXISTS processed_at;
+ALTER TABLE attachments DROP COLUMN IF EXISTS processing_started_at;
+ALTER TABLE attachments DROP COLUMN IF EXISTS processing_status;
@@ -0,0 +1,25 @@
+-- Images and videos are processed in the background after upload.
+-- processing_status is NULL for other files, otherwise 'pending',
+-- 'processing', 'ready', 'failed' or 'unsupported'.
+ALTER TABLE attachments ADD COLUMN processing_status TEXT;
+ALTER TABLE attachments ADD COLUMN processing_started_at TIMESTAMP;
+ALTER TABLE attachments ADD COLUMN processed_at TIMESTAMP;
+ALTER TABLE attachments ADD COLUMN width INTEGER;
+ALTER TABLE attachments ADD COLUMN height INTEGER;
+ALTER TABLE attachments ADD COLUMN blurhash TEXT;
+ALTER TABLE attachments ADD COLUMN thumbnail_key TEXT;
+ALTER TABLE attachments ADD COLUMN thumbnail_size BIGINT;
+
+CREATE INDEX idx_attachments_processing ON attachments (created_at)
+    WHERE processing_status IN ('pending', 'processing');
+
+-- Thumbnails go with their attachment
+CREATE OR REPLACE FUNCTION queue_attachment_blob_deletion() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO blob_deletions (tenant_id, storage_key) VALUES (OLD.tenant_id, OLD.storage_key);
+    IF OLD.thumbnail_key IS NOT NULL THEN
+        INSERT INTO blob_deletions (tenant_id, storage_key) VALUES (OLD.tenant_id, OLD.thumbnail_key);
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,12 @@
+-- Remove voice notes; sent ones stay as messages with an audio attachment
+ALTER TABLE message_receipts DROP COLUMN IF EXISTS listened_at;
+
+ALTER TABLE attachments DROP COLUMN IF EXISTS waveform;
+ALTER TABLE attachments DROP COLUMN IF EXISTS duration_ms;
+
+SELECT set_config('app.bypass_rls', 'on', false);
+UPDATE messages SET type = 'user' WHERE type = 'voice';
+SELECT set_config('app.bypass_rls', '', false);
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_type_check;
+ALTER TABLE messages ADD CONSTRAINT messages_type_check
+    CHECK (type IN ('user', 'system'));
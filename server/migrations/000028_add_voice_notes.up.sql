@@ -0,0 +1,12 @@
+-- Voice notes are messages of type 'voice' carrying one audio attachment
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_type_check;
+ALTER TABLE messages ADD CONSTRAINT messages_type_check
+    CHECK (type IN ('user', 'voice', 'system'));
+
+-- Duration and waveform of audio that can be sent as a voice note, filled in
+-- when the upload is stored. NULL for other files.
+ALTER TABLE attachments ADD COLUMN duration_ms INTEGER;
+ALTER TABLE attachments ADD COLUMN waveform SMALLINT[];
+
+-- When each recipient first played a voice note
+ALTER TABLE message_receipts ADD COLUMN listened_at TIMESTAMP;
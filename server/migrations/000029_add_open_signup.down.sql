@@ -0,0 +1 @@
+UPDATE tenant_settings SET settings = settings - 'open_signup' WHERE settings ? 'open_signup';
@@ -0,0 +1,7 @@
+-- Tenants only take signups without an invitation when their open_signup
+-- setting is on, which it is not by default. The default tenant received
+-- every such signup so far and stays open.
+INSERT INTO tenant_settings (tenant_id, settings)
+SELECT id, '{"open_signup": true}' FROM tenants WHERE is_default
+ON CONFLICT (tenant_id) DO UPDATE
+SET settings = tenant_settings.settings || EXCLUDED.settings, updated_at = NOW();
@@ -0,0 +1,5 @@
+-- Who scheduled an account for deletion: the user themself, who may restore
+-- it, or an admin, who may not be overruled by them. Accounts pending
+-- deletion so far were taken to be deleted by their user.
+ALTER TABLE users ADD COLUMN deleted_by UUID REFERENCES users(id) ON DELETE SET NULL;
+UPDATE users SET deleted_by = id WHERE deleted_at IS NOT NULL AND purged_at IS NULL;
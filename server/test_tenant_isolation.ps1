@@ -0,0 +1,123 @@
+# Test script for tenant isolation
+# Make sure the server is running on http://localhost:4000 and connects to
+# Postgres as a role without SUPERUSER or BYPASSRLS, otherwise row-level
+# security is not enforced.
+#
+# Requires a superadmin token to provision the second tenant. Set DATABASE_URL
+# and have psql on the PATH to also run the database-level checks.
+
+$baseUrl = "http://localhost:4000"
+$suffix = Get-Random
+$failures = 0
+
+Write-Host "Testing tenant isolation..." -ForegroundColor Green
+
+$superAdminToken = $env:SUPERADMIN_TOKEN
+if (-not $superAdminToken) {
+    $superAdminToken = Read-Host "Enter a superadmin JWT token"
+}
+
+function Invoke-Api($method, $path, $token, $body) {
+    $headers = @{}
+    if ($token) { $headers["Authorization"] = "Bearer $token" }
+    $params = @{ Uri = "$baseUrl$path"; Method = $method; Headers = $headers; ContentType = "application/json" }
+    if ($body) { $params["Body"] = ($body | ConvertTo-Json) }
+    return Invoke-RestMethod @params
+}
+
+# Expects the request to be rejected with one of the given status codes
+function Assert-Rejected($description, $statusCodes, $method, $path, $token, $body) {
+    try {
+        $response = Invoke-Api $method $path $token $body
+        Write-Host "FAIL: $description succeeded: $($response | ConvertTo-Json -Depth 5)" -ForegroundColor Red
+        $script:failures++
+    } catch {
+        $status = [int]$_.Exception.Response.StatusCode
+        if ($statusCodes -contains $status) {
+            Write-Host "PASS: $description rejected with $status" -ForegroundColor Cyan
+        } else {
+            Write-Host "FAIL: $description returned $status, expected $($statusCodes -join ' or ')" -ForegroundColor Red
+            $script:failures++
+        }
+    }
+}
+
+# Setup: a user in the default tenant and a user in a freshly provisioned tenant
+Write-Host "`n1. Provisioning tenants and users..." -ForegroundColor Yellow
+$tenantB = Invoke-Api POST "/platform/tenants" $superAdminToken @{ name = "Isolation Test $suffix"; slug = "isolation-$suffix" }
+Write-Host "Created tenant $($tenantB.tenant.id)" -ForegroundColor Cyan
+
+$userA = Invoke-Api POST "/auth/signup" $null @{ email = "tenant-a-$suffix@example.com"; password = "password123" }
+$userB = Invoke-Api POST "/auth/signup" $null @{ email = "tenant-b-$suffix@example.com"; password = "password123"; invite_code = $tenantB.owner_invite.code }
+$tokenA = $userA.token
+$tokenB = $userB.token
+
+$roomsA = Invoke-Api POST "/chat/rooms" $tokenA @{ name = "Tenant A room"; type = "group"; user_ids = @() }
+$roomA = $roomsA.room.id
+Invoke-Api POST "/chat/rooms/$roomA/messages" $tokenA @{ content = "Tenant A secret" } | Out-Null
+Write-Host "User A created room $roomA" -ForegroundColor Cyan
+
+# The user ID of B is read from the token payload
+$payloadB = $tokenB.Split(".")[1].Replace("-", "+").Replace("_", "/")
+$payloadB = $payloadB.PadRight($payloadB.Length + (4 - $payloadB.Length % 4) % 4, "=")
+$userIdB = ([System.Text.Encoding]::UTF8.GetString([Convert]::FromBase64String($payloadB)) | ConvertFrom-Json).user_id
+
+# Cross-tenant reads
+Write-Host "`n2. Cross-tenant reads..." -ForegroundColor Yellow
+Assert-Rejected "Reading another tenant's room" @(403, 404) GET "/chat/rooms/$roomA" $tokenB
+Assert-Rejected "Reading another tenant's messages" @(403, 404) GET "/chat/rooms/$roomA/messages" $tokenB
+
+$roomsB = Invoke-Api GET "/chat/rooms" $tokenB
+if (@($roomsB.rooms | Where-Object { $_.id -eq $roomA }).Count -gt 0) {
+    Write-Host "FAIL: Room list of tenant B contains tenant A's room" -ForegroundColor Red
+    $failures++
+} else {
+    Write-Host "PASS: Room list of tenant B does not contain tenant A's room" -ForegroundColor Cyan
+}
+
+# Cross-tenant writes
+Write-Host "`n3. Cross-tenant writes..." -ForegroundColor Yellow
+Assert-Rejected "Posting into another tenant's room" @(403, 404) POST "/chat/rooms/$roomA/messages" $tokenB @{ content = "intrusion" }
+Assert-Rejected "Joining another tenant's room" @(400, 403, 404) POST "/chat/rooms/$roomA/members" $tokenB @{ member_id = $userIdB }
+Assert-Rejected "Adding a user of another tenant to a room" @(400, 404) POST "/chat/rooms/$roomA/members" $tokenA @{ member_id = $userIdB }
+Assert-Rejected "Creating a room with a user of another tenant" @(400, 404) POST "/chat/rooms" $tokenA @{ name = "Mixed"; type = "group"; user_ids = @($userIdB) }
+Assert-Rejected "Sending a direct message across tenants" @(404) POST "/chat/direct/message" $tokenA @{ recipient_id = $userIdB; content = "hello" }
+
+# Database-level checks: row-level security must hide and reject rows even
+# when the application filters are bypassed
+if ($env:DATABASE_URL -and (Get-Command psql -ErrorAction SilentlyContinue)) {
+    Write-Host "`n4. Row-level security..." -ForegroundColor Yellow
+    $tenantIdB = $tenantB.tenant.id
+
+    $visible = psql $env:DATABASE_URL -tA -c "BEGIN; SELECT set_config('app.tenant_id', '$tenantIdB', true); SELECT COUNT(*) FROM messages WHERE room_id = '$roomA'; ROLLBACK;" | Select-Object -Last 1
+    if ($visible -eq "0") {
+        Write-Host "PASS: Tenant B sees no messages of tenant A" -ForegroundColor Cyan
+    } else {
+        Write-Host "FAIL: Tenant B sees $visible messages of tenant A" -ForegroundColor Red
+        $failures++
+    }
+
+    $unscoped = psql $env:DATABASE_URL -tA -c "SELECT COUNT(*) FROM rooms" | Select-Object -Last 1
+    if ($unscoped -eq "0") {
+        Write-Host "PASS: Queries without a tenant see no rows" -ForegroundColor Cyan
+    } else {
+        Write-Host "FAIL: Queries without a tenant see $unscoped rooms" -ForegroundColor Red
+        $failures++
+    }
+
+    psql $env:DATABASE_URL -v ON_ERROR_STOP=1 -c "BEGIN; SELECT set_config('app.tenant_id', '$tenantIdB', true); INSERT INTO messages (id, tenant_id, room_id, user_id, content) VALUES ('01HZZZZZZZZZZZZZZZZZZZZZZZ', '$tenantIdB', '$roomA', '$userIdB', 'intrusion'); ROLLBACK;" 2>&1 | Out-Null
+    if ($LASTEXITCODE -ne 0) {
+        Write-Host "PASS: Inserting into another tenant's room is rejected" -ForegroundColor Cyan
+    } else {
+        Write-Host "FAIL: Inserting into another tenant's room succeeded" -ForegroundColor Red
+        $failures++
+    }
+} else {
+    Write-Host "`nSkipping row-level security checks (DATABASE_URL or psql missing)" -ForegroundColor Red
+}
+
+if ($failures -gt 0) {
+    Write-Host "`nTenant isolation tests failed: $failures failure(s)" -ForegroundColor Red
+    exit 1
+}
+Write-Host "`nTenant isolation tests completed!" -ForegroundColor Green